@@ -0,0 +1,12 @@
+package config
+
+// CatalogConfig 控制目录对账：磁盘上已不存在的动画先标记为缺失，超过宽限期后删除记录
+type CatalogConfig struct {
+	MissingGraceHours int `json:"missingGraceHours"`
+}
+
+func applyCatalogDefaults(c *CatalogConfig) {
+	if c.MissingGraceHours <= 0 {
+		c.MissingGraceHours = 72
+	}
+}
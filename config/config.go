@@ -2,16 +2,25 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"sync"
 )
 
+const configFile = "config.json"
+
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Log      LogConfig      `json:"log"`
-	Storage  StorageConfig  `json:"storage"`
+	Server    ServerConfig    `json:"server"`
+	Database  DatabaseConfig  `json:"database"`
+	Log       LogConfig       `json:"log"`
+	Storage   StorageConfig   `json:"storage"`
+	Auth      AuthConfig      `json:"auth"`
+	Transcode TranscodeConfig `json:"transcode"`
+	Retention RetentionConfig `json:"retention"`
+	Watcher   WatcherConfig   `json:"watcher"`
+	Catalog   CatalogConfig   `json:"catalog"`
 }
 
 type ServerConfig struct {
@@ -26,24 +35,64 @@ type LogConfig struct {
 	Level string `json:"level"`
 }
 
+type AuthConfig struct {
+	SessionSecret   string `json:"sessionSecret"`
+	SessionTTLHours int    `json:"sessionTTLHours"`
+	CookieSecure    bool   `json:"cookieSecure"`
+	BcryptCost      int    `json:"bcryptCost"`
+	BootstrapAdmin  string `json:"bootstrapAdmin"`
+}
+
+type TranscodeConfig struct {
+	JobWorkers     int                `json:"jobWorkers"`
+	DefaultProfile string             `json:"defaultProfile"`
+	GPUProfile     string             `json:"gpuProfile"`
+	RepairProfile  string             `json:"repairProfile"`
+	Profiles       []TranscodeProfile `json:"profiles"`
+	Ladder         []RenditionConfig  `json:"ladder"`
+}
+
+type RenditionConfig struct {
+	Name          string `json:"name"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	VideoBitrateK int    `json:"videoBitrateK"`
+	MaxrateK      int    `json:"maxrateK"`
+	BufsizeK      int    `json:"bufsizeK"`
+	AudioBitrateK int    `json:"audioBitrateK"`
+	Profile       string `json:"profile"`
+	Level         string `json:"level"`
+}
+
 type StorageConfig struct {
 	DefaultDisk string       `json:"defaultDisk"`
 	Strategy    string       `json:"strategy"`
 	Disks       []DiskConfig `json:"disks"`
+	// 写入后每个磁盘至少要保留的可用空间
+	MinFreeGB float64 `json:"minFreeGB"`
+	// 后台刷新磁盘容量的间隔
+	RefreshMinutes int `json:"refreshMinutes"`
 }
 
 type DiskConfig struct {
-	Name      string `json:"name"`
-	Path      string `json:"path"`
-	MaxSizeGB int    `json:"maxSizeGB"`
-	Priority  int    `json:"priority"`
-	Enabled   bool   `json:"enabled"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// MaxSizeGB 限制该目录下动画的总大小，不是整个分区的用量，0 表示不限制
+	MaxSizeGB int  `json:"maxSizeGB"`
+	Priority  int  `json:"priority"`
+	Enabled   bool `json:"enabled"`
+	// Draining 表示正在清空，不再分配新动画
+	Draining bool `json:"draining"`
 }
 
 var GlobalConfig Config
 
+var saveMu sync.Mutex
+
+// loaded 表示启动时成功读取并解析了配置文件，否则不允许写回
+var loaded bool
+
 func Init() {
-	configFile := "config.json"
 	content, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		log.Printf("警告: 无法读取配置文件 %s: %v\n", configFile, err)
@@ -101,12 +150,90 @@ func Init() {
 			}
 		}
 	}
+
+	loaded = err == nil
+	applyDefaults(&GlobalConfig)
+}
+
+func applyDefaults(cfg *Config) {
+	if cfg.Auth.SessionTTLHours <= 0 {
+		cfg.Auth.SessionTTLHours = 7 * 24
+	}
+	if cfg.Transcode.JobWorkers <= 0 {
+		cfg.Transcode.JobWorkers = 1
+	}
+	applyTranscodeDefaults(&cfg.Transcode)
+	applyRetentionDefaults(&cfg.Retention)
+	applyWatcherDefaults(&cfg.Watcher)
+	applyCatalogDefaults(&cfg.Catalog)
+	if cfg.Storage.MinFreeGB <= 0 {
+		cfg.Storage.MinFreeGB = 5
+	}
+	if cfg.Storage.RefreshMinutes <= 0 {
+		cfg.Storage.RefreshMinutes = 5
+	}
+	if cfg.Auth.BcryptCost <= 0 {
+		cfg.Auth.BcryptCost = 10
+	}
+}
+
+func DefaultLadder() []RenditionConfig {
+	return []RenditionConfig{
+		{Name: "1080p", Width: 1920, Height: 1080, VideoBitrateK: 5000, MaxrateK: 5350, BufsizeK: 7500, AudioBitrateK: 192, Profile: "high", Level: "4.1"},
+		{Name: "720p", Width: 1280, Height: 720, VideoBitrateK: 2800, MaxrateK: 2996, BufsizeK: 4200, AudioBitrateK: 128, Profile: "main", Level: "3.1"},
+		{Name: "480p", Width: 854, Height: 480, VideoBitrateK: 1400, MaxrateK: 1498, BufsizeK: 2100, AudioBitrateK: 96, Profile: "main", Level: "3.0"},
+	}
 }
 
 func Get() *Config {
 	return &GlobalConfig
 }
 
+// SaveStorageDisks 把磁盘列表写回配置文件。重新读取文件后只替换 storage.disks，
+// 其他配置保持文件中的原样，先写临时文件再改名，避免写到一半时损坏
+func SaveStorageDisks(disks []DiskConfig) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	if !loaded {
+		return fmt.Errorf("启动时未能加载配置文件 %s，不能写回", configFile)
+	}
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(content, &root); err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	storage := map[string]json.RawMessage{}
+	if raw, ok := root["storage"]; ok {
+		if err := json.Unmarshal(raw, &storage); err != nil {
+			return fmt.Errorf("解析存储配置失败: %v", err)
+		}
+	}
+
+	if storage["disks"], err = json.Marshal(disks); err != nil {
+		return err
+	}
+	if root["storage"], err = json.Marshal(storage); err != nil {
+		return err
+	}
+	content, err = json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := configFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, configFile); err != nil {
+		return err
+	}
+	GlobalConfig.Storage.Disks = disks
+	return nil
+}
+
 func GetLogger() (*log.Logger, *os.File) {
 	logFile, err := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 源文件保留策略
+const (
+	RetentionKeep              = "keep"
+	RetentionDeleteAfterVerify = "delete-after-verify"
+	RetentionArchive           = "archive"
+	RetentionDeleteAfterDays   = "delete-after-days"
+)
+
+type RetentionConfig struct {
+	Policy                   string  `json:"policy"`
+	ArchivePath              string  `json:"archivePath"`
+	DeleteAfterDays          int     `json:"deleteAfterDays"`
+	DurationToleranceSeconds float64 `json:"durationToleranceSeconds"`
+	// Extensions 是保留策略适用的源文件扩展名，其他格式的源文件一律保留。
+	// 默认只处理 .mp4，与引入保留策略之前只删除 mp4 源文件的行为一致
+	Extensions []string `json:"extensions"`
+}
+
+func applyRetentionDefaults(c *RetentionConfig) {
+	if c.Policy == "" {
+		c.Policy = RetentionDeleteAfterVerify
+	}
+	if c.DurationToleranceSeconds <= 0 {
+		c.DurationToleranceSeconds = 2
+	}
+	if len(c.Extensions) == 0 {
+		c.Extensions = []string{".mp4"}
+	}
+}
+
+// AppliesTo 判断保留策略是否处理该源文件
+func (c *RetentionConfig) AppliesTo(sourcePath string) bool {
+	ext := strings.ToLower(filepath.Ext(sourcePath))
+	for _, allowed := range c.Extensions {
+		if strings.ToLower(allowed) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查保留策略配置，启动时调用
+func (c *RetentionConfig) Validate() error {
+	switch c.Policy {
+	case RetentionKeep, RetentionDeleteAfterVerify:
+	case RetentionArchive:
+		if c.ArchivePath == "" {
+			return fmt.Errorf("保留策略 %s 需要配置 archivePath", c.Policy)
+		}
+	case RetentionDeleteAfterDays:
+		if c.DeleteAfterDays <= 0 {
+			return fmt.Errorf("保留策略 %s 需要配置大于0的 deleteAfterDays", c.Policy)
+		}
+	default:
+		return fmt.Errorf("未知的保留策略 %q", c.Policy)
+	}
+	return nil
+}
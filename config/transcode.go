@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 转码配置的处理模式
+const (
+	ProfileModeCopy           = "copy"
+	ProfileModeX264           = "x264"
+	ProfileModeHEVC           = "hevc"
+	ProfileModeAudioNormalize = "audio-normalize"
+	ProfileModeABR            = "abr"
+)
+
+// 切片封装格式
+const (
+	SegmentTypeTS   = "ts"
+	SegmentTypeFMP4 = "fmp4"
+)
+
+var profileModes = map[string]bool{
+	ProfileModeCopy:           true,
+	ProfileModeX264:           true,
+	ProfileModeHEVC:           true,
+	ProfileModeAudioNormalize: true,
+	ProfileModeABR:            true,
+}
+
+var avcProfiles = map[string]bool{
+	"":         true,
+	"baseline": true,
+	"main":     true,
+	"high":     true,
+}
+
+type TranscodeProfile struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Mode           string   `json:"mode"`
+	VideoEncoder   string   `json:"videoEncoder"`
+	CRF            int      `json:"crf"`
+	Preset         string   `json:"preset"`
+	AudioBitrateK  int      `json:"audioBitrateK"`
+	SegmentSeconds int      `json:"segmentSeconds"`
+	SegmentType    string   `json:"segmentType"`
+	ExtraArgs      []string `json:"extraArgs"`
+}
+
+// IsNVENC 判断是否使用NVIDIA硬件编码器，硬件编码器用 -cq 代替 -crf
+func (p TranscodeProfile) IsNVENC() bool {
+	return strings.HasSuffix(p.VideoEncoder, "_nvenc")
+}
+
+// DefaultProfiles 是内置的转码配置，config.json 中同名配置会覆盖它们
+func DefaultProfiles() []TranscodeProfile {
+	return []TranscodeProfile{
+		{Name: "copy", Description: "直接复制音视频流，只重新封装切片", Mode: ProfileModeCopy, SegmentSeconds: 8, SegmentType: SegmentTypeTS},
+		{Name: "x264", Description: "H.264 CRF 重新编码", Mode: ProfileModeX264, VideoEncoder: "libx264", CRF: 20, Preset: "medium", AudioBitrateK: 160, SegmentSeconds: 6, SegmentType: SegmentTypeTS},
+		{Name: "hevc", Description: "H.265 CRF 重新编码，体积更小", Mode: ProfileModeHEVC, VideoEncoder: "libx265", CRF: 24, Preset: "medium", AudioBitrateK: 160, SegmentSeconds: 6, SegmentType: SegmentTypeFMP4},
+		{Name: "nvenc", Description: "NVIDIA GPU H.264 编码", Mode: ProfileModeX264, VideoEncoder: "h264_nvenc", CRF: 23, Preset: "p5", AudioBitrateK: 160, SegmentSeconds: 6, SegmentType: SegmentTypeTS},
+		{Name: "audio-normalize", Description: "复制视频流，音频响度标准化", Mode: ProfileModeAudioNormalize, AudioBitrateK: 192, SegmentSeconds: 8, SegmentType: SegmentTypeTS},
+		{Name: "abr", Description: "按码率阶梯生成多清晰度自适应切片", Mode: ProfileModeABR, VideoEncoder: "libx264", Preset: "veryfast", SegmentSeconds: 6, SegmentType: SegmentTypeTS},
+		{Name: "repair", Description: "修复损坏切片时使用的GPU重新编码", Mode: ProfileModeX264, VideoEncoder: "h264_nvenc", CRF: 28, Preset: "p7", AudioBitrateK: 128, SegmentSeconds: 3, SegmentType: SegmentTypeTS,
+			ExtraArgs: []string{"-tune", "hq", "-profile:v", "high", "-level", "4.1"}},
+	}
+}
+
+// Profile 按名称查找转码配置，名称为空时返回默认配置
+func (c *TranscodeConfig) Profile(name string) (TranscodeProfile, bool) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	for _, profile := range c.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return TranscodeProfile{}, false
+}
+
+func applyTranscodeDefaults(c *TranscodeConfig) {
+	if len(c.Ladder) == 0 {
+		c.Ladder = DefaultLadder()
+	}
+
+	defined := make(map[string]bool)
+	for _, profile := range c.Profiles {
+		defined[profile.Name] = true
+	}
+	for _, profile := range DefaultProfiles() {
+		if !defined[profile.Name] {
+			c.Profiles = append(c.Profiles, profile)
+		}
+	}
+
+	for i := range c.Profiles {
+		profile := &c.Profiles[i]
+		profile.Mode = strings.ToLower(profile.Mode)
+		profile.SegmentType = strings.ToLower(profile.SegmentType)
+		if profile.SegmentType == "" {
+			profile.SegmentType = SegmentTypeTS
+		}
+		if profile.SegmentSeconds == 0 {
+			profile.SegmentSeconds = 8
+		}
+		if profile.AudioBitrateK == 0 {
+			profile.AudioBitrateK = 128
+		}
+		if profile.VideoEncoder == "" {
+			switch profile.Mode {
+			case ProfileModeX264, ProfileModeABR:
+				profile.VideoEncoder = "libx264"
+			case ProfileModeHEVC:
+				profile.VideoEncoder = "libx265"
+			}
+		}
+	}
+
+	if c.DefaultProfile == "" {
+		c.DefaultProfile = "copy"
+	}
+	// 旧版 useGPU 生成时同样直接复制音视频流，默认保持不重新编码
+	if c.GPUProfile == "" {
+		c.GPUProfile = "copy"
+	}
+	if c.RepairProfile == "" {
+		c.RepairProfile = "repair"
+	}
+}
+
+// Validate 检查转码配置和码率阶梯，启动时调用
+func (c *TranscodeConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, profile := range c.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("转码配置缺少名称")
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("转码配置 %s 重复定义", profile.Name)
+		}
+		names[profile.Name] = true
+
+		if !profileModes[profile.Mode] {
+			return fmt.Errorf("转码配置 %s 的模式 %q 无效", profile.Name, profile.Mode)
+		}
+		if profile.SegmentType != SegmentTypeTS && profile.SegmentType != SegmentTypeFMP4 {
+			return fmt.Errorf("转码配置 %s 的切片格式 %q 无效，只支持 ts 或 fmp4", profile.Name, profile.SegmentType)
+		}
+		if profile.SegmentSeconds < 1 || profile.SegmentSeconds > 60 {
+			return fmt.Errorf("转码配置 %s 的切片时长 %d 秒超出范围", profile.Name, profile.SegmentSeconds)
+		}
+		if (profile.Mode == ProfileModeX264 || profile.Mode == ProfileModeHEVC) && (profile.CRF < 0 || profile.CRF > 51) {
+			return fmt.Errorf("转码配置 %s 的CRF %d 超出范围(0-51)", profile.Name, profile.CRF)
+		}
+		if profile.AudioBitrateK < 0 {
+			return fmt.Errorf("转码配置 %s 的音频码率无效", profile.Name)
+		}
+	}
+
+	for _, name := range []string{c.DefaultProfile, c.GPUProfile, c.RepairProfile} {
+		if !names[name] {
+			return fmt.Errorf("转码配置 %s 不存在", name)
+		}
+	}
+
+	renditions := make(map[string]bool)
+	for _, rendition := range c.Ladder {
+		if rendition.Name == "" {
+			return fmt.Errorf("码率阶梯缺少名称")
+		}
+		if renditions[rendition.Name] {
+			return fmt.Errorf("码率阶梯 %s 重复定义", rendition.Name)
+		}
+		renditions[rendition.Name] = true
+
+		if rendition.Height <= 0 || rendition.VideoBitrateK <= 0 || rendition.MaxrateK <= 0 || rendition.BufsizeK <= 0 {
+			return fmt.Errorf("码率阶梯 %s 的分辨率或码率无效", rendition.Name)
+		}
+		if !avcProfiles[strings.ToLower(rendition.Profile)] {
+			return fmt.Errorf("码率阶梯 %s 的H.264 profile %q 无效", rendition.Name, rendition.Profile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import "fmt"
+
+// 目录监听方式
+const (
+	WatcherModeAuto   = "auto"
+	WatcherModeNotify = "fsnotify"
+	WatcherModePoll   = "poll"
+	WatcherModeOff    = "off"
+)
+
+// WatcherConfig 控制视频目录和存储磁盘的监听。auto 优先使用文件通知，失败时退化为轮询；
+// PollPaths 中的目录（如网络挂载）始终轮询
+type WatcherConfig struct {
+	Mode                string   `json:"mode"`
+	DebounceMillis      int      `json:"debounceMillis"`
+	PollIntervalSeconds int      `json:"pollIntervalSeconds"`
+	PollPaths           []string `json:"pollPaths"`
+}
+
+func applyWatcherDefaults(c *WatcherConfig) {
+	if c.Mode == "" {
+		c.Mode = WatcherModeAuto
+	}
+	if c.DebounceMillis <= 0 {
+		c.DebounceMillis = 2000
+	}
+	if c.PollIntervalSeconds <= 0 {
+		c.PollIntervalSeconds = 60
+	}
+}
+
+// Validate 检查监听配置，启动时调用
+func (c *WatcherConfig) Validate() error {
+	switch c.Mode {
+	case WatcherModeAuto, WatcherModeNotify, WatcherModePoll, WatcherModeOff:
+		return nil
+	default:
+		return fmt.Errorf("未知的监听方式 %q", c.Mode)
+	}
+}
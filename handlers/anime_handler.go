@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnimeHandler struct {
+	catalogService *services.CatalogService
+	authHandler    *AuthHandler
+}
+
+func NewAnimeHandler(authHandler *AuthHandler) *AnimeHandler {
+	return &AnimeHandler{
+		catalogService: services.CatalogServiceInstance,
+		authHandler:    authHandler,
+	}
+}
+
+// Detail 渲染动画详情页
+func (h *AnimeHandler) Detail(c *gin.Context) {
+	detail, err := h.loadDetail(c)
+	if err != nil {
+		c.HTML(http.StatusNotFound, "anime.html", gin.H{"Error": err.Error()})
+		return
+	}
+
+	c.HTML(http.StatusOK, "anime.html", gin.H{
+		"Anime":            detail.Anime,
+		"Episodes":         detail.Episodes,
+		"ContinueWatching": detail.ContinueWatching,
+		"SeasonLabel":      optionLabel(animeSeasons, detail.Anime.Season),
+		"StatusLabel":      optionLabel(animeStatuses, detail.Anime.Status),
+	})
+}
+
+// GetAnime 返回动画信息、剧集列表和当前用户的观看状态
+func (h *AnimeHandler) GetAnime(c *gin.Context) {
+	detail, err := h.loadDetail(c)
+	if err != nil {
+		if _, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// loadDetail 读取路径中的动画ID，未登录时不带观看状态
+func (h *AnimeHandler) loadDetail(c *gin.Context) (*services.AnimeDetail, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, &services.UserError{Message: "无效的动画ID"}
+	}
+
+	userID, _ := h.authHandler.GetUserIDFromCookie(c)
+	return h.catalogService.GetAnimeDetail(uint(id), userID)
+}
+
+func optionLabel(options []selectOption, value string) string {
+	for _, option := range options {
+		if option.Value == value {
+			return option.Label
+		}
+	}
+	return value
+}
@@ -1,21 +1,25 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"anime-website/config"
+	"anime-website/models"
 	"anime-website/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	userService *services.UserService
+	userService    *services.UserService
+	sessionService *services.SessionService
 }
 
 func NewAuthHandler() *AuthHandler {
 	return &AuthHandler{
-		userService: services.UserServiceInstance,
+		userService:    services.UserServiceInstance,
+		sessionService: services.SessionServiceInstance,
 	}
 }
 
@@ -73,62 +77,38 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	userInfo := gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
-	}
-
-	userJSON, err := json.Marshal(userInfo)
-	if err == nil {
-		c.SetCookie(
-			"user",
-			string(userJSON),
-			7*24*60*60,
-			"/",
-			"",
-			false,
-			true,
-		)
+	_, cookieValue, err := h.sessionService.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
 	}
+	h.setSessionCookie(c, cookieValue)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "登录成功",
-		"user":    userInfo,
+		"user":    userInfo(user),
 	})
 }
 
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
-	userCookie, err := c.Cookie("user")
-	if err != nil || userCookie == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
-		return
-	}
-
-	var userInfo gin.H
-	err = json.Unmarshal([]byte(userCookie), &userInfo)
-	if err != nil {
+	user, _, ok := h.currentUser(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
-		"user":   userInfo,
+		"user":   userInfo(user),
 	})
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
-	c.SetCookie(
-		"user",
-		"",
-		-1,
-		"/",
-		"",
-		false,
-		true,
-	)
+	if cookieValue, err := c.Cookie(services.SessionCookieName); err == nil && cookieValue != "" {
+		h.sessionService.RevokeCookie(cookieValue)
+	}
+	h.clearSessionCookie(c)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
@@ -137,73 +117,190 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 }
 
 func (h *AuthHandler) RenewCookie(c *gin.Context) {
-	userCookie, err := c.Cookie("user")
-	if err != nil || userCookie == "" {
+	user, session, ok := h.currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+
+	if err := h.sessionService.Renew(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "续签失败"})
+		return
+	}
+
+	cookieValue, _ := c.Cookie(services.SessionCookieName)
+	h.setSessionCookie(c, cookieValue)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Cookie续签成功",
+		"user":    userInfo(user),
+	})
+}
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	_, current, ok := h.currentUser(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
 		return
 	}
 
-	var userInfo map[string]interface{}
-	err = json.Unmarshal([]byte(userCookie), &userInfo)
+	sessions, err := h.sessionService.ListUserSessions(current.UserID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	responses := make([]gin.H, len(sessions))
+	for i, session := range sessions {
+		responses[i] = gin.H{
+			"id":         session.ID,
+			"userAgent":  session.UserAgent,
+			"ip":         session.IP,
+			"createdAt":  session.CreatedAt.Format("2006-01-02 15:04:05"),
+			"lastSeenAt": session.LastSeenAt.Format("2006-01-02 15:04:05"),
+			"expiresAt":  session.ExpiresAt.Format("2006-01-02 15:04:05"),
+			"current":    session.ID == current.ID,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": responses,
+		"total":    len(responses),
+	})
+}
+
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	_, current, ok := h.currentUser(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
 		return
 	}
 
-	userID, ok := userInfo["id"].(float64)
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	err = h.sessionService.Revoke(current.UserID, uint(sessionID))
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	if uint(sessionID) == current.ID {
+		h.clearSessionCookie(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	_, current, ok := h.currentUser(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
 		return
 	}
 
-	user, err := h.userService.GetUserByID(uint(userID))
+	if err := h.sessionService.RevokeOthers(current.UserID, current.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (h *AuthHandler) SetUserRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
 		return
 	}
 
-	newUserInfo := gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "details": err.Error()})
+		return
 	}
 
-	newUserJSON, err := json.Marshal(newUserInfo)
-	if err == nil {
-		c.SetCookie(
-			"user",
-			string(newUserJSON),
-			7*24*60*60,
-			"/",
-			"",
-			false,
-			true,
-		)
+	if err := h.userService.SetRole(uint(userID), req.Role); err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新角色失败"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Cookie续签成功",
-		"user":    newUserInfo,
-	})
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
 func (h *AuthHandler) GetUserIDFromCookie(c *gin.Context) (uint, bool) {
-	userCookie, err := c.Cookie("user")
-	if err != nil || userCookie == "" {
+	session, ok := h.currentSession(c)
+	if !ok {
 		return 0, false
 	}
+	return session.UserID, true
+}
 
-	var userInfo map[string]interface{}
-	err = json.Unmarshal([]byte(userCookie), &userInfo)
-	if err != nil {
-		return 0, false
+func (h *AuthHandler) currentSession(c *gin.Context) (*models.Session, bool) {
+	cookieValue, err := c.Cookie(services.SessionCookieName)
+	if err != nil || cookieValue == "" {
+		return nil, false
 	}
+	return h.sessionService.Validate(cookieValue)
+}
 
-	userID, ok := userInfo["id"].(float64)
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, *models.Session, bool) {
+	session, ok := h.currentSession(c)
 	if !ok {
-		return 0, false
+		return nil, nil, false
 	}
 
-	return uint(userID), true
+	user, err := h.userService.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, nil, false
+	}
+	return user, session, true
+}
+
+func (h *AuthHandler) setSessionCookie(c *gin.Context, value string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		services.SessionCookieName,
+		value,
+		int(h.sessionService.TTL().Seconds()),
+		"/",
+		"",
+		config.Get().Auth.CookieSecure,
+		true,
+	)
+}
+
+func (h *AuthHandler) clearSessionCookie(c *gin.Context) {
+	c.SetCookie(
+		services.SessionCookieName,
+		"",
+		-1,
+		"/",
+		"",
+		config.Get().Auth.CookieSecure,
+		true,
+	)
+}
+
+func userInfo(user *models.User) gin.H {
+	return gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}
 }
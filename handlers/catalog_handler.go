@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"anime-website/config"
+	"anime-website/models"
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 目录对账接口只有管理员可以使用
+const CatalogAdminRole = models.RoleAdmin
+
+type CatalogHandler struct {
+	reconcileService *services.ReconcileService
+	catalogService   *services.CatalogService
+}
+
+func NewCatalogHandler() *CatalogHandler {
+	return &CatalogHandler{
+		reconcileService: services.ReconcileServiceInstance,
+		catalogService:   services.CatalogServiceInstance,
+	}
+}
+
+// ListAnimes 分页返回动画列表，支持排序和筛选
+func (h *CatalogHandler) ListAnimes(c *gin.Context) {
+	query, err := catalogQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.catalogService.ListAnimes(query)
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *CatalogHandler) Orphans(c *gin.Context) {
+	report, err := h.reconcileService.Orphans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"missingGraceHours": config.Get().Catalog.MissingGraceHours,
+		"missingAnimes":     report.MissingAnimes,
+		"missingEpisodes":   report.MissingEpisodes,
+		"orphanEpisodes":    report.OrphanEpisodes,
+		"untrackedFolders":  report.UntrackedFolders,
+	})
+}
+
+func (h *CatalogHandler) Reconcile(c *gin.Context) {
+	report := h.reconcileService.Reconcile()
+	c.JSON(http.StatusOK, report)
+}
+
+// catalogQueryFromRequest 读取动画列表的分页、排序和筛选参数
+func catalogQueryFromRequest(c *gin.Context) (services.CatalogQuery, error) {
+	query := services.CatalogQuery{
+		Filter: animeFilterFromQuery(c),
+		Disk:   c.Query("disk"),
+		Sort:   c.Query("sort"),
+		Order:  c.Query("order"),
+		Cursor: c.Query("cursor"),
+		Limit:  services.DefaultCatalogLimit,
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, &services.UserError{Message: "无效的每页数量"}
+		}
+		query.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil {
+			return query, &services.UserError{Message: "无效的偏移量"}
+		}
+		query.Offset = offset
+	}
+	if value := c.Query("has_cover"); value != "" {
+		hasCover, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, &services.UserError{Message: "无效的 has_cover 参数"}
+		}
+		query.HasCover = &hasCover
+	}
+	return query, nil
+}
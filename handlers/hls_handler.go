@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"anime-website/models"
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HLSHandler struct {
+	verifyService *services.HLSVerifyService
+	jobService    *services.JobService
+}
+
+func NewHLSHandler() *HLSHandler {
+	return &HLSHandler{
+		verifyService: services.HLSVerifyServiceInstance,
+		jobService:    services.JobServiceInstance,
+	}
+}
+
+// Health 返回各剧集最近一次的校验结果，?anime= 按动画过滤，?unhealthy=true 只看异常
+func (h *HLSHandler) Health(c *gin.Context) {
+	results, err := h.verifyService.ListHealth(c.Query("anime"), c.Query("unhealthy") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	episodes := make([]gin.H, len(results))
+	for i := range results {
+		episodes[i] = healthResponse(&results[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   h.verifyService.Status(),
+		"summary":  h.verifyService.Summary(results),
+		"episodes": episodes,
+	})
+}
+
+// Verify 在后台重新校验，?anime= 只校验指定动画
+func (h *HLSHandler) Verify(c *gin.Context) {
+	if err := h.verifyService.StartVerify(c.Query("anime")); err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "启动校验失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "开始校验HLS切片，请稍后查看结果"})
+}
+
+// Repair 为校验异常的剧集创建修复任务并推送进度，?anime= 和 ?episode= 用于缩小范围，
+// ?jobId= 重新连接到已有任务。停止与批量转码共用 /api/batch-hls/stop
+func (h *HLSHandler) Repair(c *gin.Context) {
+	if jobID := c.Query("jobId"); jobID != "" {
+		id, err := strconv.ParseUint(jobID, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "data: {\"type\": \"error\", \"message\": \"无效的任务ID\"}\n\n")
+			return
+		}
+		streamJobEvents(c, h.jobService, uint(id))
+		return
+	}
+
+	var userID uint
+	if user, ok := CurrentUser(c); ok {
+		userID = user.ID
+	}
+
+	job, err := h.jobService.EnqueueRepair(c.Query("anime"), c.Query("episode"), userID)
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.String(http.StatusBadRequest, "data: {\"type\": \"error\", \"message\": %q}\n\n", userErr.Message)
+			return
+		}
+		c.String(http.StatusInternalServerError, "data: {\"type\": \"error\", \"message\": \"创建任务失败\"}\n\n")
+		return
+	}
+
+	streamJobEvents(c, h.jobService, job.ID)
+}
+
+func healthResponse(health *models.HLSHealth) gin.H {
+	return gin.H{
+		"animeFolder":      health.AnimeFolder,
+		"episode":          health.Episode,
+		"storageDisk":      health.StorageDisk,
+		"healthy":          health.Healthy,
+		"problems":         health.ProblemList(),
+		"segmentCount":     health.SegmentCount,
+		"missingSegments":  health.MissingSegments,
+		"emptySegments":    health.EmptySegments,
+		"playlistDuration": health.PlaylistDuration,
+		"probedDuration":   health.ProbedDuration,
+		"hasEndList":       health.HasEndList,
+		"checkedAt":        health.CheckedAt,
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anime-website/models"
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	jobService *services.JobService
+}
+
+func NewJobHandler() *JobHandler {
+	return &JobHandler{
+		jobService: services.JobServiceInstance,
+	}
+}
+
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	jobs, err := h.jobService.ListJobs(c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	responses := make([]gin.H, len(jobs))
+	for i := range jobs {
+		responses[i] = jobResponse(&jobs[i], false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  responses,
+		"total": len(responses),
+	})
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, ok := h.findJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": jobResponse(job, true)})
+}
+
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	job, ok := h.findJob(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.jobService.Cancel(job.ID)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "result": result, "message": cancelMessage(result)})
+}
+
+// cancelMessage 按取消结果说明任务实际是否被停止
+func cancelMessage(result services.CancelResult) string {
+	switch result {
+	case services.CancelQueued:
+		return "排队中的任务已取消"
+	case services.CancelStopRequested:
+		return "已请求停止，任务会在当前视频处理中断后结束"
+	default:
+		return "任务已结束，无需停止"
+	}
+}
+
+func (h *JobHandler) RetryJob(c *gin.Context) {
+	job, ok := h.findJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobService.Retry(job.ID)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "job": jobResponse(job, false)})
+}
+
+func (h *JobHandler) JobEvents(c *gin.Context) {
+	job, ok := h.findJob(c)
+	if !ok {
+		return
+	}
+
+	streamJobEvents(c, h.jobService, job.ID)
+}
+
+func (h *JobHandler) findJob(c *gin.Context) (*models.TranscodeJob, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return nil, false
+	}
+
+	job, err := h.jobService.GetJob(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return nil, false
+	}
+	return job, true
+}
+
+// streamJobEvents 以SSE方式推送任务事件，客户端断开不会影响任务本身
+func streamJobEvents(c *gin.Context, jobService *services.JobService, jobID uint) {
+	events, unsubscribe, err := jobService.Subscribe(jobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Process-ID", fmt.Sprintf("%d", jobID))
+	c.Status(http.StatusOK)
+
+	if job, err := jobService.GetJob(jobID); err == nil {
+		writeSSE(c, map[string]interface{}{
+			"type":      "snapshot",
+			"jobId":     job.ID,
+			"status":    job.Status,
+			"current":   job.Success + job.Failed + job.Skipped,
+			"total":     job.Total,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+	}
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if job, err := jobService.GetJob(jobID); err == nil {
+					writeSSE(c, jobCompleteEvent(job))
+				}
+				return
+			}
+			if !writeSSE(c, event) {
+				return
+			}
+		case <-heartbeat.C:
+			if !writeSSE(c, map[string]interface{}{"type": "heartbeat", "timestamp": time.Now().Format(time.RFC3339)}) {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(c *gin.Context, event map[string]interface{}) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return true
+	}
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+func jobCompleteEvent(job *models.TranscodeJob) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "complete",
+		"jobId":     job.ID,
+		"status":    job.Status,
+		"message":   job.Message,
+		"current":   job.Total,
+		"total":     job.Total,
+		"success":   job.Success,
+		"failed":    job.Failed,
+		"skipped":   job.Skipped,
+		"errors":    job.ErrorList(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+}
+
+func jobResponse(job *models.TranscodeJob, detail bool) gin.H {
+	response := gin.H{
+		"id":         job.ID,
+		"type":       job.Type,
+		"status":     job.Status,
+		"profile":    job.Profile,
+		"target":     job.Target,
+		"total":      job.Total,
+		"success":    job.Success,
+		"failed":     job.Failed,
+		"skipped":    job.Skipped,
+		"message":    job.Message,
+		"createdBy":  job.CreatedBy,
+		"startedAt":  job.StartedAt,
+		"finishedAt": job.FinishedAt,
+		"createdAt":  job.CreatedAt,
+	}
+	if detail {
+		response["videos"] = job.VideoList()
+		response["errors"] = job.ErrorList()
+	}
+	return response
+}
+
+func respondJobError(c *gin.Context, err error) {
+	if userErr, ok := err.(*services.UserError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+}
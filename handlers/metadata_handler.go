@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetadataHandler struct {
+	metadataService *services.MetadataService
+}
+
+func NewMetadataHandler() *MetadataHandler {
+	return &MetadataHandler{
+		metadataService: services.MetadataServiceInstance,
+	}
+}
+
+// GetMetadata 返回动画的元数据和标签
+func (h *MetadataHandler) GetMetadata(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的动画ID"})
+		return
+	}
+
+	anime, err := h.metadataService.GetAnime(uint(id))
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"anime": anime})
+}
+
+// UpdateMetadata 修改动画的元数据，请求中没有的字段保持不变
+func (h *MetadataHandler) UpdateMetadata(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的动画ID"})
+		return
+	}
+
+	var metadata services.AnimeMetadata
+	if err := c.ShouldBindJSON(&metadata); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	anime, err := h.metadataService.UpdateMetadata(uint(id), metadata)
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "anime": anime})
+}
+
+// ListTags 列出所有标签，?kind=tag 或 ?kind=genre 只返回一类
+func (h *MetadataHandler) ListTags(c *gin.Context) {
+	tags, err := h.metadataService.ListTags(c.Query("kind"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func respondMetadataError(c *gin.Context, err error) {
+	if userErr, ok := err.(*services.UserError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "更新动画信息失败"})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"anime-website/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const contextUserKey = "currentUser"
+
+// RequireRole 要求请求来自已登录且角色不低于role的用户
+func (h *AuthHandler) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _, ok := h.currentUser(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+			return
+		}
+
+		if !user.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "权限不足", "requiredRole": role})
+			return
+		}
+
+		c.Set(contextUserKey, user)
+		c.Next()
+	}
+}
+
+// CurrentUser 返回RequireRole中间件放入上下文的用户
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	value, exists := c.Get(contextUserKey)
+	if !exists {
+		return nil, false
+	}
+	user, ok := value.(*models.User)
+	return user, ok
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strconv"
 
+	"anime-website/models"
 	"anime-website/services"
 
 	"github.com/gin-gonic/gin"
@@ -57,7 +59,16 @@ func (h *PlayHistoryHandler) SavePlayHistory(c *gin.Context) {
 
 func (h *PlayHistoryHandler) GetPlayHistory(c *gin.Context) {
 	videoId := c.Query("videoId")
-	if videoId == "" {
+	var episodeID uint64
+	if value := c.Query("episodeId"); value != "" {
+		var err error
+		episodeID, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的episodeId"})
+			return
+		}
+	}
+	if videoId == "" && episodeID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少videoId"})
 		return
 	}
@@ -68,7 +79,13 @@ func (h *PlayHistoryHandler) GetPlayHistory(c *gin.Context) {
 		return
 	}
 
-	history, err := h.playHistoryService.GetPlayHistory(userID, videoId)
+	var history *models.PlayHistory
+	var err error
+	if episodeID != 0 {
+		history, err = h.playHistoryService.GetPlayHistoryByEpisode(userID, uint(episodeID))
+	} else {
+		history, err = h.playHistoryService.GetPlayHistory(userID, videoId)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 		return
@@ -77,6 +94,7 @@ func (h *PlayHistoryHandler) GetPlayHistory(c *gin.Context) {
 	if history == nil {
 		c.JSON(http.StatusOK, gin.H{
 			"videoId":     videoId,
+			"episodeId":   episodeID,
 			"currentTime": 0,
 			"duration":    0,
 			"progress":    0,
@@ -88,6 +106,7 @@ func (h *PlayHistoryHandler) GetPlayHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"id":            history.ID,
 		"videoId":       history.VideoID,
+		"episodeId":     history.EpisodeID,
 		"animeTitle":    history.AnimeTitle,
 		"episode":       history.Episode,
 		"videoUrl":      history.VideoURL,
@@ -118,6 +137,7 @@ func (h *PlayHistoryHandler) GetAllPlayHistory(c *gin.Context) {
 	type HistoryResponse struct {
 		ID          uint    `json:"id"`
 		VideoID     string  `json:"videoId"`
+		EpisodeID   uint    `json:"episodeId"`
 		AnimeTitle  string  `json:"animeTitle"`
 		Episode     string  `json:"episode"`
 		VideoURL    string  `json:"videoUrl"`
@@ -133,6 +153,7 @@ func (h *PlayHistoryHandler) GetAllPlayHistory(c *gin.Context) {
 		responses[i] = HistoryResponse{
 			ID:          h.ID,
 			VideoID:     h.VideoID,
+			EpisodeID:   h.EpisodeID,
 			AnimeTitle:  h.AnimeTitle,
 			Episode:     h.Episode,
 			VideoURL:    h.VideoURL,
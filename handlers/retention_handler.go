@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"anime-website/config"
+	"anime-website/models"
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 源文件审计记录只有管理员可以查看
+const RetentionAuditRole = models.RoleAdmin
+
+type RetentionHandler struct {
+	retentionService *services.RetentionService
+}
+
+func NewRetentionHandler() *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: services.RetentionServiceInstance,
+	}
+}
+
+func (h *RetentionHandler) ListAudits(c *gin.Context) {
+	limit := 100
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 1000 {
+		limit = value
+	}
+
+	audits, err := h.retentionService.ListAudits(c.Query("action"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy": config.Get().Retention.Policy,
+		"audits": audits,
+		"total":  len(audits),
+	})
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"anime-website/config"
+	"anime-website/models"
+	"anime-website/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 存储管理接口只有管理员可以使用
+const StorageAdminRole = models.RoleAdmin
+
+type StorageHandler struct {
+	storageService *services.StorageService
+	jobService     *services.JobService
+}
+
+func NewStorageHandler() *StorageHandler {
+	return &StorageHandler{
+		storageService: services.StorageServiceInstance,
+		jobService:     services.JobServiceInstance,
+	}
+}
+
+type pinPlacementRequest struct {
+	FolderName string `json:"folderName"`
+	Disk       string `json:"disk"`
+}
+
+// ListPlacements 列出每个动画分配到的磁盘
+func (h *StorageHandler) ListPlacements(c *gin.Context) {
+	placements, err := h.storageService.ListPlacements()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"placements": placements})
+}
+
+// PinPlacement 把动画固定到指定磁盘，之后的剧集都写到这个磁盘
+func (h *StorageHandler) PinPlacement(c *gin.Context) {
+	var req pinPlacementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	placement, err := h.storageService.PinPlacement(req.FolderName, req.Disk)
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "placement": placement})
+}
+
+// UnpinPlacement 取消固定，?folder= 指定动画目录名
+func (h *StorageHandler) UnpinPlacement(c *gin.Context) {
+	placement, err := h.storageService.UnpinPlacement(c.Query("folder"))
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "placement": placement})
+}
+
+// migrateRequest 指定要迁移的动画，或用 DrainDisk 迁出一个磁盘上的所有动画。Disk 为空时自动选择目标磁盘
+type migrateRequest struct {
+	FolderName string   `json:"folderName"`
+	Folders    []string `json:"folders"`
+	Disk       string   `json:"disk"`
+	DrainDisk  string   `json:"drainDisk"`
+}
+
+// Migrate 创建迁移任务，进度通过 /api/jobs/:id/events 查看
+func (h *StorageHandler) Migrate(c *gin.Context) {
+	var req migrateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	var userID uint
+	if user, ok := CurrentUser(c); ok {
+		userID = user.ID
+	}
+
+	var job *models.TranscodeJob
+	var err error
+	if req.DrainDisk != "" {
+		job, err = h.jobService.EnqueueDrain(req.DrainDisk, req.Disk, userID)
+	} else {
+		folders := req.Folders
+		if req.FolderName != "" {
+			folders = append(folders, req.FolderName)
+		}
+		job, err = h.jobService.EnqueueMigrate(folders, req.Disk, userID)
+	}
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "job": jobResponse(job, true)})
+}
+
+type addDiskRequest struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MaxSizeGB int    `json:"maxSizeGB"`
+	Priority  int    `json:"priority"`
+}
+
+// ListDisks 列出所有磁盘的容量、动画数量和健康状态
+func (h *StorageHandler) ListDisks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"disks": h.storageService.ListDiskStatus()})
+}
+
+// AddDisk 添加并启用磁盘，写回配置文件后立即可以通过 /storage/<name>/ 访问
+func (h *StorageHandler) AddDisk(c *gin.Context) {
+	var req addDiskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	disk, err := h.storageService.AddDisk(config.DiskConfig{
+		Name:      req.Name,
+		Path:      req.Path,
+		MaxSizeGB: req.MaxSizeGB,
+		Priority:  req.Priority,
+	})
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "disk": disk})
+}
+
+// EnableDisk 启用磁盘，也用于取消清空
+func (h *StorageHandler) EnableDisk(c *gin.Context) {
+	disk, err := h.storageService.EnableDisk(c.Param("name"))
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "disk": disk})
+}
+
+// DisableDisk 停用磁盘，磁盘上还有动画时需要 ?force=true
+func (h *StorageHandler) DisableDisk(c *gin.Context) {
+	disk, err := h.storageService.DisableDisk(c.Param("name"), c.Query("force") == "true")
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "disk": disk})
+}
+
+// DrainDisk 停止往磁盘分配新动画，并创建任务把上面的动画迁走。请求体中的 disk 指定目标磁盘，为空时自动选择
+func (h *StorageHandler) DrainDisk(c *gin.Context) {
+	var req struct {
+		Disk string `json:"disk"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	name := c.Param("name")
+	if err := h.storageService.CheckMigrateTarget(req.Disk); err != nil || req.Disk == name {
+		if err == nil {
+			err = &services.UserError{Message: "目标磁盘不能是要清空的磁盘"}
+		}
+		respondStorageError(c, err)
+		return
+	}
+
+	disk, err := h.storageService.DrainDisk(name)
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+
+	response := gin.H{"status": "success", "disk": disk}
+	if disk.AnimeCount > 0 {
+		var userID uint
+		if user, ok := CurrentUser(c); ok {
+			userID = user.ID
+		}
+		job, err := h.jobService.EnqueueDrain(name, req.Disk, userID)
+		if err != nil {
+			respondStorageError(c, err)
+			return
+		}
+		response["job"] = jobResponse(job, true)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ServeFile 提供 /storage/<disk>/ 下的文件。按当前磁盘列表查找，添加或停用磁盘后不需要重启
+func (h *StorageHandler) ServeFile(c *gin.Context) {
+	root, ok := h.storageService.ServingPath(c.Param("disk"))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.FileFromFS(c.Param("filepath"), gin.Dir(root, false))
+}
+
+func respondStorageError(c *gin.Context, err error) {
+	if userErr, ok := err.(*services.UserError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+}
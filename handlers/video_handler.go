@@ -1,17 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
 
+	"anime-website/config"
 	"anime-website/models"
 	"anime-website/services"
 	"anime-website/utils"
@@ -27,60 +28,136 @@ const (
 
 var allowedFormats = []string{".mp4", ".flv", ".mkv", ".avi"}
 
+// selectOption 是页面下拉框的一个选项
+type selectOption struct {
+	Value string
+	Label string
+}
+
+var animeSeasons = []selectOption{
+	{models.AnimeSeasonWinter, "冬季"},
+	{models.AnimeSeasonSpring, "春季"},
+	{models.AnimeSeasonSummer, "夏季"},
+	{models.AnimeSeasonFall, "秋季"},
+}
+
+var animeStatuses = []selectOption{
+	{models.AnimeStatusUpcoming, "未开播"},
+	{models.AnimeStatusAiring, "连载中"},
+	{models.AnimeStatusFinished, "已完结"},
+}
+
+var catalogSorts = []selectOption{
+	{services.CatalogSortAdded, "最近添加"},
+	{services.CatalogSortUpdated, "最近更新"},
+	{services.CatalogSortTitle, "标题"},
+	{services.CatalogSortEpisodes, "集数"},
+	{services.CatalogSortPopularity, "热度"},
+}
+
+// 管理类接口所需的最低角色，在路由注册时配合 AuthHandler.RequireRole 使用
+const (
+	ScanVideosRole   = models.RoleUploader
+	BatchHLSRole     = models.RoleUploader
+	DeleteAnimeRole  = models.RoleAdmin
+	FixHLSVideosRole = models.RoleAdmin
+	HLSHealthRole    = models.RoleAdmin
+	UpdateAnimeRole  = models.RoleAdmin
+)
+
 type VideoHandler struct {
 	videoService *services.VideoService
+	jobService   *services.JobService
 }
 
 func NewVideoHandler() *VideoHandler {
 	return &VideoHandler{
 		videoService: services.VideoServiceInstance,
+		jobService:   services.JobServiceInstance,
 	}
 }
 
 func (h *VideoHandler) Index(c *gin.Context) {
 	showAll := c.Query("showAll") == "true"
-
-	var animes []models.AnimeInfo
-	if !services.LocalMode {
-		animes = h.videoService.GetAnimesFromDB()
-	}
-	if len(animes) == 0 {
-		animes = h.videoService.ScanVideos()
+	query, _ := catalogQueryFromRequest(c)
+	if showAll {
+		query.Cursor, query.Offset, query.Limit = "", 0, 0
 	}
 
-	var displayAnimes []models.AnimeInfo
-	if showAll {
-		displayAnimes = animes
-	} else {
-		limit := 20
-		if len(animes) > limit {
-			displayAnimes = animes[:limit]
-		} else {
-			displayAnimes = animes
-		}
+	page, err := services.CatalogServiceInstance.ListAnimes(query)
+	if err != nil {
+		// 参数无效时按默认方式显示
+		page, _ = services.CatalogServiceInstance.ListAnimes(services.CatalogQuery{
+			Filter: query.Filter,
+			Limit:  services.DefaultCatalogLimit,
+		})
 	}
 
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"Animes":      displayAnimes,
+	data := gin.H{
+		"Animes":      page.Items,
 		"ShowAll":     showAll,
-		"TotalAnimes": len(animes),
-	})
+		"TotalAnimes": page.Total,
+		"NextCursor":  page.NextCursor,
+		"Sort":        page.Sort,
+		"Sorts":       catalogSorts,
+	}
+	addFilterOptions(data, query.Filter)
+	c.HTML(http.StatusOK, "index.html", data)
 }
 
 func (h *VideoHandler) Search(c *gin.Context) {
 	keyword := c.Query("keyword")
 	if keyword == "" {
-		c.Redirect(http.StatusFound, "/")
+		c.Redirect(http.StatusFound, "/?"+c.Request.URL.RawQuery)
 		return
 	}
 
-	animes := h.videoService.SearchAnimes(keyword)
+	filter := animeFilterFromQuery(c)
+	var animes []models.AnimeInfo
+	snippets := make(map[string]template.HTML)
+	for _, result := range services.SearchServiceInstance.Search(keyword, 0) {
+		if filter.Match(result.Anime) {
+			animes = append(animes, result.Anime)
+			snippets[result.Anime.FolderName] = template.HTML(result.Snippet)
+		}
+	}
 
-	c.HTML(http.StatusOK, "index.html", gin.H{
+	data := gin.H{
 		"Animes":      animes,
 		"Keyword":     keyword,
+		"Snippets":    snippets,
 		"TotalAnimes": len(animes),
-	})
+	}
+	addFilterOptions(data, filter)
+	c.HTML(http.StatusOK, "index.html", data)
+}
+
+// animeFilterFromQuery 读取首页和搜索页的筛选参数
+func animeFilterFromQuery(c *gin.Context) services.AnimeFilter {
+	year, _ := strconv.Atoi(c.Query("year"))
+	minRating, _ := strconv.ParseFloat(c.Query("min_rating"), 64)
+	return services.AnimeFilter{
+		Tag:       c.Query("tag"),
+		Genre:     c.Query("genre"),
+		Year:      year,
+		Season:    c.Query("season"),
+		Studio:    c.Query("studio"),
+		Status:    c.Query("status"),
+		MinRating: minRating,
+	}
+}
+
+// addFilterOptions 加入筛选栏需要的当前条件和可选项
+func addFilterOptions(data gin.H, filter services.AnimeFilter) {
+	data["Filter"] = filter
+	data["Seasons"] = animeSeasons
+	data["Statuses"] = animeStatuses
+	if tags, err := services.MetadataServiceInstance.ListTags(models.TagKindTag); err == nil {
+		data["Tags"] = tags
+	}
+	if genres, err := services.MetadataServiceInstance.ListTags(models.TagKindGenre); err == nil {
+		data["Genres"] = genres
+	}
 }
 
 func (h *VideoHandler) Play(c *gin.Context) {
@@ -102,15 +179,26 @@ func (h *VideoHandler) Play(c *gin.Context) {
 	log.Printf("summary: %s", summary)
 	log.Printf("keyword: %s", keyword)
 
+	var anime models.AnimeInfo
+	var found bool
+
+	// 从详情页进入时只带剧集ID，动画信息和播放地址都从记录中读取
+	if id, err := strconv.ParseUint(c.Query("episode"), 10, 64); err == nil {
+		if episode, ok := services.EpisodeServiceInstance.GetEpisode(uint(id)); ok {
+			if current, err := services.CatalogServiceInstance.GetAnime(episode.AnimeID); err == nil {
+				anime, found = *current, true
+				videoURL = episode.PlaylistURL
+				title, summary, keyword = anime.Title, anime.Summary, anime.FolderName
+			}
+		}
+	}
+
 	if videoURL == "" {
 		c.Redirect(http.StatusFound, "/")
 		return
 	}
 
-	var anime models.AnimeInfo
-	var found bool
-
-	if keyword != "" {
+	if !found && keyword != "" {
 		log.Printf("使用keyword '%s' 获取动画信息", keyword)
 		anime, found = h.videoService.GetAnimeInfo(keyword)
 		if found {
@@ -122,11 +210,11 @@ func (h *VideoHandler) Play(c *gin.Context) {
 		}
 	}
 
-	var videoList []models.VideoFile
-	if keyword != "" {
-		log.Printf("使用keyword '%s' 获取视频列表", keyword)
-		videoList = h.videoService.GetAnimeVideos(keyword)
-		log.Printf("获取到 %d 个视频文件", len(videoList))
+	var episodes []models.Episode
+	if found {
+		log.Printf("使用keyword '%s' 获取剧集列表", keyword)
+		episodes = h.videoService.GetAnimeEpisodes(anime)
+		log.Printf("获取到 %d 个剧集", len(episodes))
 	}
 
 	log.Printf("检查videoURL是否为HLS格式: %s", videoURL)
@@ -149,7 +237,7 @@ func (h *VideoHandler) Play(c *gin.Context) {
 
 		if _, err := os.Stat(hlsFilePath); os.IsNotExist(err) {
 			log.Printf("HLS文件不存在，开始生成: %s\n", videoURL)
-			err = h.videoService.GenerateHLSHighQuality(videoURL)
+			err = h.videoService.GenerateHLS(videoURL)
 			if err == nil {
 				videoURL = hlsPath
 				log.Printf("HLS切片生成成功: %s\n", hlsPath)
@@ -195,16 +283,26 @@ func (h *VideoHandler) Play(c *gin.Context) {
 		}
 	}
 
+	var episodeID uint
+	for _, episode := range episodes {
+		if episode.PlaylistURL == videoURL {
+			episodeID = episode.ID
+			break
+		}
+	}
+
 	log.Printf("最终使用的VideoURL: %s", videoURL)
-	log.Printf("准备渲染模板，VideoList长度: %d", len(videoList))
+	log.Printf("准备渲染模板，Episodes长度: %d", len(episodes))
 
 	c.HTML(http.StatusOK, "play.html", gin.H{
 		"Title":     title,
 		"Summary":   summary,
 		"VideoURL":  videoURL,
-		"VideoList": videoList,
+		"Episodes":  episodes,
+		"EpisodeID": episodeID,
 		"Keyword":   keyword,
 		"Cover":     anime.Cover,
+		"AnimeID":   anime.ID,
 	})
 }
 
@@ -231,7 +329,7 @@ func (h *VideoHandler) VideoList(c *gin.Context) {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			animeFolder := filepath.Join(videosDir, entry.Name())
 
 			videoFiles, err := ioutil.ReadDir(animeFolder)
@@ -279,13 +377,20 @@ func (h *VideoHandler) VideoList(c *gin.Context) {
 }
 
 func (h *VideoHandler) BatchHLS(c *gin.Context) {
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
+	if jobID := c.Query("jobId"); jobID != "" {
+		id, err := strconv.ParseUint(jobID, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "data: {\"type\": \"error\", \"message\": \"无效的任务ID\"}\n\n")
+			return
+		}
+		streamJobEvents(c, h.jobService, uint(id))
+		return
+	}
 
 	var request struct {
-		Videos []string `json:"videos"`
-		UseGPU bool     `json:"useGPU"`
+		Videos  []string `json:"videos"`
+		Profile string   `json:"profile"`
+		UseGPU  bool     `json:"useGPU"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -303,72 +408,37 @@ func (h *VideoHandler) BatchHLS(c *gin.Context) {
 		normalizedVideos[i] = utils.NormalizeURLPath(v)
 	}
 
-	processID := fmt.Sprintf("%d", time.Now().UnixNano())
-
-	progressChan := make(chan map[string]interface{})
-	stopChan := make(chan struct{})
-
-	services.BatchProcessingMutex.Lock()
-	services.BatchProcessingContexts[processID] = map[string]interface{}{
-		"stopChan":     stopChan,
-		"progressChan": progressChan,
-		"startTime":    time.Now(),
+	var userID uint
+	if user, ok := CurrentUser(c); ok {
+		userID = user.ID
 	}
-	services.BatchProcessingMutex.Unlock()
 
-	c.Writer.Header().Set("X-Process-ID", processID)
-	c.Writer.Flush()
-
-	go func() {
-		total, success, failed, skipped, errors := h.videoService.BatchGenerateHLS(normalizedVideos, request.UseGPU, progressChan, stopChan)
-
-		select {
-		case progressChan <- map[string]interface{}{
-			"type":      "complete",
-			"current":   total,
-			"total":     total,
-			"success":   success,
-			"failed":    failed,
-			"skipped":   skipped,
-			"errors":    errors,
-			"timestamp": time.Now().Format(time.RFC3339),
-		}:
-		default:
-		}
-
-		close(progressChan)
-
-		services.BatchProcessingMutex.Lock()
-		delete(services.BatchProcessingContexts, processID)
-		services.BatchProcessingMutex.Unlock()
-	}()
+	// 兼容旧客户端：未指定配置时按 useGPU 选择 gpuProfile（默认与旧版一样复制流），否则用默认配置
+	profileName := request.Profile
+	if profileName == "" && request.UseGPU {
+		profileName = config.Get().Transcode.GPUProfile
+	}
 
-	for progress := range progressChan {
-		data, err := json.Marshal(progress)
-		if err != nil {
-			continue
+	job, err := h.jobService.Enqueue(normalizedVideos, profileName, userID)
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.String(http.StatusBadRequest, "data: {\"type\": \"error\", \"message\": %q}\n\n", userErr.Message)
+			return
 		}
-		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
-		c.Writer.Flush()
+		c.String(http.StatusInternalServerError, "data: {\"type\": \"error\", \"message\": \"创建任务失败\"}\n\n")
+		return
 	}
 
-	go func() {
-		directories := []string{}
-		for _, videoPath := range request.Videos {
-			dirName := h.videoService.ExtractAnimeDirectory(videoPath)
-			if dirName != "" {
-				directories = append(directories, dirName)
-			}
-		}
+	streamJobEvents(c, h.jobService, job.ID)
+}
 
-		if len(directories) > 0 {
-			log.Println("开始异步增量同步本地动画到数据库...")
-			h.videoService.ScanAnimeDirectories(directories)
-			log.Println("异步增量同步本地动画到数据库完成！")
-		} else {
-			log.Println("批量处理完成，没有需要同步的动画目录")
-		}
-	}()
+func (h *VideoHandler) TranscodeProfiles(c *gin.Context) {
+	transcode := config.Get().Transcode
+	c.JSON(http.StatusOK, gin.H{
+		"profiles":       transcode.Profiles,
+		"defaultProfile": transcode.DefaultProfile,
+		"gpuProfile":     transcode.GPUProfile,
+	})
 }
 
 func (h *VideoHandler) StopBatchHLS(c *gin.Context) {
@@ -378,24 +448,23 @@ func (h *VideoHandler) StopBatchHLS(c *gin.Context) {
 		return
 	}
 
-	services.BatchProcessingMutex.Lock()
-	ctx, exists := services.BatchProcessingContexts[processID]
-	services.BatchProcessingMutex.Unlock()
-
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "处理不存在或已完成"})
+	id, err := strconv.ParseUint(processID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的处理ID"})
 		return
 	}
 
-	if stopChan, ok := ctx["stopChan"].(chan struct{}); ok {
-		close(stopChan)
+	result, err := h.jobService.Cancel(uint(id))
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "停止失败"})
+		return
 	}
 
-	services.BatchProcessingMutex.Lock()
-	delete(services.BatchProcessingContexts, processID)
-	services.BatchProcessingMutex.Unlock()
-
-	c.JSON(http.StatusOK, gin.H{"message": "处理已停止"})
+	c.JSON(http.StatusOK, gin.H{"result": result, "message": cancelMessage(result)})
 }
 
 func (h *VideoHandler) ScanVideos(c *gin.Context) {
@@ -420,9 +489,19 @@ func (h *VideoHandler) SearchAnimes(c *gin.Context) {
 		return
 	}
 
-	animes := h.videoService.SearchAnimes(keyword)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	filter := animeFilterFromQuery(c)
+
+	animes := []models.AnimeInfo{}
+	results := []services.SearchResult{}
+	for _, result := range services.SearchServiceInstance.Search(keyword, limit) {
+		if filter.Match(result.Anime) {
+			animes = append(animes, result.Anime)
+			results = append(results, result)
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"animes": animes})
+	c.JSON(http.StatusOK, gin.H{"animes": animes, "results": results})
 }
 
 func (h *VideoHandler) DeleteAnime(c *gin.Context) {
@@ -432,17 +511,71 @@ func (h *VideoHandler) DeleteAnime(c *gin.Context) {
 		return
 	}
 
-	err := h.videoService.DeleteAnime(folderName)
+	var userID uint
+	if user, ok := CurrentUser(c); ok {
+		userID = user.ID
+	}
+
+	batch, err := h.videoService.DeleteAnime(folderName, userID)
 	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": userErr.Message})
+			return
+		}
+		log.Printf("删除动画 %s 失败: %v\n", folderName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "batch": batch})
+}
+
+// ListTrash 列出回收站中的动画
+func (h *VideoHandler) ListTrash(c *gin.Context) {
+	batches, err := services.TrashServiceInstance.ListTrash()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回收站失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"trash": batches})
+}
+
+// RestoreAnime 从回收站恢复动画
+func (h *VideoHandler) RestoreAnime(c *gin.Context) {
+	batch := c.Query("batch")
+	if batch == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少回收站批次"})
+		return
+	}
+
+	anime, err := services.TrashServiceInstance.Restore(batch)
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": userErr.Message})
+			return
+		}
+		log.Printf("恢复动画失败: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "anime": anime})
 }
 
-func (h *VideoHandler) FixHLSVideos(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "HLS修复功能待实现"})
+// PurgeTrash 彻底删除回收站中的动画，不指定批次时清空回收站
+func (h *VideoHandler) PurgeTrash(c *gin.Context) {
+	purged, err := services.TrashServiceInstance.Purge(c.Query("batch"))
+	if err != nil {
+		if userErr, ok := err.(*services.UserError); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": userErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "purged": purged})
 }
 
 func (h *VideoHandler) LoginPage(c *gin.Context) {
@@ -459,15 +592,86 @@ func (h *VideoHandler) UpdatePage(c *gin.Context) {
 		animes = h.videoService.GetAnimesFromDB()
 	}
 
-	c.HTML(http.StatusOK, "update.html", gin.H{
+	data := gin.H{
 		"Animes": animes,
-	})
+	}
+	if animeID := c.Query("anime_id"); animeID != "" {
+		h.addEpisodeEditor(data, animes, animeID)
+	}
+
+	renderUpdatePage(c, data)
+}
+
+// renderUpdatePage 渲染更新页面，并加入元数据表单的选项
+func renderUpdatePage(c *gin.Context, data gin.H) {
+	data["Seasons"] = animeSeasons
+	data["Statuses"] = animeStatuses
+	c.HTML(http.StatusOK, "update.html", data)
+}
+
+// addEpisodeEditor 在更新页面中加入指定动画的剧集列表，用于手动调整集数
+func (h *VideoHandler) addEpisodeEditor(data gin.H, animes []models.AnimeInfo, animeID string) {
+	for _, anime := range animes {
+		if strconv.FormatUint(uint64(anime.ID), 10) == animeID {
+			data["EditAnime"] = anime
+			data["Episodes"] = h.videoService.GetAnimeEpisodes(anime)
+			data["EpisodeKinds"] = []string{utils.EpisodeKindRegular, utils.EpisodeKindSpecial, utils.EpisodeKindOVA, utils.EpisodeKindPV}
+			return
+		}
+	}
+}
+
+// UpdateEpisode 手动设置剧集的季数、集数和类型，reset 为 true 时恢复自动解析
+func (h *VideoHandler) UpdateEpisode(c *gin.Context) {
+	animeID := c.PostForm("anime_id")
+	var animes []models.AnimeInfo
+	if !services.LocalMode {
+		animes = h.videoService.GetAnimesFromDB()
+	}
+	data := gin.H{
+		"Animes": animes,
+	}
+
+	episodeID, err := strconv.ParseUint(c.PostForm("episode_id"), 10, 64)
+	if err != nil {
+		data["Message"] = "无效的剧集ID"
+		data["MessageType"] = "error"
+		h.addEpisodeEditor(data, animes, animeID)
+		renderUpdatePage(c, data)
+		return
+	}
+
+	if c.PostForm("reset") == "true" {
+		_, err = services.EpisodeServiceInstance.ResetEpisodeNumber(uint(episodeID))
+	} else {
+		season, seasonErr := strconv.Atoi(c.PostForm("season"))
+		number, numberErr := strconv.Atoi(c.PostForm("number"))
+		if seasonErr != nil || numberErr != nil {
+			err = &services.UserError{Message: "季数和集数必须是数字"}
+		} else {
+			_, err = services.EpisodeServiceInstance.SetEpisodeNumber(uint(episodeID), season, number, c.PostForm("kind"), strings.TrimSpace(c.PostForm("title")))
+		}
+	}
+
+	if err != nil {
+		data["Message"] = "更新剧集失败"
+		if userErr, ok := err.(*services.UserError); ok {
+			data["Message"] = userErr.Message
+		}
+		data["MessageType"] = "error"
+	} else {
+		data["Message"] = "剧集已更新"
+		data["MessageType"] = "success"
+	}
+
+	h.addEpisodeEditor(data, animes, animeID)
+	renderUpdatePage(c, data)
 }
 
 func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 	animeID := c.PostForm("anime_id")
 	if animeID == "" {
-		c.HTML(http.StatusOK, "update.html", gin.H{
+		renderUpdatePage(c, gin.H{
 			"Animes":      h.videoService.GetAnimesFromDB(),
 			"Message":     "请选择要更新的动画",
 			"MessageType": "error",
@@ -478,7 +682,7 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 	var anime models.AnimeInfo
 	result := services.DB.Where("id = ?", animeID).First(&anime)
 	if result.Error != nil {
-		c.HTML(http.StatusOK, "update.html", gin.H{
+		renderUpdatePage(c, gin.H{
 			"Animes":      h.videoService.GetAnimesFromDB(),
 			"Message":     "找不到指定的动画",
 			"MessageType": "error",
@@ -486,14 +690,21 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		return
 	}
 
-	title := c.PostForm("title")
-	if title != "" {
-		anime.Title = title
+	metadata, err := metadataFromForm(c)
+	if err == nil {
+		err = metadata.Validate()
 	}
-
-	summary := c.PostForm("summary")
-	if summary != "" {
-		anime.Summary = summary
+	if err != nil {
+		message := "动画信息无效"
+		if userErr, ok := err.(*services.UserError); ok {
+			message = userErr.Message
+		}
+		renderUpdatePage(c, gin.H{
+			"Animes":      h.videoService.GetAnimesFromDB(),
+			"Message":     message,
+			"MessageType": "error",
+		})
+		return
 	}
 
 	episodes := c.PostForm("episodes")
@@ -508,7 +719,7 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 	coverFile, err := c.FormFile("cover_file")
 	if err == nil {
 		if coverFile.Size > 10*1024*1024 {
-			c.HTML(http.StatusOK, "update.html", gin.H{
+			renderUpdatePage(c, gin.H{
 				"Animes":      h.videoService.GetAnimesFromDB(),
 				"Message":     "封面图片大小不能超过10MB",
 				"MessageType": "error",
@@ -519,7 +730,7 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		ext := filepath.Ext(coverFile.Filename)
 		allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
 		if !allowedExts[strings.ToLower(ext)] {
-			c.HTML(http.StatusOK, "update.html", gin.H{
+			renderUpdatePage(c, gin.H{
 				"Animes":      h.videoService.GetAnimesFromDB(),
 				"Message":     "不支持的图片格式，请使用JPG、PNG或WebP格式",
 				"MessageType": "error",
@@ -542,7 +753,7 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		}
 
 		if err := os.MkdirAll(filepath.Dir(coverPath), 0755); err != nil {
-			c.HTML(http.StatusOK, "update.html", gin.H{
+			renderUpdatePage(c, gin.H{
 				"Animes":      h.videoService.GetAnimesFromDB(),
 				"Message":     "创建封面目录失败",
 				"MessageType": "error",
@@ -551,7 +762,7 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		}
 
 		if err := c.SaveUploadedFile(coverFile, coverPath); err != nil {
-			c.HTML(http.StatusOK, "update.html", gin.H{
+			renderUpdatePage(c, gin.H{
 				"Animes":      h.videoService.GetAnimesFromDB(),
 				"Message":     "保存封面图片失败",
 				"MessageType": "error",
@@ -564,11 +775,15 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		} else {
 			anime.Cover = utils.NormalizeURLPath(strings.Join([]string{"/hls", anime.FolderName, coverFileName}, "/"))
 		}
+		anime.LockFields(models.AnimeFieldCover)
 	}
 
 	result = services.DB.Save(&anime)
-	if result.Error != nil {
-		c.HTML(http.StatusOK, "update.html", gin.H{
+	if result.Error == nil {
+		_, err = services.MetadataServiceInstance.UpdateMetadata(anime.ID, metadata)
+	}
+	if result.Error != nil || err != nil {
+		renderUpdatePage(c, gin.H{
 			"Animes":      h.videoService.GetAnimesFromDB(),
 			"Message":     "更新动画信息失败",
 			"MessageType": "error",
@@ -576,13 +791,59 @@ func (h *VideoHandler) UpdateAnime(c *gin.Context) {
 		return
 	}
 
-	c.HTML(http.StatusOK, "update.html", gin.H{
+	renderUpdatePage(c, gin.H{
 		"Animes":      h.videoService.GetAnimesFromDB(),
 		"Message":     "更新成功",
 		"MessageType": "success",
 	})
 }
 
+// metadataFromForm 读取更新页面的元数据字段，留空的字段保持不变
+func metadataFromForm(c *gin.Context) (services.AnimeMetadata, error) {
+	var metadata services.AnimeMetadata
+
+	for field, target := range map[string]**string{
+		"title":          &metadata.Title,
+		"summary":        &metadata.Summary,
+		"original_title": &metadata.OriginalTitle,
+		"season":         &metadata.Season,
+		"studio":         &metadata.Studio,
+		"status":         &metadata.Status,
+	} {
+		if value := strings.TrimSpace(c.PostForm(field)); value != "" {
+			*target = &value
+		}
+	}
+
+	for field, target := range map[string]**[]string{
+		"alt_titles": &metadata.AltTitles,
+		"tags":       &metadata.Tags,
+		"genres":     &metadata.Genres,
+	} {
+		if value := strings.TrimSpace(c.PostForm(field)); value != "" {
+			names := services.SplitNames(value)
+			*target = &names
+		}
+	}
+
+	if value := strings.TrimSpace(c.PostForm("year")); value != "" {
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			return metadata, &services.UserError{Message: "年份必须是数字"}
+		}
+		metadata.Year = &year
+	}
+	if value := strings.TrimSpace(c.PostForm("rating")); value != "" {
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return metadata, &services.UserError{Message: "评分必须是数字"}
+		}
+		metadata.Rating = &rating
+	}
+
+	return metadata, nil
+}
+
 func (h *VideoHandler) BatchUpdateAnime(c *gin.Context) {
 	go func() {
 		log.Println("开始批量更新动画信息...")
@@ -590,7 +851,7 @@ func (h *VideoHandler) BatchUpdateAnime(c *gin.Context) {
 		log.Printf("批量更新完成！扫描到 %d 个动画\n", len(animes))
 	}()
 
-	c.HTML(http.StatusOK, "update.html", gin.H{
+	renderUpdatePage(c, gin.H{
 		"Animes":      h.videoService.GetAnimesFromDB(),
 		"Message":     "批量更新已开始，请稍候...",
 		"MessageType": "success",
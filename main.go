@@ -1,12 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"anime-website/config"
 	"anime-website/handlers"
+	"anime-website/models"
 	"anime-website/services"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,9 @@ const (
 )
 
 func main() {
+	adminUser := flag.String("admin", "", "启动时将指定用户名提升为管理员")
+	flag.Parse()
+
 	logger, logFile := config.GetLogger()
 	defer func() {
 		if logFile != nil {
@@ -27,10 +32,47 @@ func main() {
 
 	config.Init()
 
+	if err := config.Get().Transcode.Validate(); err != nil {
+		logger.Fatalf("错误: 转码配置无效: %v\n", err)
+	}
+	if err := config.Get().Retention.Validate(); err != nil {
+		logger.Fatalf("错误: 源文件保留策略无效: %v\n", err)
+	}
+	if err := config.Get().Watcher.Validate(); err != nil {
+		logger.Fatalf("错误: 目录监听配置无效: %v\n", err)
+	}
+
 	services.InitDB()
 
+	services.SessionServiceInstance.Init()
+
+	cfg := config.Get()
+	for _, username := range []string{cfg.Auth.BootstrapAdmin, *adminUser} {
+		if username == "" {
+			continue
+		}
+		if err := services.UserServiceInstance.BootstrapAdmin(username); err != nil {
+			logger.Printf("警告: 设置管理员 %s 失败: %v\n", username, err)
+		}
+	}
+
 	services.StorageServiceInstance.Init()
 
+	services.JobServiceInstance.Start(cfg.Transcode.JobWorkers)
+
+	services.StorageServiceInstance.Start()
+
+	services.RetentionServiceInstance.Start()
+
+	services.WatcherServiceInstance.Start()
+
+	services.ReconcileServiceInstance.Start()
+
+	// 本地模式在第一次搜索时随扫描建立索引
+	if !services.LocalMode {
+		go services.SearchServiceInstance.Rebuild()
+	}
+
 	if _, err := os.Stat(hlsDir); os.IsNotExist(err) {
 		logger.Printf("创建HLS目录: %s\n", hlsDir)
 		err = os.MkdirAll(hlsDir, 0755)
@@ -39,7 +81,6 @@ func main() {
 		}
 	}
 
-	cfg := config.Get()
 	if cfg.Log.Level == "debug" {
 		gin.SetMode(gin.DebugMode)
 	} else {
@@ -56,16 +97,32 @@ func main() {
 	authHandler := handlers.NewAuthHandler()
 	playHistoryHandler := handlers.NewPlayHistoryHandler(authHandler)
 	videoHandler := handlers.NewVideoHandler()
+	jobHandler := handlers.NewJobHandler()
+	retentionHandler := handlers.NewRetentionHandler()
+	hlsHandler := handlers.NewHLSHandler()
+	catalogHandler := handlers.NewCatalogHandler()
+	metadataHandler := handlers.NewMetadataHandler()
+	animeHandler := handlers.NewAnimeHandler(authHandler)
+	storageHandler := handlers.NewStorageHandler()
 
 	r.GET("/", videoHandler.Index)
 	r.GET("/search", videoHandler.Search)
 	r.GET("/play", videoHandler.Play)
+	r.GET("/anime/:id", animeHandler.Detail)
 	r.GET("/history", videoHandler.History)
 	r.GET("/hls", videoHandler.HLS)
 	r.GET("/api/videos", videoHandler.VideoList)
-	r.POST("/api/scan-videos", videoHandler.ScanVideos)
-	r.POST("/api/batch-hls", videoHandler.BatchHLS)
-	r.POST("/api/batch-hls/stop", videoHandler.StopBatchHLS)
+	r.POST("/api/scan-videos", authHandler.RequireRole(handlers.ScanVideosRole), videoHandler.ScanVideos)
+	r.POST("/api/batch-hls", authHandler.RequireRole(handlers.BatchHLSRole), videoHandler.BatchHLS)
+	r.POST("/api/batch-hls/stop", authHandler.RequireRole(handlers.BatchHLSRole), videoHandler.StopBatchHLS)
+	r.GET("/api/transcode/profiles", authHandler.RequireRole(handlers.BatchHLSRole), videoHandler.TranscodeProfiles)
+
+	r.GET("/api/jobs", authHandler.RequireRole(handlers.BatchHLSRole), jobHandler.ListJobs)
+	r.GET("/api/jobs/:id", authHandler.RequireRole(handlers.BatchHLSRole), jobHandler.GetJob)
+	r.GET("/api/jobs/:id/events", authHandler.RequireRole(handlers.BatchHLSRole), jobHandler.JobEvents)
+	r.POST("/api/jobs/:id/cancel", authHandler.RequireRole(handlers.BatchHLSRole), jobHandler.CancelJob)
+	r.POST("/api/jobs/:id/retry", authHandler.RequireRole(handlers.BatchHLSRole), jobHandler.RetryJob)
+	r.GET("/api/retention/audits", authHandler.RequireRole(handlers.RetentionAuditRole), retentionHandler.ListAudits)
 
 	r.POST("/api/play-history/save", playHistoryHandler.SavePlayHistory)
 	r.GET("/api/play-history/get", playHistoryHandler.GetPlayHistory)
@@ -78,23 +135,50 @@ func main() {
 	r.GET("/api/auth/user", authHandler.GetCurrentUser)
 	r.POST("/api/auth/logout", authHandler.Logout)
 	r.POST("/api/auth/renew", authHandler.RenewCookie)
+	r.GET("/api/auth/sessions", authHandler.ListSessions)
+	r.DELETE("/api/auth/sessions", authHandler.RevokeOtherSessions)
+	r.DELETE("/api/auth/sessions/:id", authHandler.RevokeSession)
+	r.PUT("/api/admin/users/:id/role", authHandler.RequireRole(models.RoleAdmin), authHandler.SetUserRole)
 
+	r.GET("/api/animes", catalogHandler.ListAnimes)
 	r.GET("/api/animes/search", videoHandler.SearchAnimes)
-	r.DELETE("/api/animes/delete", videoHandler.DeleteAnime)
-	r.POST("/api/hls/fix", videoHandler.FixHLSVideos)
-	r.GET("/api/hls/fix", videoHandler.FixHLSVideos)
+	r.DELETE("/api/animes/delete", authHandler.RequireRole(handlers.DeleteAnimeRole), videoHandler.DeleteAnime)
+	r.GET("/api/animes/trash", authHandler.RequireRole(handlers.DeleteAnimeRole), videoHandler.ListTrash)
+	r.POST("/api/animes/restore", authHandler.RequireRole(handlers.DeleteAnimeRole), videoHandler.RestoreAnime)
+	r.DELETE("/api/animes/trash", authHandler.RequireRole(handlers.DeleteAnimeRole), videoHandler.PurgeTrash)
+	r.GET("/api/animes/:id", animeHandler.GetAnime)
+	r.GET("/api/animes/:id/metadata", metadataHandler.GetMetadata)
+	r.PUT("/api/animes/:id/metadata", authHandler.RequireRole(handlers.UpdateAnimeRole), metadataHandler.UpdateMetadata)
+	r.GET("/api/tags", metadataHandler.ListTags)
+	r.GET("/api/catalog/orphans", authHandler.RequireRole(handlers.CatalogAdminRole), catalogHandler.Orphans)
+	r.POST("/api/catalog/reconcile", authHandler.RequireRole(handlers.CatalogAdminRole), catalogHandler.Reconcile)
+	r.GET("/api/storage/placements", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.ListPlacements)
+	r.PUT("/api/storage/placements", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.PinPlacement)
+	r.DELETE("/api/storage/placements", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.UnpinPlacement)
+	r.POST("/api/storage/migrate", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.Migrate)
+	r.GET("/api/storage/disks", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.ListDisks)
+	r.POST("/api/storage/disks", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.AddDisk)
+	r.POST("/api/storage/disks/:name/enable", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.EnableDisk)
+	r.POST("/api/storage/disks/:name/disable", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.DisableDisk)
+	r.POST("/api/storage/disks/:name/drain", authHandler.RequireRole(handlers.StorageAdminRole), storageHandler.DrainDisk)
+	r.GET("/api/hls/health", authHandler.RequireRole(handlers.HLSHealthRole), hlsHandler.Health)
+	r.POST("/api/hls/verify", authHandler.RequireRole(handlers.HLSHealthRole), hlsHandler.Verify)
+	r.POST("/api/hls/fix", authHandler.RequireRole(handlers.FixHLSVideosRole), hlsHandler.Repair)
+	r.GET("/api/hls/fix", authHandler.RequireRole(handlers.FixHLSVideosRole), hlsHandler.Repair)
 	r.GET("/hls-fix", videoHandler.HLSFix)
 	r.GET("/login", videoHandler.LoginPage)
 	r.GET("/register", videoHandler.RegisterPage)
-	r.GET("/update", videoHandler.UpdatePage)
-	r.POST("/update", videoHandler.UpdateAnime)
-	r.POST("/update/batch", videoHandler.BatchUpdateAnime)
-
-	disks := cfg.Storage.Disks
-	for _, disk := range disks {
+	r.GET("/update", authHandler.RequireRole(handlers.UpdateAnimeRole), videoHandler.UpdatePage)
+	r.POST("/update", authHandler.RequireRole(handlers.UpdateAnimeRole), videoHandler.UpdateAnime)
+	r.POST("/update/episode", authHandler.RequireRole(handlers.UpdateAnimeRole), videoHandler.UpdateEpisode)
+	r.POST("/update/batch", authHandler.RequireRole(handlers.UpdateAnimeRole), videoHandler.BatchUpdateAnime)
+
+	// 存储路由按运行时的磁盘列表分发，磁盘增删或启用停用后立即生效
+	r.GET("/storage/:disk/*filepath", storageHandler.ServeFile)
+	r.HEAD("/storage/:disk/*filepath", storageHandler.ServeFile)
+	for _, disk := range services.StorageServiceInstance.GetAllDisks() {
 		if disk.Enabled {
-			r.Static("/storage/"+disk.Name, disk.Path)
-			logger.Printf("添加存储路由: /storage/%s -> %s\n", disk.Name, disk.Path)
+			logger.Printf("存储路由: /storage/%s -> %s\n", disk.Name, disk.Path)
 		}
 	}
 
@@ -1,24 +1,66 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+const (
+	RoleViewer   = "viewer"
+	RoleUploader = "uploader"
+	RoleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleUploader: 2,
+	RoleAdmin:    3,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
 type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Username  string    `gorm:"size:100;uniqueIndex" json:"username"`
 	Email     string    `gorm:"size:100;uniqueIndex" json:"email"`
 	Password  string    `gorm:"size:100" json:"-"`
+	Role      string    `gorm:"size:20;default:viewer" json:"role"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// HasRole 判断用户角色是否不低于指定角色
+func (u *User) HasRole(role string) bool {
+	current, ok := roleLevels[u.Role]
+	if !ok {
+		current = roleLevels[RoleViewer]
+	}
+	return current >= roleLevels[role]
+}
+
+type Session struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Token      string    `gorm:"size:64;uniqueIndex" json:"-"`
+	UserID     uint      `gorm:"index" json:"userId"`
+	UserAgent  string    `gorm:"size:255" json:"userAgent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	ExpiresAt  time.Time `gorm:"index" json:"expiresAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
 type PlayHistory struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
 	UserID        uint      `gorm:"index" json:"userId"`
 	VideoID       string    `gorm:"size:255;index" json:"videoId"`
+	EpisodeID     uint      `gorm:"index" json:"episodeId"`
+	AnimeID       uint      `gorm:"index" json:"animeId"`
 	AnimeTitle    string    `gorm:"size:255" json:"animeTitle"`
 	Episode       string    `gorm:"size:255" json:"episode"`
 	VideoURL      string    `gorm:"size:500" json:"videoUrl"`
@@ -34,23 +76,278 @@ type PlayHistory struct {
 }
 
 type AnimeInfo struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	Title        string         `gorm:"size:255" json:"title"`
+	Summary      string         `gorm:"size:1000" json:"summary"`
+	Cover        string         `gorm:"size:255" json:"cover"`
+	VideoURL     string         `gorm:"size:255" json:"video_url"`
+	Episodes     int            `json:"episodes"`
+	FolderName   string         `gorm:"size:255" json:"folder_name"`
+	PhysicalPath string         `gorm:"size:500" json:"physical_path"`
+	StorageDisk  string         `gorm:"size:100" json:"storage_disk"`
+	MissingSince *time.Time     `gorm:"index" json:"missing_since"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+
+	// 以下为手动编辑的元数据，扫描时不会覆盖
+	OriginalTitle string  `gorm:"size:255" json:"original_title"`
+	AltTitles     string  `gorm:"size:1000" json:"alt_titles"` // 多个别名用换行分隔
+	Year          int     `gorm:"index" json:"year"`
+	Season        string  `gorm:"size:20" json:"season"`
+	Studio        string  `gorm:"size:255;index" json:"studio"`
+	Status        string  `gorm:"size:20;index" json:"status"`
+	Rating        float64 `json:"rating"`
+	Fanart        string  `gorm:"size:500" json:"fanart"`
+	Tags          []Tag   `gorm:"many2many:anime_tags;" json:"tags"`
+	LockedFields  string  `gorm:"size:500" json:"locked_fields"`
+}
+
+// 可以手动编辑的动画字段，记录在 LockedFields 中
+const (
+	AnimeFieldTitle         = "title"
+	AnimeFieldSummary       = "summary"
+	AnimeFieldCover         = "cover"
+	AnimeFieldOriginalTitle = "original_title"
+	AnimeFieldAltTitles     = "alt_titles"
+	AnimeFieldYear          = "year"
+	AnimeFieldSeason        = "season"
+	AnimeFieldStudio        = "studio"
+	AnimeFieldStatus        = "status"
+	AnimeFieldRating        = "rating"
+	AnimeFieldFanart        = "fanart"
+	AnimeFieldTags          = "tags"
+	AnimeFieldGenres        = "genres"
+)
+
+// FieldLocked 判断字段是否手动编辑过，手动编辑过的字段扫描和导入元数据时不会覆盖
+func (a AnimeInfo) FieldLocked(field string) bool {
+	for _, locked := range strings.Split(a.LockedFields, ",") {
+		if locked == field {
+			return true
+		}
+	}
+	return false
+}
+
+// LockFields 记录手动编辑过的字段
+func (a *AnimeInfo) LockFields(fields ...string) {
+	for _, field := range fields {
+		if a.FieldLocked(field) {
+			continue
+		}
+		if a.LockedFields == "" {
+			a.LockedFields = field
+		} else {
+			a.LockedFields += "," + field
+		}
+	}
+}
+
+// AltTitleList 返回动画的所有别名
+func (a AnimeInfo) AltTitleList() []string {
+	var titles []string
+	for _, title := range strings.Split(a.AltTitles, "\n") {
+		if title = strings.TrimSpace(title); title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+// 放送季度
+const (
+	AnimeSeasonWinter = "winter"
+	AnimeSeasonSpring = "spring"
+	AnimeSeasonSummer = "summer"
+	AnimeSeasonFall   = "fall"
+)
+
+// 放送状态
+const (
+	AnimeStatusUpcoming = "upcoming"
+	AnimeStatusAiring   = "airing"
+	AnimeStatusFinished = "finished"
+)
+
+const (
+	TagKindTag   = "tag"
+	TagKindGenre = "genre"
+)
+
+// Tag 是动画的标签或类型，Kind 区分两者，同名的标签和类型是不同的记录
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;uniqueIndex:idx_tag_kind_name" json:"name"`
+	Kind      string    `gorm:"size:20;default:tag;uniqueIndex:idx_tag_kind_name" json:"kind"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Episode 是扫描器写入的单集记录，Name 是剧集目录名。NumberLocked 表示季数、集数由管理员手动指定，重新扫描时不覆盖
+type Episode struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
+	AnimeID      uint      `gorm:"uniqueIndex:idx_episode_anime_name" json:"animeId"`
+	AnimeFolder  string    `gorm:"size:255;index" json:"animeFolder"`
+	Name         string    `gorm:"size:255;uniqueIndex:idx_episode_anime_name" json:"name"`
+	Season       int       `json:"season"`
+	Number       int       `json:"number"`
+	Kind         string    `gorm:"size:20;default:episode" json:"kind"`
+	NumberLocked bool      `json:"numberLocked"`
 	Title        string    `gorm:"size:255" json:"title"`
-	Summary      string    `gorm:"size:1000" json:"summary"`
-	Cover        string    `gorm:"size:255" json:"cover"`
-	VideoURL     string    `gorm:"size:255" json:"video_url"`
-	Episodes     int       `json:"episodes"`
-	FolderName   string    `gorm:"size:255" json:"folder_name"`
-	PhysicalPath string    `gorm:"size:500" json:"physical_path"`
-	StorageDisk  string    `gorm:"size:100" json:"storage_disk"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	PlaylistURL  string    `gorm:"size:500;index" json:"playlistUrl"`
+	PhysicalPath string    `gorm:"size:1000" json:"physicalPath"`
+	StorageDisk  string    `gorm:"size:100" json:"storageDisk"`
+	Duration     float64   `json:"duration"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	VideoCodec   string    `gorm:"size:50" json:"videoCodec"`
+	AudioCodec   string    `gorm:"size:50" json:"audioCodec"`
+	FileSize     int64     `json:"fileSize"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+const (
+	JobTypeTranscode = "transcode"
+	JobTypeRepair    = "repair"
+	JobTypeMigrate   = "migrate"
+)
+
+// TranscodeJob 的 Videos 对转码任务是视频路径，对修复任务是 动画/剧集，对迁移任务是动画目录名。
+// Target 是迁移的目标磁盘，为空时按分配策略为每部动画选择
+type TranscodeJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Type       string     `gorm:"size:20;default:transcode;index" json:"type"`
+	Status     string     `gorm:"size:20;index" json:"status"`
+	Videos     string     `gorm:"type:text" json:"-"`
+	Profile    string     `gorm:"size:50" json:"profile"`
+	Target     string     `gorm:"size:100" json:"target"`
+	Total      int        `json:"total"`
+	Success    int        `json:"success"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Errors     string     `gorm:"type:text" json:"-"`
+	Message    string     `gorm:"size:500" json:"message"`
+	CreatedBy  uint       `gorm:"index" json:"createdBy"`
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (j *TranscodeJob) VideoList() []string {
+	var videos []string
+	json.Unmarshal([]byte(j.Videos), &videos)
+	return videos
+}
+
+func (j *TranscodeJob) ErrorList() []string {
+	var errors []string
+	json.Unmarshal([]byte(j.Errors), &errors)
+	return errors
+}
+
+func (j *TranscodeJob) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+const (
+	RetentionActionDelete  = "delete"
+	RetentionActionArchive = "archive"
+)
+
+const (
+	RetentionStatusPending = "pending"
+	RetentionStatusDone    = "done"
+	RetentionStatusFailed  = "failed"
+)
+
+// SourceFileAudit 记录源文件的删除或归档操作
+type SourceFileAudit struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SourcePath     string     `gorm:"size:1000" json:"sourcePath"`
+	HLSPath        string     `gorm:"size:1000" json:"hlsPath"`
+	Policy         string     `gorm:"size:30" json:"policy"`
+	Action         string     `gorm:"size:20;index" json:"action"`
+	Status         string     `gorm:"size:20;index" json:"status"`
+	SourceDuration float64    `json:"sourceDuration"`
+	HLSDuration    float64    `json:"hlsDuration"`
+	ArchivePath    string     `gorm:"size:1000" json:"archivePath"`
+	Message        string     `gorm:"size:500" json:"message"`
+	DueAt          *time.Time `gorm:"index" json:"dueAt"`
+	ExecutedAt     *time.Time `json:"executedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// HLSHealth 是单集HLS切片的最近一次校验结果
+type HLSHealth struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	AnimeFolder      string    `gorm:"size:255;uniqueIndex:idx_hls_health_episode" json:"animeFolder"`
+	Episode          string    `gorm:"size:255;uniqueIndex:idx_hls_health_episode" json:"episode"`
+	StorageDisk      string    `gorm:"size:100" json:"storageDisk"`
+	EpisodePath      string    `gorm:"size:1000" json:"episodePath"`
+	Healthy          bool      `gorm:"index" json:"healthy"`
+	Problems         string    `gorm:"type:text" json:"-"`
+	SegmentCount     int       `json:"segmentCount"`
+	MissingSegments  int       `json:"missingSegments"`
+	EmptySegments    int       `json:"emptySegments"`
+	PlaylistDuration float64   `json:"playlistDuration"`
+	ProbedDuration   float64   `json:"probedDuration"`
+	HasEndList       bool      `json:"hasEndList"`
+	CheckedAt        time.Time `gorm:"index" json:"checkedAt"`
+}
+
+func (h *HLSHealth) ProblemList() []string {
+	var problems []string
+	json.Unmarshal([]byte(h.Problems), &problems)
+	return problems
+}
+
+const (
+	TrashKindHLS    = "hls"
+	TrashKindSource = "source"
+)
+
+// TrashItem 记录被移入回收站的目录，同一次删除的目录共用一个 Batch
+type TrashItem struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Batch        string    `gorm:"size:255;index" json:"batch"`
+	AnimeID      uint      `gorm:"index" json:"animeId"`
+	FolderName   string    `gorm:"size:255" json:"folderName"`
+	Title        string    `gorm:"size:255" json:"title"`
+	Kind         string    `gorm:"size:20" json:"kind"`
+	StorageDisk  string    `gorm:"size:100" json:"storageDisk"`
+	OriginalPath string    `gorm:"size:1000" json:"originalPath"`
+	TrashPath    string    `gorm:"size:1000" json:"trashPath"`
+	DeletedBy    uint      `json:"deletedBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// AnimePlacement 记录动画的HLS切片存放在哪个磁盘，第一次分配后该动画的所有剧集都写到这里。
+// Pinned 表示由管理员指定，磁盘不可用时不会自动改到别的磁盘
+type AnimePlacement struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	FolderName string    `gorm:"size:255;uniqueIndex" json:"folderName"`
+	DiskName   string    `gorm:"size:100" json:"diskName"`
+	Pinned     bool      `json:"pinned"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
 type VideoFile struct {
 	Path         string `json:"path"`
 	FileName     string `json:"file_name"`
 	PhysicalPath string `json:"physical_path"`
+	Title        string `json:"title,omitempty"`
 }
 
 type BatchResult struct {
@@ -61,5 +358,5 @@ type BatchResult struct {
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&User{}, &AnimeInfo{}, &PlayHistory{})
+	return db.AutoMigrate(&User{}, &Session{}, &Tag{}, &AnimeInfo{}, &Episode{}, &PlayHistory{}, &TranscodeJob{}, &SourceFileAudit{}, &HLSHealth{}, &TrashItem{}, &AnimePlacement{})
 }
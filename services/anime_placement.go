@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"anime-website/models"
+)
+
+// placementDisk 返回动画应写入的磁盘。已有分配记录时一直使用记录中的磁盘，保证同一部动画不会被拆到多个磁盘；
+// estimateBytes 大于 0 时检查该磁盘是否还放得下。调用方需持有锁
+func (s *StorageService) placementDisk(animeName string, estimateBytes int64) (*Disk, error) {
+	if len(s.disks) == 0 {
+		return nil, nil
+	}
+
+	if placement, found := s.loadPlacement(animeName); found {
+		disk := s.diskByName(placement.DiskName)
+		if disk != nil && disk.Enabled {
+			if estimateBytes > 0 && !disk.fits(estimateBytes) {
+				return nil, fmt.Errorf("动画 %s 所在的磁盘 %s 空间不足，需要 %.2fGB", animeName, disk.Name, float64(estimateBytes)/bytesPerGB)
+			}
+			return disk, nil
+		}
+		if placement.Pinned {
+			return nil, fmt.Errorf("动画 %s 固定的磁盘 %s 不可用", animeName, placement.DiskName)
+		}
+		log.Printf("警告: 动画 %s 分配的磁盘 %s 已不可用，重新分配\n", animeName, placement.DiskName)
+	}
+
+	// 还没有记录时，已经存有该动画目录的磁盘优先，兼容分配记录出现之前生成的切片
+	disk := s.findAnimeData(animeName)
+	if disk == nil {
+		disk = s.selectDisk(animeName, estimateBytes)
+	}
+	if disk == nil {
+		return nil, fmt.Errorf("没有足够空间的存储磁盘，需要 %.2fGB", float64(estimateBytes)/bytesPerGB)
+	}
+	if err := s.savePlacement(models.AnimePlacement{FolderName: animeName, DiskName: disk.Name}); err != nil {
+		return nil, err
+	}
+	return disk, nil
+}
+
+// lookupDisk 返回动画当前所在的磁盘：优先使用分配记录，其次是已经存有该动画目录的磁盘，都没有时返回 nil。
+// 只用于查询，不会新建分配记录。调用方需持有锁
+func (s *StorageService) lookupDisk(animeName string) *Disk {
+	if placement, found := s.loadPlacement(animeName); found {
+		if disk := s.diskByName(placement.DiskName); disk != nil && disk.Enabled {
+			return disk
+		}
+	}
+	return s.findAnimeData(animeName)
+}
+
+// ListPlacements 列出所有动画的磁盘分配记录
+func (s *StorageService) ListPlacements() ([]models.AnimePlacement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	placements := []models.AnimePlacement{}
+	if !LocalMode && DB != nil {
+		if result := DB.Order("folder_name ASC").Find(&placements); result.Error != nil {
+			log.Printf("错误: 获取磁盘分配记录失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return placements, nil
+	}
+
+	for _, placement := range s.placements {
+		placements = append(placements, placement)
+	}
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].FolderName < placements[j].FolderName
+	})
+	return placements, nil
+}
+
+// PinPlacement 把动画固定到指定磁盘。动画已有切片在别的磁盘上时需要先迁移
+func (s *StorageService) PinPlacement(animeName string, diskName string) (*models.AnimePlacement, error) {
+	if animeName == "" {
+		return nil, &UserError{Message: "动画目录名不能为空"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	disk := s.diskByName(diskName)
+	if disk == nil {
+		return nil, &UserError{Message: "磁盘不存在: " + diskName}
+	}
+	if !disk.Enabled {
+		return nil, &UserError{Message: "磁盘未启用: " + diskName}
+	}
+	if current := s.findAnimeData(animeName); current != nil && current != disk {
+		return nil, &UserError{Message: fmt.Sprintf("动画 %s 的切片在磁盘 %s 上，请先迁移到 %s", animeName, current.Name, disk.Name)}
+	}
+
+	placement := models.AnimePlacement{FolderName: animeName, DiskName: disk.Name, Pinned: true}
+	if err := s.savePlacement(placement); err != nil {
+		return nil, err
+	}
+	placement, _ = s.loadPlacement(animeName)
+	log.Printf("存储服务: 动画 %s 固定到磁盘 %s\n", animeName, disk.Name)
+	return &placement, nil
+}
+
+// UnpinPlacement 取消固定，动画仍留在原来的磁盘上
+func (s *StorageService) UnpinPlacement(animeName string) (*models.AnimePlacement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	placement, found := s.loadPlacement(animeName)
+	if !found {
+		return nil, &UserError{Message: "动画没有磁盘分配记录: " + animeName}
+	}
+	placement.Pinned = false
+	if err := s.savePlacement(placement); err != nil {
+		return nil, err
+	}
+	return &placement, nil
+}
+
+// ForgetPlacement 删除动画的分配记录，动画被彻底删除后调用
+func (s *StorageService) ForgetPlacement(animeName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.placements, animeName)
+	if !LocalMode && DB != nil {
+		if result := DB.Where("folder_name = ?", animeName).Delete(&models.AnimePlacement{}); result.Error != nil {
+			log.Printf("错误: 删除动画 %s 的磁盘分配记录失败: %v\n", animeName, result.Error)
+		}
+	}
+}
+
+// loadPlacement 先查缓存，再查数据库
+func (s *StorageService) loadPlacement(animeName string) (models.AnimePlacement, bool) {
+	if placement, found := s.placements[animeName]; found {
+		return placement, true
+	}
+	if LocalMode || DB == nil {
+		return models.AnimePlacement{}, false
+	}
+
+	var placement models.AnimePlacement
+	if result := DB.Where("folder_name = ?", animeName).First(&placement); result.Error != nil {
+		return placement, false
+	}
+	s.cachePlacement(placement)
+	return placement, true
+}
+
+// savePlacement 按目录名新建或更新分配记录
+func (s *StorageService) savePlacement(placement models.AnimePlacement) error {
+	placement.UpdatedAt = time.Now()
+	if existing, found := s.loadPlacement(placement.FolderName); found {
+		placement.ID = existing.ID
+		placement.CreatedAt = existing.CreatedAt
+	} else {
+		placement.CreatedAt = time.Now()
+	}
+
+	if !LocalMode && DB != nil {
+		if result := DB.Save(&placement); result.Error != nil {
+			log.Printf("错误: 保存动画 %s 的磁盘分配记录失败: %v\n", placement.FolderName, result.Error)
+			return result.Error
+		}
+	}
+	s.cachePlacement(placement)
+	return nil
+}
+
+func (s *StorageService) cachePlacement(placement models.AnimePlacement) {
+	if s.placements == nil {
+		s.placements = make(map[string]models.AnimePlacement)
+	}
+	s.placements[placement.FolderName] = placement
+}
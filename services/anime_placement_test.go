@@ -0,0 +1,51 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHLSLookupDoesNotAllocate(t *testing.T) {
+	setMinFreeGB(t, 0)
+	// small 的已用空间最少，按 0 字节估算时会被选中，但放不下真正的转码
+	disks := newFakeDisks(t, []fakeDisk{{name: "small", totalGB: 10, freeGB: 9}, {name: "large", totalGB: 1000, freeGB: 500}})
+	s := &StorageService{disks: disks, placement: leastUsedStrategy{}}
+
+	if got, want := s.GetHLSURL("Anime"), "/hls/Anime"; got != want {
+		t.Fatalf("GetHLSURL = %s, want %s", got, want)
+	}
+	if got, want := s.GetHLSPath("Anime"), filepath.Join("static/hls", "Anime"); got != want {
+		t.Fatalf("GetHLSPath = %s, want %s", got, want)
+	}
+	if _, found := s.loadPlacement("Anime"); found {
+		t.Fatalf("查询地址时不应新建分配记录")
+	}
+
+	reservation, err := s.Reserve("Anime", 20*bytesPerGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reservation.Release()
+	if reservation.Disk != disks[1] {
+		t.Fatalf("Reserve 选择了 %s, want large", reservation.Disk.Name)
+	}
+	if got, want := s.GetHLSURL("Anime"), "/storage/large/Anime"; got != want {
+		t.Fatalf("分配后 GetHLSURL = %s, want %s", got, want)
+	}
+}
+
+func TestHLSLookupFindsExistingDirectory(t *testing.T) {
+	disks := newFakeDisks(t, []fakeDisk{{name: "a", totalGB: 100, freeGB: 90}, {name: "b", totalGB: 100, freeGB: 10}})
+	if err := os.MkdirAll(filepath.Join(disks[1].Path, "Anime"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := &StorageService{disks: disks, placement: leastUsedStrategy{}}
+
+	if got, want := s.GetHLSPath("Anime"), filepath.Join(disks[1].Path, "Anime"); got != want {
+		t.Fatalf("GetHLSPath = %s, want %s", got, want)
+	}
+	if _, found := s.loadPlacement("Anime"); found {
+		t.Fatalf("查询地址时不应新建分配记录")
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"anime-website/models"
+	"anime-website/utils"
+)
+
+// 动画列表的排序方式
+const (
+	CatalogSortTitle      = "title"
+	CatalogSortAdded      = "added"
+	CatalogSortUpdated    = "updated"
+	CatalogSortEpisodes   = "episodes"
+	CatalogSortPopularity = "popularity"
+)
+
+const (
+	DefaultCatalogLimit = 20
+	MaxCatalogLimit     = 100
+	// CatalogDefaultDisk 用于筛选存放在默认HLS目录、不属于任何存储磁盘的动画
+	CatalogDefaultDisk = "hls"
+	defaultCoverURL    = "/static/css/default-cover.jpg"
+)
+
+// 剧集的观看状态，根据用户的播放记录得出
+const (
+	WatchStateUnwatched  = "unwatched"
+	WatchStateInProgress = "in_progress"
+	WatchStateWatched    = "watched"
+)
+
+// 播放进度达到这个百分比就算看完，片尾通常会被跳过
+const watchedProgress = 90.0
+
+// 各排序方式默认的方向，标题按字母顺序，其余从大到小
+var catalogSortDesc = map[string]bool{
+	CatalogSortTitle:      false,
+	CatalogSortAdded:      true,
+	CatalogSortUpdated:    true,
+	CatalogSortEpisodes:   true,
+	CatalogSortPopularity: true,
+}
+
+type CatalogService struct{}
+
+var CatalogServiceInstance = &CatalogService{}
+
+// CatalogQuery 是动画列表的查询条件，Limit 为 0 时返回从 Offset 开始的全部动画
+type CatalogQuery struct {
+	Filter   AnimeFilter
+	Disk     string
+	HasCover *bool
+	Sort     string
+	Order    string
+	Cursor   string
+	Offset   int
+	Limit    int
+}
+
+// CatalogPage 是一页动画列表。NextCursor 为空表示没有下一页
+type CatalogPage struct {
+	Items      []models.AnimeInfo `json:"items"`
+	Total      int                `json:"total"`
+	Offset     int                `json:"offset"`
+	Limit      int                `json:"limit"`
+	HasMore    bool               `json:"hasMore"`
+	NextCursor string             `json:"nextCursor"`
+	Sort       string             `json:"sort"`
+	Order      string             `json:"order"`
+}
+
+// EpisodeWatch 是带有观看状态的剧集，未登录时所有剧集都是未观看
+type EpisodeWatch struct {
+	models.Episode
+	WatchState  string     `json:"watchState"`
+	Progress    float64    `json:"progress"`
+	CurrentTime float64    `json:"currentTime"`
+	LastPlayed  *time.Time `json:"lastPlayed"`
+}
+
+// AnimeDetail 是动画详情页的数据。ContinueWatching 指向下一集没看完的剧集，全部看完时为 nil
+type AnimeDetail struct {
+	Anime            models.AnimeInfo `json:"anime"`
+	Episodes         []EpisodeWatch   `json:"episodes"`
+	ContinueWatching *EpisodeWatch    `json:"continueWatching"`
+}
+
+// ListAnimes 按条件筛选、排序并分页返回动画。Cursor 不为空时代替 Offset
+func (s *CatalogService) ListAnimes(query CatalogQuery) (*CatalogPage, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	var animes []models.AnimeInfo
+	if !LocalMode {
+		animes = VideoServiceInstance.GetAnimesFromDB()
+	}
+	if len(animes) == 0 {
+		animes = VideoServiceInstance.ScanVideos()
+	}
+
+	var filtered []models.AnimeInfo
+	for _, anime := range animes {
+		if query.match(anime) {
+			filtered = append(filtered, anime)
+		}
+	}
+	s.sortAnimes(filtered, query.Sort, query.Order == "desc")
+
+	page := &CatalogPage{
+		Items:  []models.AnimeInfo{},
+		Total:  len(filtered),
+		Offset: query.Offset,
+		Limit:  query.Limit,
+		Sort:   query.Sort,
+		Order:  query.Order,
+	}
+	if query.Offset >= len(filtered) {
+		return page, nil
+	}
+	end := len(filtered)
+	if query.Limit > 0 && query.Offset+query.Limit < end {
+		end = query.Offset + query.Limit
+	}
+	page.Items = filtered[query.Offset:end]
+	if end < len(filtered) {
+		page.HasMore = true
+		page.NextCursor = encodeCatalogCursor(query.Sort, query.Order, end)
+	}
+	return page, nil
+}
+
+// GetAnime 按ID获取未缺失的动画及其标签
+func (s *CatalogService) GetAnime(id uint) (*models.AnimeInfo, error) {
+	if LocalMode || DB == nil {
+		return nil, &UserError{Message: "本地模式不支持按ID查看动画"}
+	}
+
+	var anime models.AnimeInfo
+	if result := DB.Preload("Tags").Where("missing_since IS NULL").First(&anime, id); result.Error != nil {
+		return nil, &UserError{Message: "找不到指定的动画"}
+	}
+	return &anime, nil
+}
+
+// GetAnimeDetail 返回动画信息和剧集列表。userID 不为 0 时根据该用户的播放记录标出每集的观看状态
+func (s *CatalogService) GetAnimeDetail(id uint, userID uint) (*AnimeDetail, error) {
+	anime, err := s.GetAnime(id)
+	if err != nil {
+		return nil, err
+	}
+
+	episodes := VideoServiceInstance.GetAnimeEpisodes(*anime)
+	anime.Episodes = len(episodes)
+	detail := &AnimeDetail{Anime: *anime, Episodes: make([]EpisodeWatch, len(episodes))}
+	playlistURLs := make([]string, len(episodes))
+	for i, episode := range episodes {
+		detail.Episodes[i] = EpisodeWatch{Episode: episode, WatchState: WatchStateUnwatched}
+		playlistURLs[i] = episode.PlaylistURL
+	}
+
+	// 最近播放的剧集，从它开始找下一集
+	lastPlayed := -1
+	if userID != 0 && len(episodes) > 0 {
+		histories, err := PlayHistoryServiceInstance.ListByAnime(userID, anime.ID, playlistURLs)
+		if err != nil {
+			return nil, err
+		}
+		// 记录已按播放时间从新到旧排列，每集只取最新的一条
+		for _, history := range histories {
+			for i := range detail.Episodes {
+				episode := &detail.Episodes[i]
+				if episode.LastPlayed != nil || !historyMatches(history, episode.Episode) {
+					continue
+				}
+				episode.applyHistory(history)
+				if lastPlayed < 0 {
+					lastPlayed = i
+				}
+				break
+			}
+		}
+	}
+	detail.ContinueWatching = detail.nextEpisode(lastPlayed)
+	return detail, nil
+}
+
+// nextEpisode 找出继续观看的剧集：最近播放的没看完就接着看，否则从它之后找第一集没看完的，
+// 后面都看完了再从头找
+func (d *AnimeDetail) nextEpisode(lastPlayed int) *EpisodeWatch {
+	if lastPlayed >= 0 && d.Episodes[lastPlayed].WatchState == WatchStateInProgress {
+		return &d.Episodes[lastPlayed]
+	}
+	for i := lastPlayed + 1; i < len(d.Episodes); i++ {
+		if d.Episodes[i].WatchState != WatchStateWatched {
+			return &d.Episodes[i]
+		}
+	}
+	for i := 0; i < lastPlayed && i < len(d.Episodes); i++ {
+		if d.Episodes[i].WatchState != WatchStateWatched {
+			return &d.Episodes[i]
+		}
+	}
+	return nil
+}
+
+func (e *EpisodeWatch) applyHistory(history models.PlayHistory) {
+	lastPlayed := history.LastPlayed
+	e.LastPlayed = &lastPlayed
+	e.Progress = history.Progress
+	e.CurrentTime = history.CurrentTime
+	switch {
+	case history.Progress >= watchedProgress:
+		e.WatchState = WatchStateWatched
+	case history.CurrentTime > 0:
+		e.WatchState = WatchStateInProgress
+	}
+}
+
+// historyMatches 判断播放记录是否属于该剧集，旧记录没有剧集ID，按播放地址判断
+func historyMatches(history models.PlayHistory, episode models.Episode) bool {
+	if history.EpisodeID != 0 {
+		return history.EpisodeID == episode.ID
+	}
+	return history.VideoURL != "" && history.VideoURL == episode.PlaylistURL
+}
+
+// normalize 检查排序方式并填入默认值，解析游标得到偏移量
+func (q *CatalogQuery) normalize() error {
+	if q.Sort == "" {
+		q.Sort = CatalogSortAdded
+	}
+	desc, ok := catalogSortDesc[q.Sort]
+	if !ok {
+		return &UserError{Message: "无效的排序方式: " + q.Sort}
+	}
+	switch q.Order {
+	case "":
+		q.Order = "asc"
+		if desc {
+			q.Order = "desc"
+		}
+	case "asc", "desc":
+	default:
+		return &UserError{Message: "无效的排序方向: " + q.Order}
+	}
+
+	if q.Limit < 0 || q.Limit > MaxCatalogLimit {
+		return &UserError{Message: fmt.Sprintf("每页数量必须在 1 到 %d 之间", MaxCatalogLimit)}
+	}
+	if q.Offset < 0 {
+		return &UserError{Message: "无效的偏移量"}
+	}
+	if q.Cursor != "" {
+		offset, err := decodeCatalogCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return err
+		}
+		q.Offset = offset
+	}
+	return nil
+}
+
+func (q CatalogQuery) match(anime models.AnimeInfo) bool {
+	if !q.Filter.Match(anime) {
+		return false
+	}
+	if q.Disk != "" {
+		disk := anime.StorageDisk
+		if disk == "" {
+			disk = CatalogDefaultDisk
+		}
+		if disk != q.Disk {
+			return false
+		}
+	}
+	if q.HasCover != nil {
+		hasCover := anime.Cover != "" && anime.Cover != defaultCoverURL
+		if hasCover != *q.HasCover {
+			return false
+		}
+	}
+	return true
+}
+
+// sortAnimes 排序动画，值相同时按标题、再按目录名排列，保证分页结果稳定
+func (s *CatalogService) sortAnimes(animes []models.AnimeInfo, sortBy string, desc bool) {
+	var viewers map[uint]int
+	if sortBy == CatalogSortPopularity {
+		viewers = PlayHistoryServiceInstance.CountViewersByAnime()
+	}
+
+	compare := func(a, b models.AnimeInfo) int {
+		switch sortBy {
+		case CatalogSortAdded:
+			return a.CreatedAt.Compare(b.CreatedAt)
+		case CatalogSortUpdated:
+			return a.UpdatedAt.Compare(b.UpdatedAt)
+		case CatalogSortEpisodes:
+			return a.Episodes - b.Episodes
+		case CatalogSortPopularity:
+			return viewers[a.ID] - viewers[b.ID]
+		}
+		return 0
+	}
+
+	sort.SliceStable(animes, func(i, j int) bool {
+		a, b := animes[i], animes[j]
+		if c := compare(a, b); c != 0 {
+			return (c > 0) == desc
+		}
+		if a.Title != b.Title {
+			return utils.NaturalLess(a.Title, b.Title) != (desc && sortBy == CatalogSortTitle)
+		}
+		return a.FolderName < b.FolderName
+	})
+}
+
+// 游标记录排序方式和下一页的偏移量，排序方式不同的游标不能混用
+func encodeCatalogCursor(sortBy string, order string, offset int) string {
+	raw := sortBy + ":" + order + ":" + strconv.Itoa(offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCatalogCursor(cursor string, sortBy string, order string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, &UserError{Message: "无效的分页游标"}
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return 0, &UserError{Message: "无效的分页游标"}
+	}
+	if parts[0] != sortBy || parts[1] != order {
+		return 0, &UserError{Message: "分页游标与排序方式不一致"}
+	}
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil || offset < 0 {
+		return 0, &UserError{Message: "无效的分页游标"}
+	}
+	return offset, nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anime-website/models"
+	"anime-website/utils"
+)
+
+type EpisodeService struct {
+	mu     sync.Mutex
+	local  map[string][]models.Episode
+	nextID uint
+}
+
+var EpisodeServiceInstance = &EpisodeService{
+	local: make(map[string][]models.Episode),
+}
+
+// SyncEpisodes 用扫描到的剧集更新动画的剧集记录，删除磁盘上已不存在的剧集
+func (s *EpisodeService) SyncEpisodes(anime models.AnimeInfo, videos []models.VideoFile) []models.Episode {
+	existing := make(map[string]models.Episode)
+	for _, episode := range s.ListByAnime(anime) {
+		existing[episode.Name] = episode
+	}
+
+	episodes := make([]models.Episode, 0, len(videos))
+	for _, video := range videos {
+		episode := models.Episode{
+			AnimeID:      anime.ID,
+			AnimeFolder:  anime.FolderName,
+			Name:         video.FileName,
+			Title:        video.FileName,
+			PlaylistURL:  video.Path,
+			PhysicalPath: video.PhysicalPath,
+			StorageDisk:  anime.StorageDisk,
+			CreatedAt:    time.Now(),
+		}
+		applyParsedNumber(&episode)
+		if video.Title != "" {
+			episode.Title = video.Title
+		}
+
+		previous, found := existing[video.FileName]
+		if found {
+			episode.ID = previous.ID
+			episode.CreatedAt = previous.CreatedAt
+			if previous.NumberLocked {
+				episode.Season = previous.Season
+				episode.Number = previous.Number
+				episode.Kind = previous.Kind
+				episode.Title = previous.Title
+				episode.NumberLocked = true
+			}
+			delete(existing, video.FileName)
+		}
+		fillEpisodeMedia(&episode, previous, found)
+
+		episodes = append(episodes, episode)
+	}
+	SortEpisodes(episodes)
+
+	var removed []uint
+	for _, episode := range existing {
+		removed = append(removed, episode.ID)
+	}
+
+	if LocalMode || DB == nil {
+		s.mu.Lock()
+		for i := range episodes {
+			if episodes[i].ID == 0 {
+				s.nextID++
+				episodes[i].ID = s.nextID
+			}
+			episodes[i].UpdatedAt = time.Now()
+		}
+		s.local[anime.FolderName] = episodes
+		s.mu.Unlock()
+		return episodes
+	}
+
+	// 动画还没有写入数据库时只返回扫描结果，不保存剧集
+	if anime.ID == 0 {
+		return episodes
+	}
+
+	for i := range episodes {
+		episodes[i].UpdatedAt = time.Now()
+		if result := DB.Save(&episodes[i]); result.Error != nil {
+			log.Printf("错误: 保存剧集 %s/%s 失败: %v\n", anime.FolderName, episodes[i].Name, result.Error)
+		}
+	}
+	if len(removed) > 0 {
+		if result := DB.Delete(&models.Episode{}, removed); result.Error != nil {
+			log.Printf("错误: 删除动画 %s 已不存在的剧集失败: %v\n", anime.FolderName, result.Error)
+		} else {
+			log.Printf("删除动画 %s 已不存在的剧集 %d 个\n", anime.FolderName, len(removed))
+		}
+	}
+
+	return episodes
+}
+
+// ListByAnime 按集数顺序返回动画的剧集
+func (s *EpisodeService) ListByAnime(anime models.AnimeInfo) []models.Episode {
+	var episodes []models.Episode
+
+	if !LocalMode && DB != nil {
+		if anime.ID == 0 {
+			return episodes
+		}
+		result := DB.Where("anime_id = ?", anime.ID).Find(&episodes)
+		if result.Error != nil {
+			log.Printf("错误: 获取动画 %s 的剧集失败: %v\n", anime.FolderName, result.Error)
+		}
+		SortEpisodes(episodes)
+		return episodes
+	}
+
+	s.mu.Lock()
+	episodes = append(episodes, s.local[anime.FolderName]...)
+	s.mu.Unlock()
+	SortEpisodes(episodes)
+	return episodes
+}
+
+// SetEpisodeNumber 手动指定剧集的季数、集数、类型和标题，之后重新扫描不会覆盖
+func (s *EpisodeService) SetEpisodeNumber(id uint, season int, number int, kind string, title string) (*models.Episode, error) {
+	if !utils.IsValidEpisodeKind(kind) {
+		return nil, &UserError{Message: "无效的剧集类型: " + kind}
+	}
+	if season < 0 || number < 0 {
+		return nil, &UserError{Message: "季数和集数不能为负数"}
+	}
+
+	return s.updateEpisode(id, func(episode *models.Episode) {
+		episode.Season = season
+		episode.Number = number
+		episode.Kind = kind
+		if title != "" {
+			episode.Title = title
+		}
+		episode.NumberLocked = true
+	})
+}
+
+// ResetEpisodeNumber 取消手动指定，恢复从文件名解析的集数
+func (s *EpisodeService) ResetEpisodeNumber(id uint) (*models.Episode, error) {
+	return s.updateEpisode(id, func(episode *models.Episode) {
+		episode.Title = episode.Name
+		episode.NumberLocked = false
+		applyParsedNumber(episode)
+	})
+}
+
+func (s *EpisodeService) updateEpisode(id uint, update func(*models.Episode)) (*models.Episode, error) {
+	if !LocalMode && DB != nil {
+		var episode models.Episode
+		if result := DB.First(&episode, id); result.Error != nil {
+			return nil, &UserError{Message: "剧集不存在"}
+		}
+		update(&episode)
+		episode.UpdatedAt = time.Now()
+		if result := DB.Save(&episode); result.Error != nil {
+			log.Printf("错误: 更新剧集 %d 失败: %v\n", id, result.Error)
+			return nil, result.Error
+		}
+		return &episode, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for folder, episodes := range s.local {
+		for i := range episodes {
+			if episodes[i].ID == id {
+				update(&episodes[i])
+				episodes[i].UpdatedAt = time.Now()
+				episode := episodes[i]
+				SortEpisodes(episodes)
+				s.local[folder] = episodes
+				return &episode, nil
+			}
+		}
+	}
+	return nil, &UserError{Message: "剧集不存在"}
+}
+
+// SortEpisodes 按类型、季数、集数排序，集数相同或未识别时按目录名自然排序
+func SortEpisodes(episodes []models.Episode) {
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return utils.CompareEpisodes(episodeName(episodes[i]), episodeName(episodes[j]), episodes[i].Name, episodes[j].Name) < 0
+	})
+}
+
+func episodeName(episode models.Episode) utils.EpisodeName {
+	return utils.EpisodeName{
+		Season: episode.Season,
+		Number: episode.Number,
+		Kind:   episode.Kind,
+		Parsed: episode.Number > 0 || episode.NumberLocked,
+	}
+}
+
+func applyParsedNumber(episode *models.Episode) {
+	parsed := utils.ParseEpisodeName(episode.Name)
+	episode.Season = parsed.Season
+	episode.Number = parsed.Number
+	episode.Kind = parsed.Kind
+}
+
+// GetEpisode 按ID获取剧集
+func (s *EpisodeService) GetEpisode(id uint) (*models.Episode, bool) {
+	if !LocalMode && DB != nil {
+		var episode models.Episode
+		if result := DB.First(&episode, id); result.Error != nil {
+			return nil, false
+		}
+		return &episode, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, episodes := range s.local {
+		for _, episode := range episodes {
+			if episode.ID == id {
+				return &episode, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// FindByPlaylistURL 按播放地址查找剧集，用于把旧的播放记录关联到剧集
+func (s *EpisodeService) FindByPlaylistURL(playlistURL string) (*models.Episode, bool) {
+	if playlistURL == "" {
+		return nil, false
+	}
+
+	if !LocalMode && DB != nil {
+		var episode models.Episode
+		if result := DB.Where("playlist_url = ?", playlistURL).First(&episode); result.Error != nil {
+			return nil, false
+		}
+		return &episode, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, episodes := range s.local {
+		for _, episode := range episodes {
+			if episode.PlaylistURL == playlistURL {
+				return &episode, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// CountByAnime 返回每个动画的剧集数量
+func (s *EpisodeService) CountByAnime() map[uint]int {
+	counts := make(map[uint]int)
+	if LocalMode || DB == nil {
+		return counts
+	}
+
+	var rows []struct {
+		AnimeID uint
+		Count   int
+	}
+	result := DB.Model(&models.Episode{}).Select("anime_id, COUNT(*) AS count").Group("anime_id").Scan(&rows)
+	if result.Error != nil {
+		log.Printf("错误: 统计剧集数量失败: %v\n", result.Error)
+		return counts
+	}
+	for _, row := range rows {
+		counts[row.AnimeID] = row.Count
+	}
+	return counts
+}
+
+// DeleteByAnime 删除动画的所有剧集记录
+func (s *EpisodeService) DeleteByAnime(animeFolder string) {
+	if !LocalMode && DB != nil {
+		result := DB.Where("anime_folder = ?", animeFolder).Delete(&models.Episode{})
+		if result.Error != nil {
+			log.Printf("错误: 从数据库删除剧集失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.local, animeFolder)
+	s.mu.Unlock()
+}
+
+// updateLocal 修改本地模式下动画的所有剧集，数据库模式由调用方直接更新
+func (s *EpisodeService) updateLocal(animeFolder string, update func(*models.Episode)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.local[animeFolder] {
+		update(&s.local[animeFolder][i])
+	}
+}
+
+// fillEpisodeMedia 填充时长、分辨率、编码和大小。目录大小没变时沿用上次的探测结果，避免每次扫描都调用ffprobe
+func fillEpisodeMedia(episode *models.Episode, previous models.Episode, hasPrevious bool) {
+	episodeDir := filepath.Dir(episode.PhysicalPath)
+	episode.FileSize = directorySize(episodeDir)
+
+	if hasPrevious && previous.FileSize == episode.FileSize && previous.Duration > 0 {
+		episode.Duration = previous.Duration
+		episode.Width = previous.Width
+		episode.Height = previous.Height
+		episode.VideoCodec = previous.VideoCodec
+		episode.AudioCodec = previous.AudioCodec
+		return
+	}
+
+	playlists, err := episodeMediaPlaylists(episodeDir)
+	if err != nil {
+		log.Printf("警告: 读取剧集 %s 播放列表失败: %v\n", episodeDir, err)
+		return
+	}
+	if playlist, err := parseMediaPlaylist(playlists[0]); err == nil {
+		episode.Duration = playlist.TotalDuration
+	}
+
+	info, err := ProbeMedia(playlists[0])
+	if err != nil {
+		log.Printf("警告: 探测剧集 %s 媒体信息失败: %v\n", episodeDir, err)
+		return
+	}
+	episode.Width = info.Width
+	episode.Height = info.Height
+	episode.VideoCodec = info.VideoCodec
+	episode.AudioCodec = info.AudioCodec
+	if episode.Duration == 0 {
+		episode.Duration = info.Duration
+	}
+}
+
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const maxFFmpegStderr = 8 * 1024
+
+var ErrFFmpegStopped = errors.New("FFmpeg已被停止")
+
+// FFmpegProgress 是从 ffmpeg -progress 输出中解析出的一次进度快照
+type FFmpegProgress struct {
+	OutTime  float64 `json:"outTime"`
+	Duration float64 `json:"duration"`
+	Percent  float64 `json:"percent"`
+	FPS      float64 `json:"fps"`
+	Speed    float64 `json:"speed"`
+	ETA      float64 `json:"eta"`
+}
+
+// Event 把进度转换为推送到进度通道的事件
+func (p FFmpegProgress) Event() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "file_progress",
+		"percent":  p.Percent,
+		"fps":      p.FPS,
+		"speed":    p.Speed,
+		"eta":      p.ETA,
+		"outTime":  p.OutTime,
+		"duration": p.Duration,
+	}
+}
+
+// ProbeDuration 使用ffprobe获取媒体时长（秒）
+func ProbeDuration(path string) (float64, error) {
+	return probeDurationIn("", path)
+}
+
+// probeDurationIn 在 dir 目录下运行ffprobe，input 中的相对路径相对 dir 解析
+func probeDurationIn(dir string, input string) (float64, error) {
+	cmd := exec.Command(
+		"ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		input,
+	)
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("获取时长失败: %v", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("时长无效: %s", strings.TrimSpace(string(output)))
+	}
+	return duration, nil
+}
+
+// MediaInfo 是ffprobe探测到的主要流信息
+type MediaInfo struct {
+	Duration   float64
+	Width      int
+	Height     int
+	VideoCodec string
+	AudioCodec string
+}
+
+func (m MediaInfo) HasAudio() bool {
+	return m.AudioCodec != ""
+}
+
+// ProbeMedia 使用ffprobe获取时长、分辨率和编码信息
+func ProbeMedia(path string) (MediaInfo, error) {
+	var info MediaInfo
+
+	cmd := exec.Command(
+		"ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type,codec_name,width,height",
+		"-of", "json",
+		path,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return info, fmt.Errorf("探测媒体信息失败: %v", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return info, fmt.Errorf("解析媒体信息失败: %v", err)
+	}
+
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if info.VideoCodec == "" {
+				info.VideoCodec = stream.CodecName
+				info.Width = stream.Width
+				info.Height = stream.Height
+			}
+		case "audio":
+			if info.AudioCodec == "" {
+				info.AudioCodec = stream.CodecName
+			}
+		}
+	}
+	return info, nil
+}
+
+// RunFFmpeg 执行ffmpeg并通过onProgress回调实时报告进度，duration未知时传0
+func RunFFmpeg(args []string, duration float64, onProgress func(FFmpegProgress)) error {
+	return RunFFmpegWithStop(args, duration, onProgress, nil)
+}
+
+// RunFFmpegWithStop 与 RunFFmpeg 相同，stopChan 关闭时终止ffmpeg进程
+func RunFFmpegWithStop(args []string, duration float64, onProgress func(FFmpegProgress), stopChan <-chan struct{}) error {
+	fullArgs := append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.Command("ffmpeg", fullArgs...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxFFmpegStderr}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建FFmpeg输出管道失败: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动FFmpeg失败: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	var stopped atomic.Bool
+	if stopChan != nil {
+		go func() {
+			select {
+			case <-stopChan:
+				stopped.Store(true)
+				cmd.Process.Kill()
+			case <-done:
+			}
+		}()
+	}
+
+	var progress FFmpegProgress
+	progress.Duration = duration
+	progress.ETA = -1
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// out_time_ms 实际单位同样是微秒
+			if us, err := strconv.ParseFloat(value, 64); err == nil && us >= 0 {
+				progress.OutTime = us / 1e6
+			}
+		case "fps":
+			if fps, err := strconv.ParseFloat(value, 64); err == nil {
+				progress.FPS = fps
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				progress.Speed = speed
+			}
+		case "progress":
+			if duration > 0 {
+				progress.Percent = progress.OutTime / duration * 100
+				if progress.Percent > 100 {
+					progress.Percent = 100
+				}
+				if progress.Speed > 0 {
+					progress.ETA = (duration - progress.OutTime) / progress.Speed
+					if progress.ETA < 0 {
+						progress.ETA = 0
+					}
+				}
+			}
+			if value == "end" {
+				progress.Percent = 100
+				progress.ETA = 0
+			}
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if stopped.Load() {
+			return ErrFFmpegStopped
+		}
+		return fmt.Errorf("执行FFmpeg命令失败: %v, 输出: %s", err, stderr.String())
+	}
+	return nil
+}
+
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			w.buf.Write(p[:remaining])
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"anime-website/config"
+)
+
+const (
+	masterPlaylistName  = "master.m3u8"
+	variantPlaylistName = "playlist.m3u8"
+)
+
+// 各H.264 profile对应的 profile_idc + constraint 标志（RFC 6381）
+var avcProfileCodes = map[string]string{
+	"baseline": "42E0",
+	"main":     "4D40",
+	"high":     "6400",
+}
+
+type abrRendition struct {
+	config.RenditionConfig
+	OutWidth  int
+	OutHeight int
+}
+
+// generateABRHLS 按配置的码率阶梯转码出多个清晰度，并写出 master.m3u8
+func (s *VideoService) generateABRHLS(videoFilePath string, hlsDirPath string, profile config.TranscodeProfile, onProgress func(FFmpegProgress), stopChan <-chan struct{}) error {
+	media, err := ProbeMedia(videoFilePath)
+	if err != nil {
+		return err
+	}
+	if media.Height <= 0 {
+		return fmt.Errorf("未找到视频流: %s", videoFilePath)
+	}
+
+	renditions := selectRenditions(config.Get().Transcode.Ladder, media)
+	if len(renditions) == 0 {
+		return fmt.Errorf("码率阶梯为空，请检查配置")
+	}
+
+	for _, rendition := range renditions {
+		if err := os.MkdirAll(filepath.Join(hlsDirPath, rendition.Name), 0755); err != nil {
+			return fmt.Errorf("创建HLS目录失败: %v", err)
+		}
+	}
+
+	err = RunFFmpegWithStop(buildABRArgs(videoFilePath, hlsDirPath, renditions, media.HasAudio(), profile), media.Duration, onProgress, stopChan)
+	if err != nil {
+		return err
+	}
+
+	return writeMasterPlaylist(hlsDirPath, renditions, media.HasAudio(), profile)
+}
+
+// selectRenditions 去掉高于源分辨率的档位（避免放大），至少保留最低一档
+func selectRenditions(ladder []config.RenditionConfig, media MediaInfo) []abrRendition {
+	sorted := make([]config.RenditionConfig, len(ladder))
+	copy(sorted, ladder)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Height > sorted[j].Height
+	})
+
+	var renditions []abrRendition
+	for _, rendition := range sorted {
+		if rendition.Height <= media.Height {
+			renditions = append(renditions, newABRRendition(rendition, media))
+		}
+	}
+	if len(renditions) == 0 && len(sorted) > 0 {
+		renditions = append(renditions, newABRRendition(sorted[len(sorted)-1], media))
+	}
+	return renditions
+}
+
+func newABRRendition(rendition config.RenditionConfig, media MediaInfo) abrRendition {
+	height := rendition.Height
+	if height > media.Height {
+		height = media.Height - media.Height%2
+	}
+
+	// 与 scale=-2:H 的计算方式保持一致：按源宽高比缩放并取偶数
+	width := rendition.Width
+	if media.Width > 0 && media.Height > 0 {
+		width = int(float64(media.Width)*float64(height)/float64(media.Height)/2+0.5) * 2
+	}
+
+	return abrRendition{
+		RenditionConfig: rendition,
+		OutWidth:        width,
+		OutHeight:       height,
+	}
+}
+
+func buildABRArgs(input string, outputDir string, renditions []abrRendition, hasAudio bool, profile config.TranscodeProfile) []string {
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v]split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	for i, rendition := range renditions {
+		fmt.Fprintf(&filter, ";[v%d]scale=-2:%d[v%dout]", i, rendition.OutHeight, i)
+	}
+
+	args := []string{
+		"-i", input,
+		"-filter_complex", filter.String(),
+	}
+
+	var streamMap []string
+	for i, rendition := range renditions {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), profile.VideoEncoder,
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrateK),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", rendition.MaxrateK),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", rendition.BufsizeK),
+		)
+		if rendition.Profile != "" {
+			args = append(args, fmt.Sprintf("-profile:v:%d", i), rendition.Profile)
+		}
+		if rendition.Level != "" {
+			args = append(args, fmt.Sprintf("-level:v:%d", i), rendition.Level)
+		}
+
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			args = append(args,
+				"-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", rendition.AudioBitrateK),
+				fmt.Sprintf("-ac:a:%d", i), "2",
+			)
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, entry+",name:"+rendition.Name)
+	}
+
+	if profile.Preset != "" {
+		args = append(args, "-preset", profile.Preset)
+	}
+	// 各档位关键帧对齐到切片边界，播放器才能无缝切换
+	args = append(args, keyframeArgs(profile.SegmentSeconds)...)
+	args = append(args, profile.ExtraArgs...)
+	args = append(args, "-f", "hls", "-hls_playlist_type", "vod")
+	args = append(args, ProfileHLSArgs(profile, filepath.Join(outputDir, "%v"))...)
+	args = append(args,
+		"-hls_flags", "independent_segments",
+		"-var_stream_map", strings.Join(streamMap, " "),
+		"-loglevel", "error",
+		"-y",
+		filepath.Join(outputDir, "%v", variantPlaylistName),
+	)
+	return args
+}
+
+// writeMasterPlaylist 根据实际切片大小计算峰值和平均码率，生成 master.m3u8
+func writeMasterPlaylist(outputDir string, renditions []abrRendition, hasAudio bool, profile config.TranscodeProfile) error {
+	// fMP4 切片需要 HLS 协议版本 7
+	version := 3
+	if profile.SegmentType == config.SegmentTypeFMP4 {
+		version = 7
+	}
+
+	var builder strings.Builder
+	builder.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&builder, "#EXT-X-VERSION:%d\n", version)
+	builder.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	for _, rendition := range renditions {
+		peak, average, err := measureVariantBitrate(filepath.Join(outputDir, rendition.Name, variantPlaylistName))
+		if err != nil {
+			log.Printf("警告: 统计 %s 码率失败，使用配置值: %v\n", rendition.Name, err)
+			peak = (rendition.MaxrateK + rendition.AudioBitrateK) * 1000
+			average = (rendition.VideoBitrateK + rendition.AudioBitrateK) * 1000
+		}
+
+		codecs := avcCodecString(rendition.Profile, rendition.Level)
+		if hasAudio {
+			codecs += ",mp4a.40.2"
+		}
+
+		fmt.Fprintf(&builder, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n",
+			peak, average, rendition.OutWidth, rendition.OutHeight, codecs)
+		builder.WriteString(rendition.Name + "/" + variantPlaylistName + "\n")
+	}
+
+	masterPath := filepath.Join(outputDir, masterPlaylistName)
+	tmpPath := masterPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(builder.String()), 0644); err != nil {
+		return fmt.Errorf("写入主播放列表失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, masterPath); err != nil {
+		return fmt.Errorf("写入主播放列表失败: %v", err)
+	}
+	return nil
+}
+
+// measureVariantBitrate 读取子播放列表，返回单个切片的峰值码率和整体平均码率（bit/s）
+func measureVariantBitrate(playlistPath string) (int, int, error) {
+	playlist, err := parseMediaPlaylist(playlistPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if playlist.TotalDuration <= 0 {
+		return 0, 0, fmt.Errorf("播放列表没有切片: %s", playlistPath)
+	}
+
+	var peak, totalBits float64
+	for _, segment := range playlist.Segments {
+		info, err := os.Stat(playlist.SegmentPath(segment.URI))
+		if err != nil {
+			return 0, 0, err
+		}
+		if segment.Duration <= 0 {
+			continue
+		}
+		bits := float64(info.Size() * 8)
+		if rate := bits / segment.Duration; rate > peak {
+			peak = rate
+		}
+		totalBits += bits
+	}
+
+	return int(peak + 0.5), int(totalBits/playlist.TotalDuration + 0.5), nil
+}
+
+// avcCodecString 生成 CODECS 属性中的 avc1.PPCCLL 字符串
+func avcCodecString(profile string, level string) string {
+	profileCode, ok := avcProfileCodes[strings.ToLower(profile)]
+	if !ok {
+		profileCode = avcProfileCodes["high"]
+	}
+
+	levelCode := 41
+	if value, err := strconv.ParseFloat(level, 64); err == nil && value > 0 {
+		levelCode = int(value*10 + 0.5)
+	}
+
+	return fmt.Sprintf("avc1.%s%02X", profileCode, levelCode)
+}
+
+// findEpisodePlaylist 返回剧集目录下可播放的播放列表，优先使用多码率的 master.m3u8
+func findEpisodePlaylist(episodeDir string) (string, bool) {
+	for _, name := range []string{masterPlaylistName, variantPlaylistName} {
+		if _, err := os.Stat(filepath.Join(episodeDir, name)); err == nil {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type hlsSegment struct {
+	URI      string
+	Duration float64
+}
+
+// mediaPlaylist 是解析后的子播放列表
+type mediaPlaylist struct {
+	Path          string
+	Segments      []hlsSegment
+	InitURI       string
+	TotalDuration float64
+	HasEndList    bool
+}
+
+// SegmentPath 返回切片在磁盘上的路径
+func (p *mediaPlaylist) SegmentPath(uri string) string {
+	return filepath.Join(filepath.Dir(p.Path), filepath.FromSlash(path.Clean(uri)))
+}
+
+// parseMediaPlaylist 解析子播放列表中的切片和时长
+func parseMediaPlaylist(playlistPath string) (*mediaPlaylist, error) {
+	file, err := os.Open(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	playlist := &mediaPlaylist{Path: playlistPath}
+	var segmentDuration float64
+	var hasDuration bool
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			value, _, _ = strings.Cut(value, ",")
+			segmentDuration, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("无效的EXTINF: %s", line)
+			}
+			hasDuration = true
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if _, uri, found := strings.Cut(line, `URI="`); found {
+				playlist.InitURI, _, _ = strings.Cut(uri, `"`)
+			}
+		case line == "#EXT-X-ENDLIST":
+			playlist.HasEndList = true
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if !hasDuration {
+				continue
+			}
+			playlist.Segments = append(playlist.Segments, hlsSegment{URI: line, Duration: segmentDuration})
+			playlist.TotalDuration += segmentDuration
+			hasDuration = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// parseMasterPlaylist 返回主播放列表中各子播放列表的磁盘路径
+func parseMasterPlaylist(masterPath string) ([]string, error) {
+	file, err := os.Open(masterPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var variants []string
+	expectURI := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			expectURI = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || !expectURI {
+			continue
+		}
+		variants = append(variants, filepath.Join(filepath.Dir(masterPath), filepath.FromSlash(path.Clean(line))))
+		expectURI = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("主播放列表没有子播放列表: %s", masterPath)
+	}
+	return variants, nil
+}
+
+// episodeMediaPlaylists 返回剧集目录下所有需要检查的子播放列表
+func episodeMediaPlaylists(episodeDir string) ([]string, error) {
+	playlistName, found := findEpisodePlaylist(episodeDir)
+	if !found {
+		return nil, fmt.Errorf("未找到播放列表: %s", episodeDir)
+	}
+	if playlistName == masterPlaylistName {
+		return parseMasterPlaylist(filepath.Join(episodeDir, masterPlaylistName))
+	}
+	return []string{filepath.Join(episodeDir, playlistName)}, nil
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/models"
+)
+
+const hlsRepairWorkers = 4
+
+// RepairTargets 返回最近一次校验异常的剧集，可按动画和剧集过滤，结果为 动画/剧集 形式
+func (s *HLSVerifyService) RepairTargets(animeFolder string, episode string) ([]string, error) {
+	results, err := s.ListHealth(animeFolder, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	for _, health := range results {
+		if episode == "" || health.Episode == episode {
+			targets = append(targets, healthKey(health.AnimeFolder, health.Episode))
+		}
+	}
+	return targets, nil
+}
+
+// GetHealth 获取剧集最近一次的校验结果
+func (s *HLSVerifyService) GetHealth(animeFolder string, episode string) (*models.HLSHealth, bool) {
+	if !LocalMode && DB != nil {
+		var health models.HLSHealth
+		result := DB.Where("anime_folder = ? AND episode = ?", animeFolder, episode).First(&health)
+		if result.Error != nil {
+			return nil, false
+		}
+		return &health, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health, exists := s.local[healthKey(animeFolder, episode)]
+	if !exists {
+		return nil, false
+	}
+	return &health, true
+}
+
+// BatchRepairHLS 修复异常剧集，返回值与 BatchGenerateHLS 一致，便于任务队列统一处理
+func (s *VideoService) BatchRepairHLS(targets []string, profile config.TranscodeProfile, progressChan chan<- map[string]interface{}, stopChan <-chan struct{}) (int, int, int, int, []string) {
+	total := len(targets)
+	success := 0
+	failed := 0
+	skipped := 0
+	var errors []string
+
+	semaphore := make(chan struct{}, hlsRepairWorkers)
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+
+	for i, target := range targets {
+		select {
+		case <-stopChan:
+			wg.Wait()
+			select {
+			case progressChan <- map[string]interface{}{
+				"type":      "stop",
+				"message":   "处理已停止",
+				"timestamp": time.Now().Format(time.RFC3339),
+			}:
+			default:
+			}
+			return total, success, failed, skipped, errors
+		case semaphore <- struct{}{}:
+		}
+
+		animeFolder, episode, _ := strings.Cut(target, "/")
+		health, found := HLSVerifyServiceInstance.GetHealth(animeFolder, episode)
+		if !found || health.Healthy {
+			<-semaphore
+			resultMu.Lock()
+			skipped++
+			resultMu.Unlock()
+			select {
+			case progressChan <- map[string]interface{}{
+				"type":      "skipped",
+				"video":     target,
+				"anime":     animeFolder,
+				"episode":   episode,
+				"message":   "剧集已恢复正常，跳过修复",
+				"timestamp": time.Now().Format(time.RFC3339),
+			}:
+			default:
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(idx int, health models.HLSHealth) {
+			defer func() {
+				wg.Done()
+				<-semaphore
+			}()
+
+			key := healthKey(health.AnimeFolder, health.Episode)
+			select {
+			case progressChan <- map[string]interface{}{
+				"type":      "progress",
+				"current":   idx + 1,
+				"total":     total,
+				"video":     key,
+				"anime":     health.AnimeFolder,
+				"episode":   health.Episode,
+				"status":    "processing",
+				"timestamp": time.Now().Format(time.RFC3339),
+			}:
+			default:
+			}
+
+			onProgress := func(progress FFmpegProgress) {
+				event := progress.Event()
+				event["video"] = key
+				event["anime"] = health.AnimeFolder
+				event["episode"] = health.Episode
+				event["timestamp"] = time.Now().Format(time.RFC3339)
+				select {
+				case progressChan <- event:
+				default:
+				}
+			}
+
+			err := s.RepairEpisode(&health, profile, onProgress, stopChan)
+			if err != nil {
+				errorMsg := fmt.Sprintf("剧集 %s 修复失败: %v", key, err)
+				resultMu.Lock()
+				failed++
+				errors = append(errors, errorMsg)
+				resultMu.Unlock()
+				log.Printf("错误: %s\n", errorMsg)
+
+				select {
+				case progressChan <- map[string]interface{}{
+					"type":      "error",
+					"video":     key,
+					"anime":     health.AnimeFolder,
+					"episode":   health.Episode,
+					"message":   err.Error(),
+					"timestamp": time.Now().Format(time.RFC3339),
+				}:
+				default:
+				}
+				return
+			}
+
+			resultMu.Lock()
+			success++
+			resultMu.Unlock()
+			log.Printf("成功: 剧集 %s 修复完成\n", key)
+
+			select {
+			case progressChan <- map[string]interface{}{
+				"type":      "success",
+				"video":     key,
+				"anime":     health.AnimeFolder,
+				"episode":   health.Episode,
+				"timestamp": time.Now().Format(time.RFC3339),
+			}:
+			default:
+			}
+		}(i, *health)
+	}
+
+	wg.Wait()
+
+	return total, success, failed, skipped, errors
+}
+
+// RepairEpisode 在同一磁盘的临时目录重新编码剧集，校验通过后原子替换原目录。
+// 多码率剧集逐个修复子播放列表，保留原来的 master.m3u8
+func (s *VideoService) RepairEpisode(health *models.HLSHealth, profile config.TranscodeProfile, onProgress func(FFmpegProgress), stopChan <-chan struct{}) error {
+	episodeDir := health.EpisodePath
+	playlistName, found := findEpisodePlaylist(episodeDir)
+	if !found {
+		return fmt.Errorf("未找到播放列表: %s", episodeDir)
+	}
+	inputPath := filepath.Join(episodeDir, playlistName)
+	playlists, err := episodeMediaPlaylists(episodeDir)
+	if err != nil {
+		return err
+	}
+
+	// 临时目录和原目录在同一个父目录下，保证最后的 rename 是原子的
+	stamp := time.Now().Format("20060102150405")
+	parentDir := filepath.Dir(episodeDir)
+	baseName := filepath.Base(episodeDir)
+	tmpDir := filepath.Join(parentDir, "."+baseName+".repair-"+stamp)
+	backupDir := filepath.Join(parentDir, "."+baseName+".backup-"+stamp)
+
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, playlistPath := range playlists {
+		rel, err := filepath.Rel(episodeDir, playlistPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("子播放列表不在剧集目录中: %s", playlistPath)
+		}
+		outputPath := filepath.Join(tmpDir, rel)
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return fmt.Errorf("创建临时目录失败: %v", err)
+		}
+
+		var duration float64
+		if playlist, err := parseMediaPlaylist(playlistPath); err == nil {
+			duration = playlist.TotalDuration
+		}
+
+		// 多个子播放列表时把单个的进度换算成整个剧集的进度
+		variantProgress := onProgress
+		if onProgress != nil && len(playlists) > 1 {
+			index := i
+			variantProgress = func(progress FFmpegProgress) {
+				progress.Percent = (float64(index)*100 + progress.Percent) / float64(len(playlists))
+				onProgress(progress)
+			}
+		}
+
+		encodeArgs := repairEncodeArgs(profile, filepath.Base(filepath.Dir(playlistPath)))
+		err = RunFFmpegWithStop(repairArgs(playlistPath, outputPath, encodeArgs, profile), duration, variantProgress, stopChan)
+		if err != nil {
+			return err
+		}
+	}
+
+	if playlistName == masterPlaylistName {
+		content, err := os.ReadFile(inputPath)
+		if err != nil {
+			return fmt.Errorf("读取主播放列表失败: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, masterPlaylistName), content, 0644); err != nil {
+			return fmt.Errorf("写入主播放列表失败: %v", err)
+		}
+	}
+
+	check := checkEpisode(episodeLocation{Dir: tmpDir})
+	if !check.Healthy {
+		return fmt.Errorf("修复结果校验失败: %s", strings.Join(check.ProblemList(), "; "))
+	}
+
+	if err := WriteProfileRecord(tmpDir, profile, inputPath); err != nil {
+		log.Printf("警告: 记录转码配置失败: %v\n", err)
+	}
+
+	if err := os.Rename(episodeDir, backupDir); err != nil {
+		return fmt.Errorf("备份原目录失败: %v", err)
+	}
+	if err := os.Rename(tmpDir, episodeDir); err != nil {
+		if restoreErr := os.Rename(backupDir, episodeDir); restoreErr != nil {
+			log.Printf("错误: 恢复原目录 %s 失败: %v\n", episodeDir, restoreErr)
+		}
+		return fmt.Errorf("替换原目录失败: %v", err)
+	}
+	if err := os.RemoveAll(backupDir); err != nil {
+		log.Printf("警告: 删除备份目录 %s 失败: %v\n", backupDir, err)
+	}
+
+	HLSVerifyServiceInstance.VerifyEpisode(episodeLocation{
+		AnimeFolder: health.AnimeFolder,
+		Episode:     health.Episode,
+		Dir:         episodeDir,
+		DiskName:    health.StorageDisk,
+	})
+	return nil
+}
+
+// repairArgs 构建修复用的ffmpeg参数：丢弃损坏帧、重建时间戳，再按 encodeArgs 重新编码。切片写在 outputPath 所在目录
+func repairArgs(inputPath string, outputPath string, encodeArgs []string, profile config.TranscodeProfile) []string {
+	args := []string{
+		"-protocol_whitelist", "file,http,https,tcp,tls",
+		"-allowed_extensions", "ALL",
+		"-i", inputPath,
+		"-fflags", "+genpts+igndts+discardcorrupt",
+		"-err_detect", "aggressive",
+		"-bsf:a", "aac_adtstoasc",
+		"-fps_mode", "cfr",
+		"-async", "1",
+		"-shortest",
+		"-avoid_negative_ts", "make_zero",
+		"-reset_timestamps", "1",
+	}
+	args = append(args, encodeArgs...)
+	args = append(args, "-ar", "48000")
+	args = append(args, ProfileHLSArgs(profile, filepath.Dir(outputPath))...)
+	args = append(args,
+		"-hls_flags", "split_by_time+independent_segments",
+		"-hls_allow_cache", "1",
+		"-loglevel", "error",
+		"-y",
+		outputPath,
+	)
+	return args
+}
+
+// repairEncodeArgs 返回修复一个播放列表的编码参数。多码率配置下按同名档位的码率重新编码，
+// 不缩放，保持子播放列表原来的分辨率；找不到档位时按转码配置编码
+func repairEncodeArgs(profile config.TranscodeProfile, renditionName string) []string {
+	if profile.Mode != config.ProfileModeABR {
+		return ProfileEncodeArgs(profile)
+	}
+
+	for _, rendition := range config.Get().Transcode.Ladder {
+		if rendition.Name != renditionName {
+			continue
+		}
+		args := []string{
+			"-c:v", profile.VideoEncoder,
+			"-b:v", fmt.Sprintf("%dk", rendition.VideoBitrateK),
+			"-maxrate", fmt.Sprintf("%dk", rendition.MaxrateK),
+			"-bufsize", fmt.Sprintf("%dk", rendition.BufsizeK),
+		}
+		if rendition.Profile != "" {
+			args = append(args, "-profile:v", rendition.Profile)
+		}
+		if rendition.Level != "" {
+			args = append(args, "-level", rendition.Level)
+		}
+		if profile.Preset != "" {
+			args = append(args, "-preset", profile.Preset)
+		}
+		args = append(args, keyframeArgs(profile.SegmentSeconds)...)
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", rendition.AudioBitrateK),
+			"-ac", "2",
+		)
+		return append(args, profile.ExtraArgs...)
+	}
+	return ProfileEncodeArgs(profile)
+}
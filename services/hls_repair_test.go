@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"anime-website/config"
+	"anime-website/models"
+)
+
+// fakeFFmpeg 按播放列表写出两个 6 秒的切片，第二个切片的实际时长由 FAKE_LAST_SEGMENT 决定
+const fakeFFmpeg = `#!/bin/sh
+for arg; do output="$arg"; done
+dir=$(dirname "$output")
+echo 6 > "$dir/segment_000.ts"
+echo "$FAKE_LAST_SEGMENT" > "$dir/segment_001.ts"
+printf '#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nsegment_000.ts\n#EXTINF:6.0,\nsegment_001.ts\n#EXT-X-ENDLIST\n' > "$output"
+`
+
+func installFakeFFmpeg(t *testing.T) {
+	t.Helper()
+	installFakeFFprobe(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(fakeFFmpeg), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRepairEpisodeVerifiesDuration(t *testing.T) {
+	installFakeFFmpeg(t)
+	profile := config.TranscodeProfile{Name: "test", Mode: config.ProfileModeX264, VideoEncoder: "libx264", SegmentSeconds: 6}
+
+	tests := []struct {
+		name        string
+		lastSegment string
+		wantErr     bool
+	}{
+		{name: "complete re-encode replaces episode", lastSegment: "6"},
+		{name: "truncated re-encode keeps original", lastSegment: "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_LAST_SEGMENT", tt.lastSegment)
+			// 原剧集的切片缺失，需要修复
+			episodeDir := filepath.Join(t.TempDir(), "Anime", "01")
+			if err := os.MkdirAll(episodeDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			original := "#EXTM3U\n#EXTINF:6.0,\nsegment_000.ts\n#EXTINF:6.0,\nsegment_001.ts\n#EXT-X-ENDLIST\n"
+			if err := os.WriteFile(filepath.Join(episodeDir, variantPlaylistName), []byte(original), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			health := &models.HLSHealth{AnimeFolder: "Anime", Episode: "01", EpisodePath: episodeDir}
+			err := VideoServiceInstance.RepairEpisode(health, profile, nil, nil)
+
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "时长不一致") {
+					t.Fatalf("err = %v, want 时长不一致", err)
+				}
+				if _, err := os.Stat(filepath.Join(episodeDir, "segment_001.ts")); !os.IsNotExist(err) {
+					t.Fatalf("原剧集目录被替换")
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(filepath.Join(episodeDir, "segment_001.ts")); err != nil {
+					t.Fatalf("修复结果没有替换原目录: %v", err)
+				}
+			}
+
+			entries, err := os.ReadDir(filepath.Dir(episodeDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("临时目录没有清理: %v", entries)
+			}
+		})
+	}
+}
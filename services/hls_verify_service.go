@@ -0,0 +1,442 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/models"
+)
+
+const (
+	hlsVerifyWorkers     = 4
+	hlsDurationTolerance = 2.0
+)
+
+type HLSVerifyService struct {
+	mu         sync.Mutex
+	running    bool
+	startedAt  *time.Time
+	finishedAt *time.Time
+	local      map[string]models.HLSHealth
+}
+
+var HLSVerifyServiceInstance = &HLSVerifyService{
+	local: make(map[string]models.HLSHealth),
+}
+
+type HLSVerifyStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+type HLSHealthSummary struct {
+	Total     int `json:"total"`
+	Healthy   int `json:"healthy"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+type episodeLocation struct {
+	AnimeFolder string
+	Episode     string
+	Dir         string
+	DiskName    string
+}
+
+// StartVerify 在后台校验所有剧集，animeFolder 不为空时只校验该动画
+func (s *HLSVerifyService) StartVerify(animeFolder string) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return &UserError{Message: "校验正在进行中"}
+	}
+	now := time.Now()
+	s.running = true
+	s.startedAt = &now
+	s.finishedAt = nil
+	s.mu.Unlock()
+
+	go func() {
+		checked, unhealthy := s.VerifyAll(animeFolder)
+		log.Printf("HLS校验完成，共检查 %d 集，异常 %d 集\n", checked, unhealthy)
+
+		s.mu.Lock()
+		finished := time.Now()
+		s.running = false
+		s.finishedAt = &finished
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+func (s *HLSVerifyService) Status() HLSVerifyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return HLSVerifyStatus{
+		Running:    s.running,
+		StartedAt:  s.startedAt,
+		FinishedAt: s.finishedAt,
+	}
+}
+
+// VerifyAll 同步校验剧集并保存结果，返回检查数和异常数
+func (s *HLSVerifyService) VerifyAll(animeFolder string) (int, int) {
+	startedAt := time.Now()
+	locations := listEpisodeLocations(animeFolder)
+
+	work := make(chan episodeLocation)
+	var wg sync.WaitGroup
+	var countMu sync.Mutex
+	unhealthy := 0
+
+	for i := 0; i < hlsVerifyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for location := range work {
+				health := s.VerifyEpisode(location)
+				if !health.Healthy {
+					countMu.Lock()
+					unhealthy++
+					countMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, location := range locations {
+		work <- location
+	}
+	close(work)
+	wg.Wait()
+
+	s.removeStale(animeFolder, startedAt)
+	return len(locations), unhealthy
+}
+
+// VerifyEpisodeDir 校验刚生成的剧集目录
+func (s *HLSVerifyService) VerifyEpisodeDir(animeFolder string, episode string, episodeDir string) models.HLSHealth {
+	return s.VerifyEpisode(episodeLocation{
+		AnimeFolder: animeFolder,
+		Episode:     episode,
+		Dir:         episodeDir,
+		DiskName:    diskNameForPath(episodeDir),
+	})
+}
+
+// VerifyEpisode 检查播放列表、切片和时长，并保存结果
+func (s *HLSVerifyService) VerifyEpisode(location episodeLocation) models.HLSHealth {
+	health := checkEpisode(location)
+	s.save(&health)
+	return health
+}
+
+// checkEpisode 只做检查，不保存结果
+func checkEpisode(location episodeLocation) models.HLSHealth {
+	health := models.HLSHealth{
+		AnimeFolder: location.AnimeFolder,
+		Episode:     location.Episode,
+		StorageDisk: location.DiskName,
+		EpisodePath: location.Dir,
+		HasEndList:  true,
+		CheckedAt:   time.Now(),
+	}
+
+	var problems []string
+	playlists, err := episodeMediaPlaylists(location.Dir)
+	if err != nil {
+		problems = append(problems, err.Error())
+		health.HasEndList = false
+	}
+
+	for _, playlistPath := range playlists {
+		prefix := ""
+		if len(playlists) > 1 {
+			prefix = filepath.Base(filepath.Dir(playlistPath)) + ": "
+		}
+
+		playlist, err := parseMediaPlaylist(playlistPath)
+		if err != nil {
+			problems = append(problems, prefix+"播放列表无法解析: "+err.Error())
+			health.HasEndList = false
+			continue
+		}
+
+		if !playlist.HasEndList {
+			health.HasEndList = false
+			problems = append(problems, prefix+"缺少 #EXT-X-ENDLIST")
+		}
+		if len(playlist.Segments) == 0 {
+			problems = append(problems, prefix+"播放列表没有切片")
+			continue
+		}
+		if playlist.InitURI != "" {
+			if info, err := os.Stat(playlist.SegmentPath(playlist.InitURI)); err != nil || info.Size() == 0 {
+				problems = append(problems, prefix+"初始化分片缺失: "+playlist.InitURI)
+			}
+		}
+
+		missing, empty := 0, 0
+		for _, segment := range playlist.Segments {
+			info, err := os.Stat(playlist.SegmentPath(segment.URI))
+			if err != nil {
+				missing++
+			} else if info.Size() == 0 {
+				empty++
+			}
+		}
+		if missing > 0 {
+			problems = append(problems, fmt.Sprintf("%s%d 个切片缺失", prefix, missing))
+		}
+		if empty > 0 {
+			problems = append(problems, fmt.Sprintf("%s%d 个切片为空", prefix, empty))
+		}
+
+		health.SegmentCount += len(playlist.Segments)
+		health.MissingSegments += missing
+		health.EmptySegments += empty
+		if health.PlaylistDuration == 0 {
+			health.PlaylistDuration = playlist.TotalDuration
+		}
+
+		// 有切片缺失或为空时已经不健康，不再探测实际时长
+		if missing > 0 || empty > 0 {
+			continue
+		}
+		probed, err := probeSegmentsDuration(playlist)
+		if err != nil {
+			problems = append(problems, prefix+err.Error())
+			continue
+		}
+		if health.ProbedDuration == 0 {
+			health.ProbedDuration = probed
+		}
+		if math.Abs(probed-playlist.TotalDuration) > hlsDurationTolerance {
+			problems = append(problems, fmt.Sprintf("%s时长不一致: 播放列表 %.2f 秒, 实际 %.2f 秒", prefix, playlist.TotalDuration, probed))
+		}
+	}
+
+	health.Healthy = len(problems) == 0
+	if problemsJSON, err := json.Marshal(problems); err == nil {
+		health.Problems = string(problemsJSON)
+	}
+	return health
+}
+
+// ListHealth 查询校验结果，animeFolder 为空时返回全部
+func (s *HLSVerifyService) ListHealth(animeFolder string, unhealthyOnly bool) ([]models.HLSHealth, error) {
+	var results []models.HLSHealth
+
+	if !LocalMode && DB != nil {
+		query := DB.Order("anime_folder ASC, episode ASC")
+		if animeFolder != "" {
+			query = query.Where("anime_folder = ?", animeFolder)
+		}
+		if unhealthyOnly {
+			query = query.Where("healthy = ?", false)
+		}
+		result := query.Find(&results)
+		if result.Error != nil {
+			log.Printf("错误: 获取HLS校验结果失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return results, nil
+	}
+
+	s.mu.Lock()
+	for _, health := range s.local {
+		if (animeFolder == "" || health.AnimeFolder == animeFolder) && (!unhealthyOnly || !health.Healthy) {
+			results = append(results, health)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].AnimeFolder != results[j].AnimeFolder {
+			return results[i].AnimeFolder < results[j].AnimeFolder
+		}
+		return results[i].Episode < results[j].Episode
+	})
+	return results, nil
+}
+
+func (s *HLSVerifyService) Summary(results []models.HLSHealth) HLSHealthSummary {
+	summary := HLSHealthSummary{Total: len(results)}
+	for _, health := range results {
+		if health.Healthy {
+			summary.Healthy++
+		} else {
+			summary.Unhealthy++
+		}
+	}
+	return summary
+}
+
+// IsUnhealthy 判断剧集最近一次校验是否异常，从未校验过的剧集视为正常
+func (s *HLSVerifyService) IsUnhealthy(animeFolder string, episode string) bool {
+	if !LocalMode && DB != nil {
+		var count int64
+		DB.Model(&models.HLSHealth{}).
+			Where("anime_folder = ? AND episode = ? AND healthy = ?", animeFolder, episode, false).
+			Count(&count)
+		return count > 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health, exists := s.local[healthKey(animeFolder, episode)]
+	return exists && !health.Healthy
+}
+
+func (s *HLSVerifyService) save(health *models.HLSHealth) {
+	if !LocalMode && DB != nil {
+		var existing models.HLSHealth
+		result := DB.Where("anime_folder = ? AND episode = ?", health.AnimeFolder, health.Episode).First(&existing)
+		if result.Error == nil {
+			health.ID = existing.ID
+		}
+		if result := DB.Save(health); result.Error != nil {
+			log.Printf("错误: 保存HLS校验结果失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.local[healthKey(health.AnimeFolder, health.Episode)] = *health
+}
+
+// removeStale 删除本轮校验没有再出现的剧集（目录已被删除）
+func (s *HLSVerifyService) removeStale(animeFolder string, before time.Time) {
+	if !LocalMode && DB != nil {
+		query := DB.Where("checked_at < ?", before)
+		if animeFolder != "" {
+			query = query.Where("anime_folder = ?", animeFolder)
+		}
+		if result := query.Delete(&models.HLSHealth{}); result.Error != nil {
+			log.Printf("错误: 清理过期的HLS校验结果失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, health := range s.local {
+		if (animeFolder == "" || health.AnimeFolder == animeFolder) && health.CheckedAt.Before(before) {
+			delete(s.local, key)
+		}
+	}
+}
+
+func healthKey(animeFolder string, episode string) string {
+	return animeFolder + "/" + episode
+}
+
+// probeSegmentsDuration 把所有切片（fMP4 还有初始化分片）按顺序拼成一个 concat: 输入，
+// 只启动一次ffprobe探测切片的实际总时长。直接探测 .m3u8 得到的是 EXTINF 之和，无法发现切片被截断
+func probeSegmentsDuration(playlist *mediaPlaylist) (float64, error) {
+	dir := filepath.Dir(playlist.Path)
+	uris := make([]string, 0, len(playlist.Segments)+1)
+	if playlist.InitURI != "" {
+		uris = append(uris, playlist.InitURI)
+	}
+	for _, segment := range playlist.Segments {
+		uris = append(uris, segment.URI)
+	}
+
+	// 使用相对播放列表目录的路径，避免切片很多时参数过长
+	parts := make([]string, len(uris))
+	for i, uri := range uris {
+		rel, err := filepath.Rel(dir, playlist.SegmentPath(uri))
+		if err != nil || strings.Contains(rel, "|") {
+			return 0, fmt.Errorf("切片路径无法探测: %s", uri)
+		}
+		parts[i] = filepath.ToSlash(rel)
+	}
+
+	duration, err := probeDurationIn(dir, "concat:"+strings.Join(parts, "|"))
+	if err != nil {
+		return 0, fmt.Errorf("切片无法被ffprobe解析: %v", err)
+	}
+	return duration, nil
+}
+
+// listEpisodeLocations 列出所有磁盘（未配置磁盘时为默认HLS目录）下的剧集目录
+func listEpisodeLocations(animeFilter string) []episodeLocation {
+	type root struct {
+		path     string
+		diskName string
+	}
+
+	var roots []root
+	disks := StorageServiceInstance.GetAllDisks()
+	if len(disks) == 0 {
+		roots = append(roots, root{path: hlsDir})
+	}
+	for _, disk := range disks {
+		if disk.Enabled {
+			roots = append(roots, root{path: disk.Path, diskName: disk.Name})
+		}
+	}
+
+	var locations []episodeLocation
+	for _, r := range roots {
+		animeEntries, err := ioutil.ReadDir(r.path)
+		if err != nil {
+			continue
+		}
+		for _, animeEntry := range animeEntries {
+			if !animeEntry.IsDir() || (animeFilter != "" && animeEntry.Name() != animeFilter) {
+				continue
+			}
+			animePath := filepath.Join(r.path, animeEntry.Name())
+			episodeEntries, err := ioutil.ReadDir(animePath)
+			if err != nil {
+				continue
+			}
+			for _, episodeEntry := range episodeEntries {
+				// 跳过修复过程中的临时目录和备份目录
+				if !episodeEntry.IsDir() || strings.HasPrefix(episodeEntry.Name(), ".") {
+					continue
+				}
+				episodeDir := filepath.Join(animePath, episodeEntry.Name())
+				if _, found := findEpisodePlaylist(episodeDir); !found {
+					continue
+				}
+				locations = append(locations, episodeLocation{
+					AnimeFolder: animeEntry.Name(),
+					Episode:     episodeEntry.Name(),
+					Dir:         episodeDir,
+					DiskName:    r.diskName,
+				})
+			}
+		}
+	}
+	return locations
+}
+
+// diskNameForPath 根据路径前缀找到所在的存储磁盘
+func diskNameForPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for _, disk := range StorageServiceInstance.GetAllDisks() {
+		diskPath, err := filepath.Abs(disk.Path)
+		if err != nil {
+			continue
+		}
+		if absPath == diskPath || strings.HasPrefix(absPath, diskPath+string(filepath.Separator)) {
+			return disk.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeFFprobe 把 concat: 输入中每个文件的内容当作该文件的时长求和，代替真实的ffprobe
+const fakeFFprobe = `#!/bin/sh
+for arg; do input="$arg"; done
+echo "${input#concat:}" | tr '|' '\n' | while read -r file; do cat "$file"; echo; done | awk '{ total += $1 } END { print total }'
+`
+
+func installFakeFFprobe(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffprobe needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), []byte(fakeFFprobe), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// writeEpisode 写出播放列表，extinf 是播放列表中记录的时长，actual 是切片的实际时长
+func writeEpisode(t *testing.T, extinf []float64, actual []float64, fmp4 bool) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n")
+	if fmp4 {
+		playlist.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+		if err := os.WriteFile(filepath.Join(dir, "init.mp4"), []byte("0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, duration := range extinf {
+		name := fmt.Sprintf("segment_%03d.ts", i)
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n%s\n", duration, name)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fmt.Sprintf("%g", actual[i])), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	if err := os.WriteFile(filepath.Join(dir, variantPlaylistName), []byte(playlist.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCheckEpisodeDuration(t *testing.T) {
+	installFakeFFprobe(t)
+
+	tests := []struct {
+		name        string
+		extinf      []float64
+		actual      []float64
+		fmp4        bool
+		wantHealthy bool
+		wantProbed  float64
+	}{
+		{
+			name:        "segments match playlist",
+			extinf:      []float64{6, 6, 4.5},
+			actual:      []float64{6, 6, 4.5},
+			wantHealthy: true,
+			wantProbed:  16.5,
+		},
+		{
+			name:        "small drift within tolerance",
+			extinf:      []float64{6, 6, 6},
+			actual:      []float64{6, 5.5, 5.5},
+			wantHealthy: true,
+			wantProbed:  17,
+		},
+		{
+			name:        "truncated segment",
+			extinf:      []float64{6, 6, 6},
+			actual:      []float64{6, 6, 1},
+			wantHealthy: false,
+			wantProbed:  13,
+		},
+		{
+			name:        "segments longer than playlist",
+			extinf:      []float64{2, 2},
+			actual:      []float64{6, 6},
+			wantHealthy: false,
+			wantProbed:  12,
+		},
+		{
+			name:        "fmp4 with init segment",
+			extinf:      []float64{6, 6},
+			actual:      []float64{6, 2},
+			fmp4:        true,
+			wantHealthy: false,
+			wantProbed:  8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeEpisode(t, tt.extinf, tt.actual, tt.fmp4)
+			health := checkEpisode(episodeLocation{Dir: dir})
+
+			if health.Healthy != tt.wantHealthy {
+				t.Fatalf("Healthy = %v, want %v, problems: %s", health.Healthy, tt.wantHealthy, health.Problems)
+			}
+			if health.ProbedDuration != tt.wantProbed {
+				t.Fatalf("ProbedDuration = %v, want %v", health.ProbedDuration, tt.wantProbed)
+			}
+			if !tt.wantHealthy && !strings.Contains(health.Problems, "时长不一致") {
+				t.Fatalf("problems = %s, want 时长不一致", health.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,669 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/models"
+)
+
+const (
+	jobQueueSize      = 1024
+	jobSubscriberSize = 64
+	// 队列满时任务只保存在数据库中，由轮询定期放回队列
+	jobPollInterval = 30 * time.Second
+)
+
+type JobService struct {
+	queue    chan uint
+	mu       sync.Mutex
+	runtimes map[uint]*jobRuntime
+	localJob map[uint]*models.TranscodeJob
+	// pending 是已放入队列、还没被工作协程取出的任务，避免轮询重复放入
+	pending map[uint]bool
+	nextID  uint
+}
+
+type jobRuntime struct {
+	stopChan    chan struct{}
+	stopOnce    sync.Once
+	subscribers map[chan map[string]interface{}]struct{}
+}
+
+var JobServiceInstance = &JobService{}
+
+// Start 启动转码任务工作池，并把上次未完成的任务重新放回队列
+func (s *JobService) Start(workers int) {
+	s.queue = make(chan uint, jobQueueSize)
+	s.runtimes = make(map[uint]*jobRuntime)
+	s.localJob = make(map[uint]*models.TranscodeJob)
+	s.pending = make(map[uint]bool)
+
+	if !LocalMode && DB != nil {
+		result := DB.Model(&models.TranscodeJob{}).
+			Where("status = ?", models.JobStatusRunning).
+			Updates(map[string]interface{}{"status": models.JobStatusQueued, "message": "服务重启，任务重新排队"})
+		if result.Error != nil {
+			log.Printf("错误: 重置中断的转码任务失败: %v\n", result.Error)
+		}
+	}
+
+	// 先启动工作协程，再由轮询把上次未完成的任务放回队列
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	go s.pollQueued()
+	log.Printf("转码任务队列已启动，工作协程数: %d\n", workers)
+}
+
+// pollQueued 定期把数据库中排队的任务放回队列，启动时立即执行一次
+func (s *JobService) pollQueued() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		ids := s.queuedJobIDs()
+		dispatched := 0
+		for _, id := range ids {
+			if s.dispatch(id) {
+				dispatched++
+			}
+		}
+		if first && len(ids) > 0 {
+			log.Printf("恢复 %d 个待处理的转码任务\n", len(ids))
+		}
+		if dispatched < len(ids) {
+			log.Printf("警告: 任务队列已满，%d 个任务稍后处理\n", len(ids)-dispatched)
+		}
+		<-ticker.C
+	}
+}
+
+// dispatch 不阻塞地把任务放入队列。队列已满时返回 false，任务仍是排队状态，由轮询稍后放入
+func (s *JobService) dispatch(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[id] {
+		return true
+	}
+	select {
+	case s.queue <- id:
+		s.pending[id] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// queuedJobIDs 按创建顺序返回排队中的任务，最多一个队列的长度
+func (s *JobService) queuedJobIDs() []uint {
+	var ids []uint
+	if !LocalMode && DB != nil {
+		result := DB.Model(&models.TranscodeJob{}).
+			Where("status = ?", models.JobStatusQueued).
+			Order("id ASC").Limit(jobQueueSize).Pluck("id", &ids)
+		if result.Error != nil {
+			log.Printf("错误: 加载待处理转码任务失败: %v\n", result.Error)
+		}
+		return ids
+	}
+
+	s.mu.Lock()
+	for id, job := range s.localJob {
+		if job.Status == models.JobStatusQueued {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > jobQueueSize {
+		ids = ids[:jobQueueSize]
+	}
+	return ids
+}
+
+func (s *JobService) Enqueue(videos []string, profileName string, userID uint) (*models.TranscodeJob, error) {
+	profile, err := ResolveProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	return s.enqueue(models.TranscodeJob{Type: models.JobTypeTranscode, Profile: profile.Name, CreatedBy: userID}, videos)
+}
+
+// EnqueueRepair 为最近一次校验异常的剧集创建修复任务
+func (s *JobService) EnqueueRepair(animeFolder string, episode string, userID uint) (*models.TranscodeJob, error) {
+	profile, err := ResolveProfile(config.Get().Transcode.RepairProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := HLSVerifyServiceInstance.RepairTargets(animeFolder, episode)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, &UserError{Message: "没有需要修复的剧集，请先校验HLS切片"}
+	}
+	return s.enqueue(models.TranscodeJob{Type: models.JobTypeRepair, Profile: profile.Name, CreatedBy: userID}, targets)
+}
+
+// EnqueueMigrate 创建把动画迁移到 targetDisk 的任务，targetDisk 为空时按分配策略为每部动画选择其他磁盘
+func (s *JobService) EnqueueMigrate(folders []string, targetDisk string, userID uint) (*models.TranscodeJob, error) {
+	if len(folders) == 0 {
+		return nil, &UserError{Message: "没有需要迁移的动画"}
+	}
+	if err := StorageServiceInstance.CheckMigrateTarget(targetDisk); err != nil {
+		return nil, err
+	}
+	return s.enqueue(models.TranscodeJob{Type: models.JobTypeMigrate, Target: targetDisk, CreatedBy: userID}, folders)
+}
+
+// EnqueueDrain 把磁盘上的所有动画迁移到其他磁盘
+func (s *JobService) EnqueueDrain(diskName string, targetDisk string, userID uint) (*models.TranscodeJob, error) {
+	if diskName == targetDisk {
+		return nil, &UserError{Message: "目标磁盘不能是要清空的磁盘"}
+	}
+	folders, err := StorageServiceInstance.AnimesOnDisk(diskName)
+	if err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, &UserError{Message: "磁盘上没有动画: " + diskName}
+	}
+	return s.EnqueueMigrate(folders, targetDisk, userID)
+}
+
+// enqueue 保存任务并放入队列，job 中只需填好类型、配置、目标和创建者
+func (s *JobService) enqueue(job models.TranscodeJob, videos []string) (*models.TranscodeJob, error) {
+	videosJSON, err := json.Marshal(videos)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Status = models.JobStatusQueued
+	job.Videos = string(videosJSON)
+	job.Total = len(videos)
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = time.Now()
+
+	if err := s.create(&job); err != nil {
+		return nil, err
+	}
+
+	if !s.dispatch(job.ID) {
+		log.Printf("警告: 任务队列已满，任务 %d 稍后处理\n", job.ID)
+	}
+	if job.Type == models.JobTypeMigrate {
+		log.Printf("%s任务 %d 已加入队列，共 %d 项，目标磁盘: %s\n", job.Type, job.ID, job.Total, job.Target)
+	} else {
+		log.Printf("%s任务 %d 已加入队列，共 %d 项，转码配置: %s\n", job.Type, job.ID, job.Total, job.Profile)
+	}
+	return &job, nil
+}
+
+func (s *JobService) GetJob(id uint) (*models.TranscodeJob, error) {
+	if !LocalMode && DB != nil {
+		var job models.TranscodeJob
+		result := DB.First(&job, id)
+		if result.Error != nil {
+			return nil, &UserError{Message: "任务不存在"}
+		}
+		return &job, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.localJob[id]
+	if !exists {
+		return nil, &UserError{Message: "任务不存在"}
+	}
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+func (s *JobService) ListJobs(status string, limit int) ([]models.TranscodeJob, error) {
+	var jobs []models.TranscodeJob
+
+	if !LocalMode && DB != nil {
+		query := DB.Order("id DESC").Limit(limit)
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		result := query.Find(&jobs)
+		if result.Error != nil {
+			log.Printf("错误: 获取转码任务列表失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return jobs, nil
+	}
+
+	s.mu.Lock()
+	for _, job := range s.localJob {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, *job)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID > jobs[j].ID
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// CancelResult 说明取消请求实际产生的效果
+type CancelResult string
+
+const (
+	// CancelQueued 任务还在排队，已直接取消
+	CancelQueued CancelResult = "cancelled"
+	// CancelStopRequested 任务正在运行，已通知它停止，任务稍后以已取消结束
+	CancelStopRequested CancelResult = "stopping"
+	// CancelFinished 任务已经结束，没有可停止的内容
+	CancelFinished CancelResult = "finished"
+)
+
+func (s *JobService) Cancel(id uint) (CancelResult, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Status == models.JobStatusQueued {
+		cancelled, err := s.cancelQueued(id)
+		if err != nil {
+			return "", err
+		}
+		if cancelled {
+			s.closeSubscribers(id)
+			return CancelQueued, nil
+		}
+		// 任务刚被工作协程取走，改为停止运行中的任务
+		if job, err = s.GetJob(id); err != nil {
+			return "", err
+		}
+	}
+
+	if job.Status != models.JobStatusRunning {
+		return CancelFinished, nil
+	}
+
+	// 任务刚被领取时运行状态可能还没建立，这里先建立，run 会用同一个 stopChan
+	s.mu.Lock()
+	runtime := s.runtimeLocked(id)
+	runtime.stopOnce.Do(func() { close(runtime.stopChan) })
+	s.mu.Unlock()
+
+	// 检查期间任务可能已经结束，清理刚建立的运行状态
+	if job, err := s.GetJob(id); err == nil && job.Finished() {
+		s.closeSubscribers(id)
+		if job.Status != models.JobStatusCancelled {
+			return CancelFinished, nil
+		}
+	}
+	return CancelStopRequested, nil
+}
+
+func (s *JobService) Retry(id uint) (*models.TranscodeJob, error) {
+	job, err := s.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != models.JobStatusFailed && job.Status != models.JobStatusCancelled {
+		return nil, &UserError{Message: "只有失败或已取消的任务可以重试"}
+	}
+
+	job.Status = models.JobStatusQueued
+	job.Success = 0
+	job.Failed = 0
+	job.Skipped = 0
+	job.Errors = ""
+	job.Message = "任务重新排队"
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	if err := s.save(job); err != nil {
+		return nil, err
+	}
+
+	if !s.dispatch(job.ID) {
+		log.Printf("警告: 任务队列已满，任务 %d 稍后处理\n", job.ID)
+	}
+	return job, nil
+}
+
+// cancelQueued 只在任务仍在排队时把它改为已取消，任务已被工作协程取走时返回 false
+func (s *JobService) cancelQueued(id uint) (bool, error) {
+	now := time.Now()
+	if !LocalMode && DB != nil {
+		result := DB.Model(&models.TranscodeJob{}).
+			Where("id = ? AND status = ?", id, models.JobStatusQueued).
+			Updates(map[string]interface{}{
+				"status":      models.JobStatusCancelled,
+				"message":     "任务已取消",
+				"finished_at": now,
+				"updated_at":  now,
+			})
+		if result.Error != nil {
+			log.Printf("错误: 取消转码任务 %d 失败: %v\n", id, result.Error)
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.localJob[id]
+	if !exists || job.Status != models.JobStatusQueued {
+		return false, nil
+	}
+	job.Status = models.JobStatusCancelled
+	job.Message = "任务已取消"
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+	return true, nil
+}
+
+// claim 只在任务仍在排队时把它改为运行中，任务已被取消或被其他工作协程取走时返回 false
+func (s *JobService) claim(id uint) (*models.TranscodeJob, bool) {
+	now := time.Now()
+	if !LocalMode && DB != nil {
+		result := DB.Model(&models.TranscodeJob{}).
+			Where("id = ? AND status = ?", id, models.JobStatusQueued).
+			Updates(map[string]interface{}{
+				"status":     models.JobStatusRunning,
+				"started_at": now,
+				"message":    "",
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			log.Printf("错误: 领取转码任务 %d 失败: %v\n", id, result.Error)
+			return nil, false
+		}
+		if result.RowsAffected == 0 {
+			return nil, false
+		}
+		job, err := s.GetJob(id)
+		if err != nil {
+			return nil, false
+		}
+		// 领取后立即建立运行状态，之后的取消请求才能停止它
+		s.mu.Lock()
+		s.runtimeLocked(id)
+		s.mu.Unlock()
+		return job, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.localJob[id]
+	if !exists || job.Status != models.JobStatusQueued {
+		return nil, false
+	}
+	job.Status = models.JobStatusRunning
+	job.StartedAt = &now
+	job.Message = ""
+	job.UpdatedAt = now
+	s.runtimeLocked(id)
+	jobCopy := *job
+	return &jobCopy, true
+}
+
+// Subscribe 订阅任务事件，任务结束后通道会被关闭
+func (s *JobService) Subscribe(id uint) (<-chan map[string]interface{}, func(), error) {
+	if _, err := s.GetJob(id); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan map[string]interface{}, jobSubscriberSize)
+
+	s.mu.Lock()
+	runtime := s.runtimeLocked(id)
+	runtime.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	// 订阅期间任务可能已经结束，此时直接关闭通道
+	if job, err := s.GetJob(id); err == nil && job.Finished() {
+		s.closeSubscribers(id)
+	}
+
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if runtime, exists := s.runtimes[id]; exists {
+			if _, subscribed := runtime.subscribers[ch]; subscribed {
+				delete(runtime.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+
+	return ch, unsubscribe, nil
+}
+
+func (s *JobService) worker() {
+	for id := range s.queue {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+
+		job, claimed := s.claim(id)
+		if !claimed {
+			continue
+		}
+		s.run(job)
+	}
+}
+
+func (s *JobService) run(job *models.TranscodeJob) {
+	s.mu.Lock()
+	runtime := s.runtimeLocked(job.ID)
+	s.mu.Unlock()
+
+	log.Printf("开始执行转码任务 %d\n", job.ID)
+
+	videos := job.VideoList()
+
+	// 配置可能在任务排队期间被修改，运行时重新解析。迁移任务不需要转码配置
+	var profile config.TranscodeProfile
+	var err error
+	if job.Type != models.JobTypeMigrate {
+		profile, err = ResolveProfile(job.Profile)
+	}
+	if err != nil {
+		finished := time.Now()
+		job.Status = models.JobStatusFailed
+		job.Message = err.Error()
+		job.FinishedAt = &finished
+		s.save(job)
+		s.closeSubscribers(job.ID)
+		log.Printf("转码任务 %d 失败: %v\n", job.ID, err)
+		return
+	}
+
+	progressChan := make(chan map[string]interface{}, jobSubscriberSize)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for event := range progressChan {
+			switch event["type"] {
+			case "success":
+				job.Success++
+				s.save(job)
+			case "error":
+				job.Failed++
+				s.save(job)
+			case "skipped":
+				job.Skipped++
+				s.save(job)
+			}
+			event["jobId"] = job.ID
+			s.publish(job.ID, event)
+		}
+	}()
+
+	var total, success, failed, skipped int
+	var errors []string
+	switch job.Type {
+	case models.JobTypeRepair:
+		total, success, failed, skipped, errors = VideoServiceInstance.BatchRepairHLS(videos, profile, progressChan, runtime.stopChan)
+	case models.JobTypeMigrate:
+		total, success, failed, skipped, errors = StorageServiceInstance.BatchMigrate(videos, job.Target, progressChan, runtime.stopChan)
+	default:
+		total, success, failed, skipped, errors = VideoServiceInstance.BatchGenerateHLS(videos, profile, progressChan, runtime.stopChan)
+	}
+	close(progressChan)
+	<-done
+
+	finished := time.Now()
+	job.Total = total
+	job.Success = success
+	job.Failed = failed
+	job.Skipped = skipped
+	job.FinishedAt = &finished
+	if errorsJSON, err := json.Marshal(errors); err == nil {
+		job.Errors = string(errorsJSON)
+	}
+
+	select {
+	case <-runtime.stopChan:
+		job.Status = models.JobStatusCancelled
+		job.Message = "任务已停止"
+	default:
+		if failed > 0 {
+			job.Status = models.JobStatusFailed
+			job.Message = "部分视频处理失败"
+		} else {
+			job.Status = models.JobStatusSucceeded
+			job.Message = "任务完成"
+		}
+	}
+	s.save(job)
+	s.closeSubscribers(job.ID)
+	log.Printf("转码任务 %d 结束: %s, 成功 %d, 失败 %d, 跳过 %d\n", job.ID, job.Status, success, failed, skipped)
+
+	s.syncAnimeDirectories(job.Type, videos)
+}
+
+func (s *JobService) syncAnimeDirectories(jobType string, videos []string) {
+	directories := []string{}
+	for _, videoPath := range videos {
+		var dirName string
+		switch jobType {
+		case models.JobTypeRepair:
+			dirName, _, _ = strings.Cut(videoPath, "/")
+		case models.JobTypeMigrate:
+			dirName = videoPath
+		default:
+			dirName = VideoServiceInstance.ExtractAnimeDirectory(videoPath)
+		}
+		if dirName != "" {
+			directories = append(directories, dirName)
+		}
+	}
+
+	if len(directories) == 0 {
+		log.Println("批量处理完成，没有需要同步的动画目录")
+		return
+	}
+
+	// SyncAnime 会在所有磁盘中查找动画目录，并导入元数据、更新搜索索引
+	log.Println("开始同步处理过的动画到数据库...")
+	synced := make(map[string]bool)
+	for _, dirName := range directories {
+		if synced[dirName] {
+			continue
+		}
+		synced[dirName] = true
+		VideoServiceInstance.SyncAnime(dirName)
+	}
+	log.Printf("同步完成，共 %d 个动画目录\n", len(synced))
+}
+
+func (s *JobService) publish(id uint, event map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runtime, exists := s.runtimes[id]
+	if !exists {
+		return
+	}
+	for ch := range runtime.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (s *JobService) closeSubscribers(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runtime, exists := s.runtimes[id]
+	if !exists {
+		return
+	}
+	for ch := range runtime.subscribers {
+		close(ch)
+	}
+	delete(s.runtimes, id)
+}
+
+func (s *JobService) runtimeLocked(id uint) *jobRuntime {
+	runtime, exists := s.runtimes[id]
+	if !exists {
+		runtime = &jobRuntime{
+			stopChan:    make(chan struct{}),
+			subscribers: make(map[chan map[string]interface{}]struct{}),
+		}
+		s.runtimes[id] = runtime
+	}
+	return runtime
+}
+
+func (s *JobService) create(job *models.TranscodeJob) error {
+	if !LocalMode && DB != nil {
+		result := DB.Create(job)
+		if result.Error != nil {
+			log.Printf("错误: 创建转码任务失败: %v\n", result.Error)
+		}
+		return result.Error
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	job.ID = s.nextID
+	jobCopy := *job
+	s.localJob[job.ID] = &jobCopy
+	return nil
+}
+
+func (s *JobService) save(job *models.TranscodeJob) error {
+	job.UpdatedAt = time.Now()
+
+	if !LocalMode && DB != nil {
+		result := DB.Save(job)
+		if result.Error != nil {
+			log.Printf("错误: 保存转码任务 %d 失败: %v\n", job.ID, result.Error)
+		}
+		return result.Error
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobCopy := *job
+	s.localJob[job.ID] = &jobCopy
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	"anime-website/models"
+)
+
+func newTestJobService() *JobService {
+	return &JobService{
+		runtimes: make(map[uint]*jobRuntime),
+		localJob: make(map[uint]*models.TranscodeJob),
+		pending:  make(map[uint]bool),
+	}
+}
+
+func TestJobServiceCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		// claimed 表示任务已被工作协程领取，但 run 还没建立运行状态
+		claimed    bool
+		want       CancelResult
+		wantStatus string
+		wantStop   bool
+	}{
+		{name: "queued job cancelled", status: models.JobStatusQueued, want: CancelQueued, wantStatus: models.JobStatusCancelled},
+		{name: "claimed job asked to stop", status: models.JobStatusQueued, claimed: true, want: CancelStopRequested, wantStatus: models.JobStatusRunning, wantStop: true},
+		{name: "finished job left alone", status: models.JobStatusSucceeded, want: CancelFinished, wantStatus: models.JobStatusSucceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestJobService()
+			job := &models.TranscodeJob{Type: models.JobTypeTranscode, Status: tt.status}
+			if err := s.create(job); err != nil {
+				t.Fatal(err)
+			}
+			if tt.claimed {
+				if _, claimed := s.claim(job.ID); !claimed {
+					t.Fatal("任务没有被领取")
+				}
+			}
+
+			got, err := s.Cancel(job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Cancel = %q, want %q", got, tt.want)
+			}
+
+			current, err := s.GetJob(job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", current.Status, tt.wantStatus)
+			}
+
+			runtime, exists := s.runtimes[job.ID]
+			if !tt.wantStop {
+				if exists {
+					t.Fatal("没有运行的任务留下了运行状态")
+				}
+				return
+			}
+			if !exists {
+				t.Fatal("运行中的任务没有运行状态")
+			}
+			select {
+			case <-runtime.stopChan:
+			default:
+				t.Fatal("运行中的任务没有收到停止信号")
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"anime-website/models"
+)
+
+const (
+	maxTagNameLength = 100
+	maxRating        = 10
+	minAnimeYear     = 1900
+	maxAnimeYear     = 2100
+)
+
+var validAnimeSeasons = map[string]bool{
+	models.AnimeSeasonWinter: true,
+	models.AnimeSeasonSpring: true,
+	models.AnimeSeasonSummer: true,
+	models.AnimeSeasonFall:   true,
+}
+
+var validAnimeStatuses = map[string]bool{
+	models.AnimeStatusUpcoming: true,
+	models.AnimeStatusAiring:   true,
+	models.AnimeStatusFinished: true,
+}
+
+type MetadataService struct{}
+
+var MetadataServiceInstance = &MetadataService{}
+
+// AnimeMetadata 是一次元数据修改，为 nil 的字段保持不变，空列表表示清空
+type AnimeMetadata struct {
+	Title         *string   `json:"title"`
+	Summary       *string   `json:"summary"`
+	OriginalTitle *string   `json:"original_title"`
+	AltTitles     *[]string `json:"alt_titles"`
+	Year          *int      `json:"year"`
+	Season        *string   `json:"season"`
+	Studio        *string   `json:"studio"`
+	Status        *string   `json:"status"`
+	Rating        *float64  `json:"rating"`
+	Tags          *[]string `json:"tags"`
+	Genres        *[]string `json:"genres"`
+}
+
+// AnimeFilter 是首页和搜索的筛选条件，零值字段不参与筛选
+type AnimeFilter struct {
+	Tag       string  `json:"tag"`
+	Genre     string  `json:"genre"`
+	Year      int     `json:"year"`
+	Season    string  `json:"season"`
+	Studio    string  `json:"studio"`
+	Status    string  `json:"status"`
+	MinRating float64 `json:"minRating"`
+}
+
+// GetAnime 返回动画及其标签
+func (s *MetadataService) GetAnime(id uint) (*models.AnimeInfo, error) {
+	if LocalMode || DB == nil {
+		return nil, &UserError{Message: "本地模式不支持动画元数据"}
+	}
+
+	var anime models.AnimeInfo
+	if result := DB.Preload("Tags").First(&anime, id); result.Error != nil {
+		return nil, &UserError{Message: "找不到指定的动画"}
+	}
+	return &anime, nil
+}
+
+// UpdateMetadata 校验并保存动画元数据，标签和类型整体替换
+func (s *MetadataService) UpdateMetadata(id uint, metadata AnimeMetadata) (*models.AnimeInfo, error) {
+	if err := metadata.Validate(); err != nil {
+		return nil, err
+	}
+
+	anime, err := s.GetAnime(id)
+	if err != nil {
+		return nil, err
+	}
+	metadata.apply(anime)
+	// 手动修改过的字段之后不会被扫描或元数据文件覆盖
+	anime.LockFields(metadata.fields()...)
+	anime.UpdatedAt = time.Now()
+
+	if result := DB.Omit("Tags").Save(anime); result.Error != nil {
+		log.Printf("错误: 保存动画 %s 元数据失败: %v\n", anime.FolderName, result.Error)
+		return nil, result.Error
+	}
+
+	names := make(map[string][]string)
+	if metadata.Tags != nil {
+		names[models.TagKindTag] = *metadata.Tags
+	}
+	if metadata.Genres != nil {
+		names[models.TagKindGenre] = *metadata.Genres
+	}
+	if err := s.replaceTags(anime, names); err != nil {
+		return nil, err
+	}
+	SearchServiceInstance.IndexAnime(*anime)
+	return anime, nil
+}
+
+// ImportTags 用扫描时从元数据文件读到的标签和类型替换动画原有的，手动编辑过的一类保持不变
+func (s *MetadataService) ImportTags(anime *models.AnimeInfo, tags []models.Tag) {
+	if LocalMode || DB == nil || len(tags) == 0 {
+		return
+	}
+
+	names := make(map[string][]string)
+	for _, tag := range tags {
+		field := models.AnimeFieldTags
+		if tag.Kind == models.TagKindGenre {
+			field = models.AnimeFieldGenres
+		}
+		if !anime.FieldLocked(field) {
+			names[tag.Kind] = append(names[tag.Kind], tag.Name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	if err := DB.Model(anime).Association("Tags").Find(&anime.Tags); err != nil {
+		log.Printf("错误: 获取动画 %s 标签失败: %v\n", anime.FolderName, err)
+		return
+	}
+	s.replaceTags(anime, names)
+}
+
+// replaceTags 替换 names 中列出的几类标签，其余类别保留原来的
+func (s *MetadataService) replaceTags(anime *models.AnimeInfo, names map[string][]string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	var tags []models.Tag
+	for _, tag := range anime.Tags {
+		if _, replaced := names[tag.Kind]; !replaced {
+			tags = append(tags, tag)
+		}
+	}
+	for kind, kindNames := range names {
+		found, err := s.findOrCreateTags(kindNames, kind)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, found...)
+	}
+
+	if err := DB.Model(anime).Association("Tags").Replace(tags); err != nil {
+		log.Printf("错误: 保存动画 %s 标签失败: %v\n", anime.FolderName, err)
+		return err
+	}
+	anime.Tags = tags
+	return nil
+}
+
+// ListTags 列出所有标签，kind 不为空时只返回该类
+func (s *MetadataService) ListTags(kind string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if LocalMode || DB == nil {
+		return tags, nil
+	}
+
+	query := DB.Order("name ASC")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if result := query.Find(&tags); result.Error != nil {
+		log.Printf("错误: 获取标签失败: %v\n", result.Error)
+		return nil, result.Error
+	}
+	return tags, nil
+}
+
+// ClearTags 删除动画与标签的关联，彻底删除动画前调用
+func (s *MetadataService) ClearTags(animeID uint) {
+	if LocalMode || DB == nil || animeID == 0 {
+		return
+	}
+	if err := DB.Model(&models.AnimeInfo{ID: animeID}).Association("Tags").Clear(); err != nil {
+		log.Printf("错误: 删除动画 %d 的标签失败: %v\n", animeID, err)
+	}
+}
+
+func (s *MetadataService) findOrCreateTags(names []string, kind string) ([]models.Tag, error) {
+	var tags []models.Tag
+	for _, name := range names {
+		tag := models.Tag{Name: name, Kind: kind}
+		if result := DB.Where("name = ? AND kind = ?", name, kind).FirstOrCreate(&tag); result.Error != nil {
+			log.Printf("错误: 创建标签 %s 失败: %v\n", name, result.Error)
+			return nil, result.Error
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Validate 检查元数据取值是否有效，并整理标题和标签中的空白
+func (m *AnimeMetadata) Validate() error {
+	if m.Title != nil {
+		title := strings.TrimSpace(*m.Title)
+		if title == "" {
+			return &UserError{Message: "动画标题不能为空"}
+		}
+		m.Title = &title
+	}
+	if m.Year != nil && *m.Year != 0 && (*m.Year < minAnimeYear || *m.Year > maxAnimeYear) {
+		return &UserError{Message: "无效的年份"}
+	}
+	if m.Season != nil && *m.Season != "" && !validAnimeSeasons[*m.Season] {
+		return &UserError{Message: "无效的放送季度: " + *m.Season}
+	}
+	if m.Status != nil && *m.Status != "" && !validAnimeStatuses[*m.Status] {
+		return &UserError{Message: "无效的放送状态: " + *m.Status}
+	}
+	if m.Rating != nil && (*m.Rating < 0 || *m.Rating > maxRating) {
+		return &UserError{Message: "评分必须在 0 到 10 之间"}
+	}
+
+	if m.AltTitles != nil {
+		*m.AltTitles = cleanNames(*m.AltTitles)
+	}
+	for _, names := range []*[]string{m.Tags, m.Genres} {
+		if names == nil {
+			continue
+		}
+		*names = cleanNames(*names)
+		for _, name := range *names {
+			if len([]rune(name)) > maxTagNameLength {
+				return &UserError{Message: "标签过长: " + name}
+			}
+		}
+	}
+	return nil
+}
+
+func (m AnimeMetadata) apply(anime *models.AnimeInfo) {
+	if m.Title != nil {
+		anime.Title = *m.Title
+	}
+	if m.Summary != nil {
+		anime.Summary = *m.Summary
+	}
+	if m.OriginalTitle != nil {
+		anime.OriginalTitle = strings.TrimSpace(*m.OriginalTitle)
+	}
+	if m.AltTitles != nil {
+		anime.AltTitles = strings.Join(*m.AltTitles, "\n")
+	}
+	if m.Year != nil {
+		anime.Year = *m.Year
+	}
+	if m.Season != nil {
+		anime.Season = *m.Season
+	}
+	if m.Studio != nil {
+		anime.Studio = strings.TrimSpace(*m.Studio)
+	}
+	if m.Status != nil {
+		anime.Status = *m.Status
+	}
+	if m.Rating != nil {
+		anime.Rating = *m.Rating
+	}
+}
+
+// fields 返回这次修改涉及的字段
+func (m AnimeMetadata) fields() []string {
+	var fields []string
+	for field, set := range map[string]bool{
+		models.AnimeFieldTitle:         m.Title != nil,
+		models.AnimeFieldSummary:       m.Summary != nil,
+		models.AnimeFieldOriginalTitle: m.OriginalTitle != nil,
+		models.AnimeFieldAltTitles:     m.AltTitles != nil,
+		models.AnimeFieldYear:          m.Year != nil,
+		models.AnimeFieldSeason:        m.Season != nil,
+		models.AnimeFieldStudio:        m.Studio != nil,
+		models.AnimeFieldStatus:        m.Status != nil,
+		models.AnimeFieldRating:        m.Rating != nil,
+		models.AnimeFieldTags:          m.Tags != nil,
+		models.AnimeFieldGenres:        m.Genres != nil,
+	} {
+		if set {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// mergeScannedMetadata 把扫描得到的信息写入已有的动画记录，跳过手动编辑过的字段。
+// 标题、简介和封面每次扫描都会更新，其余元数据只在元数据文件中有值时更新
+func mergeScannedMetadata(existing *models.AnimeInfo, scanned models.AnimeInfo) {
+	setString := func(field string, target *string, value string, always bool) {
+		if !existing.FieldLocked(field) && (always || value != "") {
+			*target = value
+		}
+	}
+	setString(models.AnimeFieldTitle, &existing.Title, scanned.Title, true)
+	setString(models.AnimeFieldSummary, &existing.Summary, scanned.Summary, true)
+	setString(models.AnimeFieldCover, &existing.Cover, scanned.Cover, true)
+	setString(models.AnimeFieldOriginalTitle, &existing.OriginalTitle, scanned.OriginalTitle, false)
+	setString(models.AnimeFieldAltTitles, &existing.AltTitles, scanned.AltTitles, false)
+	setString(models.AnimeFieldSeason, &existing.Season, scanned.Season, false)
+	setString(models.AnimeFieldStudio, &existing.Studio, scanned.Studio, false)
+	setString(models.AnimeFieldStatus, &existing.Status, scanned.Status, false)
+	setString(models.AnimeFieldFanart, &existing.Fanart, scanned.Fanart, false)
+
+	if !existing.FieldLocked(models.AnimeFieldYear) && scanned.Year != 0 {
+		existing.Year = scanned.Year
+	}
+	if !existing.FieldLocked(models.AnimeFieldRating) && scanned.Rating != 0 {
+		existing.Rating = scanned.Rating
+	}
+}
+
+// cleanNames 去掉空白和重复项，重复不区分大小写
+func cleanNames(names []string) []string {
+	cleaned := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, name)
+	}
+	return cleaned
+}
+
+// SplitNames 拆分用逗号或换行分隔的列表，用于表单输入
+func SplitNames(value string) []string {
+	return cleanNames(strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '，' || r == '\n' || r == '、'
+	}))
+}
+
+// IsEmpty 判断是否没有任何筛选条件
+func (f AnimeFilter) IsEmpty() bool {
+	return f == AnimeFilter{}
+}
+
+// Match 判断动画是否满足所有筛选条件
+func (f AnimeFilter) Match(anime models.AnimeInfo) bool {
+	if f.Year != 0 && anime.Year != f.Year {
+		return false
+	}
+	if f.Season != "" && anime.Season != f.Season {
+		return false
+	}
+	if f.Status != "" && anime.Status != f.Status {
+		return false
+	}
+	if f.Studio != "" && !strings.EqualFold(anime.Studio, f.Studio) {
+		return false
+	}
+	if f.MinRating > 0 && anime.Rating < f.MinRating {
+		return false
+	}
+	if f.Tag != "" && !hasTag(anime, f.Tag, models.TagKindTag) {
+		return false
+	}
+	if f.Genre != "" && !hasTag(anime, f.Genre, models.TagKindGenre) {
+		return false
+	}
+	return true
+}
+
+// FilterAnimes 返回满足筛选条件的动画
+func FilterAnimes(animes []models.AnimeInfo, filter AnimeFilter) []models.AnimeInfo {
+	if filter.IsEmpty() {
+		return animes
+	}
+
+	var filtered []models.AnimeInfo
+	for _, anime := range animes {
+		if filter.Match(anime) {
+			filtered = append(filtered, anime)
+		}
+	}
+	return filtered
+}
+
+func hasTag(anime models.AnimeInfo, name string, kind string) bool {
+	for _, tag := range anime.Tags {
+		if tag.Kind == kind && strings.EqualFold(tag.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// Storage.Strategy 可选的磁盘分配策略
+const (
+	StrategyRoundRobin   = "round-robin"
+	StrategyLeastUsed    = "least-used"
+	StrategyRandom       = "random"
+	StrategyWeightedFree = "weighted-free"
+	StrategyPriority     = "priority"
+	StrategySticky       = "sticky"
+)
+
+// PlacementStrategy 从能放下本次写入的磁盘中选出一个。candidates 不为空，调用方已持有 StorageService 的锁
+type PlacementStrategy interface {
+	Select(animeName string, candidates []*Disk) *Disk
+}
+
+// NewPlacementStrategy 按名称创建分配策略，未知的名称使用 least-used
+func NewPlacementStrategy(name string) PlacementStrategy {
+	switch name {
+	case StrategyRoundRobin:
+		return &roundRobinStrategy{}
+	case StrategyLeastUsed, "":
+		return leastUsedStrategy{}
+	case StrategyRandom:
+		return randomStrategy{}
+	case StrategyWeightedFree:
+		return weightedFreeStrategy{}
+	case StrategyPriority:
+		return priorityStrategy{}
+	case StrategySticky:
+		return stickyStrategy{fallback: leastUsedStrategy{}}
+	}
+	log.Printf("警告: 未知的磁盘分配策略 %s，使用 %s\n", name, StrategyLeastUsed)
+	return leastUsedStrategy{}
+}
+
+// roundRobinStrategy 依次轮流使用各个磁盘
+type roundRobinStrategy struct {
+	next int
+}
+
+func (s *roundRobinStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	disk := candidates[s.next%len(candidates)]
+	s.next = (s.next + 1) % len(candidates)
+	return disk
+}
+
+// leastUsedStrategy 选择已用空间（含预留）最少的磁盘
+type leastUsedStrategy struct{}
+
+func (leastUsedStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	var best *Disk
+	minUsage := math.MaxFloat64
+	for _, disk := range candidates {
+		if usage := disk.UsedGB + disk.ReservedGB(); usage < minUsage {
+			minUsage = usage
+			best = disk
+		}
+	}
+	return best
+}
+
+// randomStrategy 随机选择一个磁盘。rng 为 nil 时使用全局随机数
+type randomStrategy struct {
+	rng *rand.Rand
+}
+
+func (s randomStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	if s.rng == nil {
+		return candidates[rand.IntN(len(candidates))]
+	}
+	return candidates[s.rng.IntN(len(candidates))]
+}
+
+// weightedFreeStrategy 按剩余空间加权随机选择，空间越大越容易被选中。rng 为 nil 时使用全局随机数
+type weightedFreeStrategy struct {
+	rng *rand.Rand
+}
+
+func (s weightedFreeStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	total := 0.0
+	weights := make([]float64, len(candidates))
+	for i, disk := range candidates {
+		weights[i] = math.Max(disk.FreeGB-disk.ReservedGB(), 0)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return randomStrategy{rng: s.rng}.Select(animeName, candidates)
+	}
+
+	pick := rand.Float64() * total
+	if s.rng != nil {
+		pick = s.rng.Float64() * total
+	}
+	for i, weight := range weights {
+		if pick < weight {
+			return candidates[i]
+		}
+		pick -= weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// priorityStrategy 优先使用 Priority 数值最小的磁盘，优先级相同时选已用空间最少的
+type priorityStrategy struct{}
+
+func (priorityStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	var top []*Disk
+	for _, disk := range candidates {
+		switch {
+		case len(top) == 0 || disk.Priority < top[0].Priority:
+			top = []*Disk{disk}
+		case disk.Priority == top[0].Priority:
+			top = append(top, disk)
+		}
+	}
+	return leastUsedStrategy{}.Select(animeName, top)
+}
+
+// stickyStrategy 让同一部动画的剧集留在它已经所在的磁盘上，新动画或原磁盘放不下时交给 fallback
+type stickyStrategy struct {
+	fallback PlacementStrategy
+}
+
+func (s stickyStrategy) Select(animeName string, candidates []*Disk) *Disk {
+	for _, disk := range candidates {
+		if _, err := os.Stat(filepath.Join(disk.Path, animeName)); err == nil {
+			return disk
+		}
+	}
+	return s.fallback.Select(animeName, candidates)
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anime-website/config"
+)
+
+// fakeDisk 的容量按 GB 给出，路径在 dir 下按磁盘名创建
+type fakeDisk struct {
+	name       string
+	priority   int
+	totalGB    float64
+	freeGB     float64
+	maxSizeGB  int
+	libraryGB  float64
+	reservedGB float64
+	draining   bool
+	disabled   bool
+	lastError  string
+}
+
+func newFakeDisks(t *testing.T, fakes []fakeDisk) []*Disk {
+	t.Helper()
+	dir := t.TempDir()
+	disks := make([]*Disk, len(fakes))
+	for i, fake := range fakes {
+		path := filepath.Join(dir, fake.name)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		disks[i] = &Disk{
+			Name:      fake.name,
+			Path:      path,
+			Priority:  fake.priority,
+			MaxSizeGB: fake.maxSizeGB,
+			Enabled:   !fake.disabled,
+			Draining:  fake.draining,
+			TotalGB:   fake.totalGB,
+			FreeGB:    fake.freeGB,
+			UsedGB:    fake.totalGB - fake.freeGB,
+			LibraryGB: fake.libraryGB,
+			LastError: fake.lastError,
+			reserved:  int64(fake.reservedGB * bytesPerGB),
+		}
+	}
+	return disks
+}
+
+func diskNames(disks []*Disk) []string {
+	names := make([]string, len(disks))
+	for i, disk := range disks {
+		if disk != nil {
+			names[i] = disk.Name
+		}
+	}
+	return names
+}
+
+func setMinFreeGB(t *testing.T, minFreeGB float64) {
+	t.Helper()
+	previous := config.GlobalConfig.Storage.MinFreeGB
+	config.GlobalConfig.Storage.MinFreeGB = minFreeGB
+	t.Cleanup(func() { config.GlobalConfig.Storage.MinFreeGB = previous })
+}
+
+func TestPlacementStrategySelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		disks    []fakeDisk
+		// existing 是已经有该动画目录的磁盘
+		existing []string
+		want     []string
+	}{
+		{
+			name:     "round-robin cycles through candidates",
+			strategy: StrategyRoundRobin,
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}, {name: "c", totalGB: 100, freeGB: 50}},
+			want:     []string{"a", "b", "c", "a", "b"},
+		},
+		{
+			name:     "least-used picks lowest used space",
+			strategy: StrategyLeastUsed,
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}, {name: "c", totalGB: 100, freeGB: 50}},
+			want:     []string{"b", "b"},
+		},
+		{
+			name:     "least-used counts reserved space",
+			strategy: StrategyLeastUsed,
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 60}, {name: "b", totalGB: 100, freeGB: 70, reservedGB: 20}},
+			want:     []string{"a"},
+		},
+		{
+			name:     "empty strategy name falls back to least-used",
+			strategy: "",
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}},
+			want:     []string{"b"},
+		},
+		{
+			name:     "unknown strategy name falls back to least-used",
+			strategy: "fastest",
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}},
+			want:     []string{"b"},
+		},
+		{
+			name:     "priority prefers lowest priority value",
+			strategy: StrategyPriority,
+			disks:    []fakeDisk{{name: "a", priority: 2, totalGB: 100, freeGB: 90}, {name: "b", priority: 1, totalGB: 100, freeGB: 10}},
+			want:     []string{"b", "b"},
+		},
+		{
+			name:     "priority tie broken by least used",
+			strategy: StrategyPriority,
+			disks:    []fakeDisk{{name: "a", priority: 1, totalGB: 100, freeGB: 20}, {name: "b", priority: 1, totalGB: 100, freeGB: 80}, {name: "c", priority: 2, totalGB: 100, freeGB: 99}},
+			want:     []string{"b"},
+		},
+		{
+			name:     "sticky keeps anime on its disk",
+			strategy: StrategySticky,
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}},
+			existing: []string{"a"},
+			want:     []string{"a", "a"},
+		},
+		{
+			name:     "sticky new anime falls back to least-used",
+			strategy: StrategySticky,
+			disks:    []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}},
+			want:     []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disks := newFakeDisks(t, tt.disks)
+			for _, disk := range disks {
+				for _, name := range tt.existing {
+					if disk.Name == name {
+						if err := os.MkdirAll(filepath.Join(disk.Path, "Anime"), 0755); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+			}
+
+			strategy := NewPlacementStrategy(tt.strategy)
+			for i, want := range tt.want {
+				if got := strategy.Select("Anime", disks); got == nil || got.Name != want {
+					t.Fatalf("第 %d 次选择: got %v, want %s", i+1, diskNames([]*Disk{got}), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomStrategySeeded(t *testing.T) {
+	disks := newFakeDisks(t, []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 90}, {name: "c", totalGB: 100, freeGB: 50}})
+	strategy := randomStrategy{rng: rand.New(rand.NewPCG(1, 2))}
+	expected := rand.New(rand.NewPCG(1, 2))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		got := strategy.Select("Anime", disks)
+		want := disks[expected.IntN(len(disks))]
+		if got != want {
+			t.Fatalf("第 %d 次选择: got %s, want %s", i+1, got.Name, want.Name)
+		}
+		seen[got.Name] = true
+	}
+	if len(seen) != len(disks) {
+		t.Fatalf("100 次选择只用到了 %v", seen)
+	}
+}
+
+func TestWeightedFreeStrategySeeded(t *testing.T) {
+	tests := []struct {
+		name  string
+		disks []fakeDisk
+		// never 是剩余空间为 0、不应被选中的磁盘
+		never string
+		// more 比 less 的剩余空间大，应该被选中更多次
+		more string
+		less string
+	}{
+		{
+			name:  "more free space picked more often",
+			disks: []fakeDisk{{name: "a", totalGB: 100, freeGB: 90}, {name: "b", totalGB: 100, freeGB: 10}},
+			more:  "a",
+			less:  "b",
+		},
+		{
+			name:  "reserved space reduces weight",
+			disks: []fakeDisk{{name: "a", totalGB: 100, freeGB: 90, reservedGB: 80}, {name: "b", totalGB: 100, freeGB: 50}},
+			more:  "b",
+			less:  "a",
+		},
+		{
+			name:  "disk without free space never picked",
+			disks: []fakeDisk{{name: "a", totalGB: 100, freeGB: 0}, {name: "b", totalGB: 100, freeGB: 40}, {name: "c", totalGB: 100, freeGB: 20}},
+			never: "a",
+			more:  "b",
+			less:  "c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disks := newFakeDisks(t, tt.disks)
+			strategy := weightedFreeStrategy{rng: rand.New(rand.NewPCG(3, 4))}
+			counts := make(map[string]int)
+			for i := 0; i < 1000; i++ {
+				counts[strategy.Select("Anime", disks).Name]++
+			}
+			if tt.never != "" && counts[tt.never] > 0 {
+				t.Fatalf("%s 被选中 %d 次", tt.never, counts[tt.never])
+			}
+			if counts[tt.more] <= counts[tt.less] {
+				t.Fatalf("选择次数 %v，%s 应多于 %s", counts, tt.more, tt.less)
+			}
+		})
+	}
+
+	t.Run("all disks without free space picked uniformly", func(t *testing.T) {
+		disks := newFakeDisks(t, []fakeDisk{{name: "a", totalGB: 100, freeGB: 0}, {name: "b", totalGB: 100, freeGB: 0}})
+		strategy := weightedFreeStrategy{rng: rand.New(rand.NewPCG(5, 6))}
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			seen[strategy.Select("Anime", disks).Name] = true
+		}
+		if len(seen) != len(disks) {
+			t.Fatalf("100 次选择只用到了 %v", seen)
+		}
+	})
+}
+
+func TestSelectDiskExclusions(t *testing.T) {
+	const gb = int64(bytesPerGB)
+	tests := []struct {
+		name      string
+		disks     []fakeDisk
+		minFreeGB float64
+		estimate  int64
+		// exclude 是调用方排除的磁盘，例如迁移的源磁盘
+		exclude string
+		want    string
+	}{
+		{
+			name:     "full disk skipped",
+			disks:    []fakeDisk{{name: "full", totalGB: 10, freeGB: 0}, {name: "b", totalGB: 100, freeGB: 10}},
+			estimate: gb,
+			want:     "b",
+		},
+		{
+			name:     "draining disk skipped",
+			disks:    []fakeDisk{{name: "draining", totalGB: 100, freeGB: 90, draining: true}, {name: "b", totalGB: 100, freeGB: 10}},
+			estimate: gb,
+			want:     "b",
+		},
+		{
+			name:     "disabled disk skipped",
+			disks:    []fakeDisk{{name: "disabled", totalGB: 100, freeGB: 90, disabled: true}, {name: "b", totalGB: 100, freeGB: 10}},
+			estimate: gb,
+			want:     "b",
+		},
+		{
+			name:     "disk with read error skipped",
+			disks:    []fakeDisk{{name: "broken", totalGB: 100, freeGB: 90, lastError: "input/output error"}, {name: "b", totalGB: 100, freeGB: 10}},
+			estimate: gb,
+			want:     "b",
+		},
+		{
+			name:     "disk over max size skipped",
+			disks:    []fakeDisk{{name: "capped", totalGB: 1000, freeGB: 990, maxSizeGB: 10, libraryGB: 8}, {name: "b", totalGB: 100, freeGB: 50}},
+			estimate: 5 * gb,
+			want:     "b",
+		},
+		{
+			name:     "max size ignores other data on shared partition",
+			disks:    []fakeDisk{{name: "shared", totalGB: 1000, freeGB: 100, maxSizeGB: 50, libraryGB: 10}},
+			estimate: 5 * gb,
+			want:     "shared",
+		},
+		{
+			name:     "reserved space counts against max size",
+			disks:    []fakeDisk{{name: "capped", totalGB: 1000, freeGB: 990, maxSizeGB: 50, libraryGB: 30, reservedGB: 18}, {name: "b", totalGB: 100, freeGB: 50}},
+			estimate: 5 * gb,
+			want:     "b",
+		},
+		{
+			name:      "min free reserve kept on less used disk",
+			disks:     []fakeDisk{{name: "tight", totalGB: 100, freeGB: 12}, {name: "b", totalGB: 20, freeGB: 10.5}},
+			minFreeGB: 5,
+			estimate:  6 * gb,
+			want:      "tight",
+		},
+		{
+			name:      "min free reserve excludes all",
+			disks:     []fakeDisk{{name: "a", totalGB: 100, freeGB: 10}, {name: "b", totalGB: 100, freeGB: 8}},
+			minFreeGB: 5,
+			estimate:  6 * gb,
+			want:      "",
+		},
+		{
+			name:      "reserved space counts against min free",
+			disks:     []fakeDisk{{name: "busy", totalGB: 100, freeGB: 30, reservedGB: 24}, {name: "b", totalGB: 200, freeGB: 10}},
+			minFreeGB: 5,
+			estimate:  2 * gb,
+			want:      "b",
+		},
+		{
+			name:     "excluded disk skipped",
+			disks:    []fakeDisk{{name: "source", totalGB: 100, freeGB: 90}, {name: "b", totalGB: 100, freeGB: 10}},
+			estimate: gb,
+			exclude:  "source",
+			want:     "b",
+		},
+		{
+			name:     "no candidates",
+			disks:    []fakeDisk{{name: "full", totalGB: 100, freeGB: 0}, {name: "draining", totalGB: 100, freeGB: 90, draining: true}},
+			estimate: gb,
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setMinFreeGB(t, tt.minFreeGB)
+			s := &StorageService{disks: newFakeDisks(t, tt.disks), placement: leastUsedStrategy{}}
+
+			var exclude []*Disk
+			if tt.exclude != "" {
+				exclude = append(exclude, s.diskByName(tt.exclude))
+			}
+			got := s.selectDisk("Anime", tt.estimate, exclude...)
+			if gotName := diskNames([]*Disk{got})[0]; gotName != tt.want {
+				t.Fatalf("got %q, want %q", gotName, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"anime-website/models"
@@ -26,11 +28,24 @@ func (s *PlayHistoryService) SavePlayHistory(userID uint, req *PlayHistoryReques
 		req.Progress = 100
 	}
 
+	// 旧客户端只传播放地址，按地址关联到剧集
+	var animeID uint
+	if req.EpisodeID != 0 {
+		if episode, found := EpisodeServiceInstance.GetEpisode(req.EpisodeID); found {
+			animeID = episode.AnimeID
+		}
+	} else if episode, found := EpisodeServiceInstance.FindByPlaylistURL(req.VideoURL); found {
+		req.EpisodeID = episode.ID
+		animeID = episode.AnimeID
+	}
+
 	if !LocalMode && DB != nil {
 		var history models.PlayHistory
 		result := DB.Where("video_id = ? AND user_id = ?", req.VideoID, userID).First(&history)
 
 		if result.Error == nil {
+			history.EpisodeID = req.EpisodeID
+			history.AnimeID = animeID
 			history.AnimeTitle = req.AnimeTitle
 			history.Episode = req.Episode
 			history.VideoURL = req.VideoURL
@@ -48,6 +63,8 @@ func (s *PlayHistoryService) SavePlayHistory(userID uint, req *PlayHistoryReques
 			history = models.PlayHistory{
 				UserID:        userID,
 				VideoID:       req.VideoID,
+				EpisodeID:     req.EpisodeID,
+				AnimeID:       animeID,
 				AnimeTitle:    req.AnimeTitle,
 				Episode:       req.Episode,
 				VideoURL:      req.VideoURL,
@@ -72,6 +89,8 @@ func (s *PlayHistoryService) SavePlayHistory(userID uint, req *PlayHistoryReques
 		historyKey := fmt.Sprintf("%d_%s", userID, req.VideoID)
 		existingHistory, exists := historyMap[historyKey]
 		if exists {
+			existingHistory.EpisodeID = req.EpisodeID
+			existingHistory.AnimeID = animeID
 			existingHistory.AnimeTitle = req.AnimeTitle
 			existingHistory.Episode = req.Episode
 			existingHistory.VideoURL = req.VideoURL
@@ -88,6 +107,8 @@ func (s *PlayHistoryService) SavePlayHistory(userID uint, req *PlayHistoryReques
 			historyMap[historyKey] = models.PlayHistory{
 				UserID:        userID,
 				VideoID:       req.VideoID,
+				EpisodeID:     req.EpisodeID,
+				AnimeID:       animeID,
 				AnimeTitle:    req.AnimeTitle,
 				Episode:       req.Episode,
 				VideoURL:      req.VideoURL,
@@ -137,6 +158,36 @@ func (s *PlayHistoryService) GetPlayHistory(userID uint, videoID string) (*model
 	return &history, nil
 }
 
+// GetPlayHistoryByEpisode 按剧集ID获取播放记录
+func (s *PlayHistoryService) GetPlayHistoryByEpisode(userID uint, episodeID uint) (*models.PlayHistory, error) {
+	var history models.PlayHistory
+
+	if !LocalMode && DB != nil {
+		result := DB.Where("episode_id = ? AND user_id = ?", episodeID, userID).Order("last_played DESC").First(&history)
+		if result.Error != nil {
+			if result.Error == gorm.ErrRecordNotFound {
+				return nil, nil
+			}
+			log.Printf("错误: 查询播放记录失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return &history, nil
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	var latest *models.PlayHistory
+	for _, existingHistory := range historyMap {
+		if existingHistory.UserID == userID && existingHistory.EpisodeID == episodeID {
+			if latest == nil || existingHistory.LastPlayed.After(latest.LastPlayed) {
+				history = existingHistory
+				latest = &history
+			}
+		}
+	}
+	return latest, nil
+}
+
 func (s *PlayHistoryService) GetAllPlayHistory(userID uint) ([]models.PlayHistory, error) {
 	var histories []models.PlayHistory
 
@@ -198,8 +249,94 @@ func (s *PlayHistoryService) ClearAllPlayHistory(userID uint) error {
 	return nil
 }
 
+// DeleteByAnime 删除动画的所有播放记录。没有关联动画的旧记录按播放地址前缀匹配
+func (s *PlayHistoryService) DeleteByAnime(animeID uint, urlPrefixes []string) error {
+	if !LocalMode && DB != nil {
+		query := DB.Where("anime_id = ?", animeID)
+		if animeID == 0 {
+			query = DB.Where("1 = 0")
+		}
+		for _, prefix := range urlPrefixes {
+			query = query.Or("anime_id = 0 AND video_url LIKE ?", escapeLike(prefix)+"%")
+		}
+		result := query.Delete(&models.PlayHistory{})
+		if result.Error != nil {
+			log.Printf("错误: 删除动画播放记录失败: %v\n", result.Error)
+			return result.Error
+		}
+		log.Printf("删除动画 %d 的播放记录 %d 条\n", animeID, result.RowsAffected)
+		return nil
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for key, history := range historyMap {
+		if animeID != 0 && history.AnimeID == animeID {
+			delete(historyMap, key)
+			continue
+		}
+		for _, prefix := range urlPrefixes {
+			if history.AnimeID == 0 && strings.HasPrefix(history.VideoURL, prefix) {
+				delete(historyMap, key)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// RewriteURLPrefix 把以 oldPrefix 开头的播放地址改成 newPrefix 开头，动画迁移到其他磁盘后调用。
+// 数据库模式下在 tx 事务中执行
+func (s *PlayHistoryService) RewriteURLPrefix(tx *gorm.DB, oldPrefix string, newPrefix string) error {
+	if !LocalMode && tx != nil {
+		var histories []models.PlayHistory
+		pattern := escapeLike(oldPrefix) + "%"
+		if result := tx.Where("video_url LIKE ? OR video_id LIKE ?", pattern, pattern).Find(&histories); result.Error != nil {
+			return result.Error
+		}
+		for _, history := range histories {
+			result := tx.Model(&history).Updates(map[string]interface{}{
+				"video_url": replaceURLPrefix(history.VideoURL, oldPrefix, newPrefix),
+				"video_id":  replaceURLPrefix(history.VideoID, oldPrefix, newPrefix),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		log.Printf("更新播放记录地址 %d 条: %s -> %s\n", len(histories), oldPrefix, newPrefix)
+		return nil
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for key, history := range historyMap {
+		if !strings.HasPrefix(history.VideoURL, oldPrefix) && !strings.HasPrefix(history.VideoID, oldPrefix) {
+			continue
+		}
+		// 本地模式按 用户_视频ID 保存，视频ID变了要换键
+		delete(historyMap, key)
+		history.VideoURL = replaceURLPrefix(history.VideoURL, oldPrefix, newPrefix)
+		history.VideoID = replaceURLPrefix(history.VideoID, oldPrefix, newPrefix)
+		historyMap[fmt.Sprintf("%d_%s", history.UserID, history.VideoID)] = history
+	}
+	return nil
+}
+
+func replaceURLPrefix(value string, oldPrefix string, newPrefix string) string {
+	if strings.HasPrefix(value, oldPrefix) {
+		return newPrefix + strings.TrimPrefix(value, oldPrefix)
+	}
+	return value
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
 type PlayHistoryRequest struct {
 	VideoID       string  `json:"videoId"`
+	EpisodeID     uint    `json:"episodeId"`
 	AnimeTitle    string  `json:"animeTitle"`
 	Episode       string  `json:"episode"`
 	VideoURL      string  `json:"videoUrl"`
@@ -210,3 +347,84 @@ type PlayHistoryRequest struct {
 	SegmentID     string  `json:"segmentId"`
 	SegmentOffset float64 `json:"segmentOffset"`
 }
+
+// CountViewersByAnime 统计每个动画有多少个用户看过，用于按热度排序
+func (s *PlayHistoryService) CountViewersByAnime() map[uint]int {
+	counts := make(map[uint]int)
+	if !LocalMode && DB != nil {
+		var rows []struct {
+			AnimeID uint
+			Count   int
+		}
+		result := DB.Model(&models.PlayHistory{}).
+			Select("anime_id, COUNT(DISTINCT user_id) AS count").
+			Where("anime_id <> 0").
+			Group("anime_id").
+			Scan(&rows)
+		if result.Error != nil {
+			log.Printf("错误: 统计播放人数失败: %v\n", result.Error)
+			return counts
+		}
+		for _, row := range rows {
+			counts[row.AnimeID] = row.Count
+		}
+		return counts
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	viewers := make(map[uint]map[uint]bool)
+	for _, history := range historyMap {
+		if history.AnimeID == 0 {
+			continue
+		}
+		if viewers[history.AnimeID] == nil {
+			viewers[history.AnimeID] = make(map[uint]bool)
+		}
+		viewers[history.AnimeID][history.UserID] = true
+	}
+	for animeID, users := range viewers {
+		counts[animeID] = len(users)
+	}
+	return counts
+}
+
+// ListByAnime 返回用户在某个动画下的播放记录，没有关联动画的旧记录按播放地址匹配
+func (s *PlayHistoryService) ListByAnime(userID uint, animeID uint, playlistURLs []string) ([]models.PlayHistory, error) {
+	var histories []models.PlayHistory
+
+	if !LocalMode && DB != nil {
+		match := DB.Where("anime_id = ?", animeID)
+		if animeID == 0 {
+			match = DB.Where("1 = 0")
+		}
+		if len(playlistURLs) > 0 {
+			match = match.Or("video_url IN ?", playlistURLs)
+		}
+		result := DB.Where("user_id = ?", userID).Where(match).Order("last_played DESC").Find(&histories)
+		if result.Error != nil {
+			log.Printf("错误: 获取动画播放记录失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return histories, nil
+	}
+
+	urls := make(map[string]bool)
+	for _, url := range playlistURLs {
+		urls[url] = true
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for _, history := range historyMap {
+		if history.UserID != userID {
+			continue
+		}
+		if (animeID != 0 && history.AnimeID == animeID) || urls[history.VideoURL] {
+			histories = append(histories, history)
+		}
+	}
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].LastPlayed.After(histories[j].LastPlayed)
+	})
+	return histories, nil
+}
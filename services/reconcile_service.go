@@ -0,0 +1,227 @@
+package services
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/models"
+)
+
+const reconcileInterval = time.Hour
+
+// ReconcileReport 是一次对账的结果
+type ReconcileReport struct {
+	Checked  int      `json:"checked"`
+	Marked   []string `json:"marked"`
+	Restored []string `json:"restored"`
+	Purged   []string `json:"purged"`
+}
+
+// MissingAnime 是已标记为缺失的动画及其计划删除时间
+type MissingAnime struct {
+	models.AnimeInfo
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// OrphanReport 列出数据库与磁盘不一致的内容
+type OrphanReport struct {
+	MissingAnimes    []MissingAnime   `json:"missingAnimes"`
+	MissingEpisodes  []models.Episode `json:"missingEpisodes"`
+	OrphanEpisodes   []models.Episode `json:"orphanEpisodes"`
+	UntrackedFolders []string         `json:"untrackedFolders"`
+}
+
+type ReconcileService struct {
+	mu sync.Mutex
+}
+
+var ReconcileServiceInstance = &ReconcileService{}
+
+// Start 定期对账，保证缺失的动画在宽限期后被删除
+func (s *ReconcileService) Start() {
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Reconcile()
+		}
+	}()
+}
+
+// Reconcile 检查每个动画的目录是否还在磁盘上：不在的标记为缺失，重新出现的恢复，缺失超过宽限期的删除
+func (s *ReconcileService) Reconcile() ReconcileReport {
+	var report ReconcileReport
+	if LocalMode || DB == nil {
+		return report
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var animes []models.AnimeInfo
+	if result := DB.Find(&animes); result.Error != nil {
+		log.Printf("错误: 对账时获取动画信息失败: %v\n", result.Error)
+		return report
+	}
+
+	grace := time.Duration(config.Get().Catalog.MissingGraceHours) * time.Hour
+	now := time.Now()
+	for i := range animes {
+		anime := &animes[i]
+		report.Checked++
+
+		if animeDirExists(*anime) {
+			if anime.MissingSince != nil {
+				DB.Model(anime).Update("missing_since", nil)
+				SearchServiceInstance.IndexAnime(*anime)
+				report.Restored = append(report.Restored, anime.FolderName)
+				log.Printf("对账: 动画 %s 的目录已恢复\n", anime.FolderName)
+			}
+			continue
+		}
+
+		// 整个磁盘不可用时（如未挂载）不做判断，避免误标记
+		if anime.PhysicalPath != "" {
+			if _, err := os.Stat(filepath.Dir(anime.PhysicalPath)); err != nil {
+				continue
+			}
+		}
+
+		if anime.MissingSince == nil {
+			DB.Model(anime).Update("missing_since", now)
+			SearchServiceInstance.RemoveAnime(anime.FolderName)
+			report.Marked = append(report.Marked, anime.FolderName)
+			log.Printf("对账: 动画 %s 的目录不存在，标记为缺失\n", anime.FolderName)
+			continue
+		}
+
+		if now.Sub(*anime.MissingSince) >= grace {
+			VideoServiceInstance.removeAnimeRecord(anime.FolderName)
+			report.Purged = append(report.Purged, anime.FolderName)
+			log.Printf("对账: 动画 %s 缺失超过 %v，已删除记录\n", anime.FolderName, grace)
+		}
+	}
+
+	return report
+}
+
+// MarkMissing 把动画标记为缺失，已标记的保留原来的时间
+func (s *ReconcileService) MarkMissing(folderName string) {
+	SearchServiceInstance.RemoveAnime(folderName)
+	if LocalMode || DB == nil {
+		EpisodeServiceInstance.DeleteByAnime(folderName)
+		return
+	}
+
+	result := DB.Model(&models.AnimeInfo{}).Where("folder_name = ? AND missing_since IS NULL", folderName).Update("missing_since", time.Now())
+	if result.Error != nil {
+		log.Printf("错误: 标记动画 %s 缺失失败: %v\n", folderName, result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("动画 %s 的目录不存在，标记为缺失\n", folderName)
+	}
+}
+
+// Orphans 列出已缺失的动画、播放列表不存在的剧集、没有动画的剧集，以及磁盘上没有记录的动画目录
+func (s *ReconcileService) Orphans() (OrphanReport, error) {
+	report := OrphanReport{
+		MissingAnimes:    []MissingAnime{},
+		MissingEpisodes:  []models.Episode{},
+		OrphanEpisodes:   []models.Episode{},
+		UntrackedFolders: []string{},
+	}
+	if LocalMode || DB == nil {
+		return report, nil
+	}
+
+	// 回收站中的动画已软删除，它们的剧集不算孤立剧集
+	var animes []models.AnimeInfo
+	if result := DB.Unscoped().Find(&animes); result.Error != nil {
+		log.Printf("错误: 获取动画信息失败: %v\n", result.Error)
+		return report, result.Error
+	}
+
+	grace := time.Duration(config.Get().Catalog.MissingGraceHours) * time.Hour
+	animeIDs := make(map[uint]bool)
+	trashed := make(map[uint]bool)
+	folders := make(map[string]bool)
+	for _, anime := range animes {
+		animeIDs[anime.ID] = true
+		if anime.DeletedAt.Valid {
+			trashed[anime.ID] = true
+			continue
+		}
+		folders[anime.FolderName] = true
+		if anime.MissingSince != nil {
+			report.MissingAnimes = append(report.MissingAnimes, MissingAnime{
+				AnimeInfo: anime,
+				PurgeAt:   anime.MissingSince.Add(grace),
+			})
+		}
+	}
+
+	var episodes []models.Episode
+	if result := DB.Find(&episodes); result.Error != nil {
+		log.Printf("错误: 获取剧集失败: %v\n", result.Error)
+		return report, result.Error
+	}
+	for _, episode := range episodes {
+		if !animeIDs[episode.AnimeID] {
+			report.OrphanEpisodes = append(report.OrphanEpisodes, episode)
+			continue
+		}
+		if trashed[episode.AnimeID] {
+			continue
+		}
+		// 停用磁盘上的剧集无法播放，同样算作缺失
+		if _, err := os.Stat(episode.PhysicalPath); os.IsNotExist(err) || !storageDiskServable(episode.StorageDisk) {
+			report.MissingEpisodes = append(report.MissingEpisodes, episode)
+		}
+	}
+
+	for _, root := range VideoServiceInstance.hlsRoots() {
+		entries, err := ioutil.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !folders[entry.Name()] {
+				report.UntrackedFolders = append(report.UntrackedFolders, filepath.Join(root, entry.Name()))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// animeDirExists 优先检查记录的物理路径，没有记录时在所有HLS目录中查找。
+// 所在磁盘已停用或已移除时目录即使还在也无法播放，按不存在处理
+func animeDirExists(anime models.AnimeInfo) bool {
+	if !storageDiskServable(anime.StorageDisk) {
+		return false
+	}
+	if anime.PhysicalPath != "" {
+		info, err := os.Stat(anime.PhysicalPath)
+		return err == nil && info.IsDir()
+	}
+	for _, root := range VideoServiceInstance.hlsRoots() {
+		if info, err := os.Stat(filepath.Join(root, anime.FolderName)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// storageDiskServable 判断 /storage/<name>/ 是否可以访问，默认HLS目录总是可以访问
+func storageDiskServable(diskName string) bool {
+	if diskName == "" || diskName == CatalogDefaultDisk {
+		return true
+	}
+	_, ok := StorageServiceInstance.ServingPath(diskName)
+	return ok
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/models"
+)
+
+const retentionSweepInterval = time.Hour
+
+type RetentionService struct {
+	mu     sync.Mutex
+	local  []models.SourceFileAudit
+	nextID uint
+}
+
+var RetentionServiceInstance = &RetentionService{}
+
+// Start 启动定时任务，处理到期的延迟删除
+func (s *RetentionService) Start() {
+	go func() {
+		s.sweep()
+		ticker := time.NewTicker(retentionSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.sweep()
+		}
+	}()
+}
+
+// Apply 在HLS切片生成成功后，按保留策略处理源文件。只有校验通过才会删除或归档，
+// 不在 Extensions 中的格式直接保留
+func (s *RetentionService) Apply(sourcePath string, hlsDirPath string) {
+	cfg := config.Get().Retention
+	if cfg.Policy == config.RetentionKeep || !cfg.AppliesTo(sourcePath) {
+		return
+	}
+
+	audit := models.SourceFileAudit{
+		SourcePath: sourcePath,
+		HLSPath:    hlsDirPath,
+		Policy:     cfg.Policy,
+		Action:     models.RetentionActionDelete,
+		CreatedAt:  time.Now(),
+	}
+	if cfg.Policy == config.RetentionArchive {
+		audit.Action = models.RetentionActionArchive
+	}
+
+	sourceDuration, hlsDuration, err := verifyHLSOutput(sourcePath, hlsDirPath, cfg.DurationToleranceSeconds)
+	audit.SourceDuration = sourceDuration
+	audit.HLSDuration = hlsDuration
+	if err != nil {
+		audit.Status = models.RetentionStatusFailed
+		audit.Message = truncate("校验失败，保留源文件: "+err.Error(), 500)
+		log.Printf("警告: %s 的HLS校验失败，保留源文件: %v\n", sourcePath, err)
+		s.create(&audit)
+		return
+	}
+
+	if cfg.Policy == config.RetentionDeleteAfterDays {
+		dueAt := time.Now().AddDate(0, 0, cfg.DeleteAfterDays)
+		audit.Status = models.RetentionStatusPending
+		audit.DueAt = &dueAt
+		audit.Message = "校验通过，等待到期删除"
+		s.create(&audit)
+		return
+	}
+
+	s.execute(&audit)
+	s.create(&audit)
+}
+
+// ListAudits 查询审计记录，按时间倒序
+func (s *RetentionService) ListAudits(action string, status string, limit int) ([]models.SourceFileAudit, error) {
+	var audits []models.SourceFileAudit
+
+	if !LocalMode && DB != nil {
+		query := DB.Order("id DESC").Limit(limit)
+		if action != "" {
+			query = query.Where("action = ?", action)
+		}
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		result := query.Find(&audits)
+		if result.Error != nil {
+			log.Printf("错误: 获取源文件审计记录失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return audits, nil
+	}
+
+	s.mu.Lock()
+	for _, audit := range s.local {
+		if (action == "" || audit.Action == action) && (status == "" || audit.Status == status) {
+			audits = append(audits, audit)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(audits, func(i, j int) bool {
+		return audits[i].ID > audits[j].ID
+	})
+	if len(audits) > limit {
+		audits = audits[:limit]
+	}
+	return audits, nil
+}
+
+// sweep 执行到期的延迟删除，删除前重新校验HLS输出
+func (s *RetentionService) sweep() {
+	now := time.Now()
+	var due []models.SourceFileAudit
+
+	if !LocalMode && DB != nil {
+		result := DB.Where("status = ? AND due_at <= ?", models.RetentionStatusPending, now).Find(&due)
+		if result.Error != nil {
+			log.Printf("错误: 查询到期的源文件失败: %v\n", result.Error)
+			return
+		}
+	} else {
+		s.mu.Lock()
+		for _, audit := range s.local {
+			if audit.Status == models.RetentionStatusPending && audit.DueAt != nil && !audit.DueAt.After(now) {
+				due = append(due, audit)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	tolerance := config.Get().Retention.DurationToleranceSeconds
+	for i := range due {
+		audit := &due[i]
+		if _, err := os.Stat(audit.SourcePath); os.IsNotExist(err) {
+			audit.Status = models.RetentionStatusDone
+			audit.Message = "源文件已不存在"
+			executedAt := time.Now()
+			audit.ExecutedAt = &executedAt
+			s.save(audit)
+			continue
+		}
+
+		_, hlsDuration, err := verifyHLSOutput(audit.SourcePath, audit.HLSPath, tolerance)
+		if err != nil {
+			audit.Status = models.RetentionStatusFailed
+			audit.Message = truncate("到期复核失败，保留源文件: "+err.Error(), 500)
+			log.Printf("警告: %s 到期复核失败，保留源文件: %v\n", audit.SourcePath, err)
+			s.save(audit)
+			continue
+		}
+
+		audit.HLSDuration = hlsDuration
+		s.execute(audit)
+		s.save(audit)
+	}
+}
+
+func (s *RetentionService) execute(audit *models.SourceFileAudit) {
+	executedAt := time.Now()
+	audit.ExecutedAt = &executedAt
+
+	var err error
+	switch audit.Action {
+	case models.RetentionActionArchive:
+		audit.ArchivePath = archiveTarget(config.Get().Retention.ArchivePath, audit.SourcePath)
+		err = moveFile(audit.SourcePath, audit.ArchivePath)
+	default:
+		err = os.Remove(audit.SourcePath)
+	}
+
+	if err != nil {
+		audit.Status = models.RetentionStatusFailed
+		audit.Message = truncate(err.Error(), 500)
+		log.Printf("警告: 处理源文件 %s 失败: %v\n", audit.SourcePath, err)
+		return
+	}
+
+	audit.Status = models.RetentionStatusDone
+	if audit.Action == models.RetentionActionArchive {
+		audit.Message = "源文件已归档"
+		log.Printf("成功归档原始文件: %s -> %s\n", audit.SourcePath, audit.ArchivePath)
+	} else {
+		audit.Message = "源文件已删除"
+		log.Printf("成功删除原始文件: %s\n", audit.SourcePath)
+	}
+}
+
+// verifyHLSOutput 确认每个子播放列表完整，且总时长与源文件的差距在容差范围内
+func verifyHLSOutput(sourcePath string, hlsDirPath string, tolerance float64) (float64, float64, error) {
+	sourceDuration, err := ProbeDuration(sourcePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	playlists, err := episodeMediaPlaylists(hlsDirPath)
+	if err != nil {
+		return sourceDuration, 0, err
+	}
+
+	var hlsDuration float64
+	for _, playlistPath := range playlists {
+		playlist, err := parseMediaPlaylist(playlistPath)
+		if err != nil {
+			return sourceDuration, 0, err
+		}
+		if !playlist.HasEndList {
+			return sourceDuration, playlist.TotalDuration, fmt.Errorf("播放列表缺少 #EXT-X-ENDLIST: %s", playlistPath)
+		}
+		if len(playlist.Segments) == 0 {
+			return sourceDuration, 0, fmt.Errorf("播放列表没有切片: %s", playlistPath)
+		}
+		for _, segment := range playlist.Segments {
+			info, err := os.Stat(playlist.SegmentPath(segment.URI))
+			if err != nil || info.Size() == 0 {
+				return sourceDuration, playlist.TotalDuration, fmt.Errorf("切片缺失或为空: %s", segment.URI)
+			}
+		}
+
+		hlsDuration = playlist.TotalDuration
+		if diff := math.Abs(playlist.TotalDuration - sourceDuration); diff > tolerance {
+			return sourceDuration, hlsDuration, fmt.Errorf("时长不一致: 源文件 %.2f 秒, HLS %.2f 秒", sourceDuration, playlist.TotalDuration)
+		}
+	}
+
+	return sourceDuration, hlsDuration, nil
+}
+
+// archiveTarget 在归档目录下保留源文件相对 videos 目录的结构
+func archiveTarget(archiveDir string, sourcePath string) string {
+	relativePath, err := filepath.Rel(videosDir, sourcePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		relativePath = filepath.Base(sourcePath)
+	}
+
+	target := filepath.Join(archiveDir, relativePath)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = strings.TrimSuffix(target, ext) + time.Now().Format("_20060102150405") + ext
+	}
+	return target
+}
+
+// moveFile 移动文件，跨磁盘时退化为复制后删除
+func moveFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
+
+func (s *RetentionService) create(audit *models.SourceFileAudit) {
+	audit.UpdatedAt = time.Now()
+
+	if !LocalMode && DB != nil {
+		if result := DB.Create(audit); result.Error != nil {
+			log.Printf("错误: 保存源文件审计记录失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	audit.ID = s.nextID
+	s.local = append(s.local, *audit)
+}
+
+func (s *RetentionService) save(audit *models.SourceFileAudit) {
+	audit.UpdatedAt = time.Now()
+
+	if !LocalMode && DB != nil {
+		if result := DB.Save(audit); result.Error != nil {
+			log.Printf("错误: 更新源文件审计记录失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.local {
+		if s.local[i].ID == audit.ID {
+			s.local[i] = *audit
+			return
+		}
+	}
+}
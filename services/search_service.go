@@ -0,0 +1,415 @@
+package services
+
+import (
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"anime-website/models"
+	"anime-website/utils"
+)
+
+// 各字段的搜索权重
+const (
+	searchWeightTitle   = 10.0
+	searchWeightAlias   = 6.0
+	searchWeightTag     = 4.0
+	searchWeightStudio  = 2.0
+	searchWeightSummary = 1.0
+)
+
+const (
+	// 模糊匹配时搜索词的三元组至少要有这个比例出现在字段中
+	searchFuzzyThreshold = 0.6
+	searchSnippetRadius  = 30
+	DefaultSearchLimit   = 50
+)
+
+// SearchResult 是一条搜索结果，Snippet 是已转义的HTML，匹配部分用 <mark> 标出
+type SearchResult struct {
+	Anime   models.AnimeInfo `json:"anime"`
+	Score   float64          `json:"score"`
+	Field   string           `json:"field"`
+	Snippet string           `json:"snippet"`
+}
+
+type searchField struct {
+	name      string
+	weight    float64
+	text      []rune
+	lower     []rune
+	pinyin    utils.PinyinText
+	hasPinyin bool
+	grams     map[string]bool
+}
+
+type searchDoc struct {
+	anime  models.AnimeInfo
+	fields []*searchField
+}
+
+// searchMatch 是搜索词在某个字段中的一次匹配，start、end 是原文的字符下标，模糊匹配时为 -1
+type searchMatch struct {
+	field *searchField
+	score float64
+	start int
+	end   int
+}
+
+// SearchService 在内存中维护动画的倒排索引：三元组 -> 动画目录名
+type SearchService struct {
+	mu    sync.RWMutex
+	docs  map[string]*searchDoc
+	grams map[string]map[string]bool
+	built bool
+}
+
+var SearchServiceInstance = &SearchService{
+	docs:  make(map[string]*searchDoc),
+	grams: make(map[string]map[string]bool),
+}
+
+// Rebuild 重新建立整个索引
+func (s *SearchService) Rebuild() {
+	s.mu.Lock()
+	s.docs = make(map[string]*searchDoc)
+	s.grams = make(map[string]map[string]bool)
+	s.built = true
+	s.mu.Unlock()
+
+	if LocalMode || DB == nil {
+		// 本地模式没有数据库，扫描时会逐个加入索引
+		VideoServiceInstance.ScanVideos()
+		return
+	}
+
+	var animes []models.AnimeInfo
+	if result := DB.Preload("Tags").Where("missing_since IS NULL").Find(&animes); result.Error != nil {
+		log.Printf("错误: 建立搜索索引失败: %v\n", result.Error)
+		return
+	}
+	for _, anime := range animes {
+		s.add(anime)
+	}
+	log.Printf("搜索索引已建立，共 %d 个动画\n", len(animes))
+}
+
+// IndexAnime 加入或更新一个动画。数据库模式下重新读取记录，保证标签等信息是最新的
+func (s *SearchService) IndexAnime(anime models.AnimeInfo) {
+	if !LocalMode && DB != nil && anime.ID != 0 {
+		var current models.AnimeInfo
+		result := DB.Preload("Tags").Where("missing_since IS NULL").First(&current, anime.ID)
+		if result.Error != nil {
+			s.RemoveAnime(anime.FolderName)
+			return
+		}
+		anime = current
+	}
+	s.add(anime)
+}
+
+// RemoveAnime 从索引中删除动画
+func (s *SearchService) RemoveAnime(folderName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(folderName)
+}
+
+// Search 按相关度返回匹配的动画。多个词之间是“与”的关系，limit 为 0 时使用默认数量
+func (s *SearchService) Search(query string, limit int) []SearchResult {
+	s.mu.RLock()
+	built := s.built
+	s.mu.RUnlock()
+	if !built {
+		s.Rebuild()
+	}
+
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	// 拼音搜索时用户常在音节之间加空格，合并后整体再匹配一次
+	compact := strings.Join(terms, "")
+
+	s.mu.RLock()
+	var results []SearchResult
+	for _, doc := range s.candidates(terms) {
+		score, best, matched := 0.0, searchMatch{}, true
+		for _, term := range terms {
+			match, ok := doc.match(term)
+			if !ok {
+				matched = false
+				break
+			}
+			score += match.score
+			if match.score > best.score {
+				best = match
+			}
+		}
+		if len(terms) > 1 && utils.IsPinyinQuery(compact) {
+			if match, ok := doc.match(compact); ok {
+				// 合并后能匹配时用它的高亮，连续的音节比分开的更准确
+				if !matched || match.score > score {
+					score = match.score
+				}
+				best, matched = match, true
+			}
+		}
+		if !matched {
+			continue
+		}
+		results = append(results, SearchResult{
+			Anime:   doc.anime,
+			Score:   score,
+			Field:   best.field.name,
+			Snippet: best.snippet(),
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return utils.NaturalLess(results[i].Anime.Title, results[j].Anime.Title)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (s *SearchService) add(anime models.AnimeInfo) {
+	doc := newSearchDoc(anime)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(anime.FolderName)
+	s.docs[anime.FolderName] = doc
+	for _, field := range doc.fields {
+		for gram := range field.grams {
+			if s.grams[gram] == nil {
+				s.grams[gram] = make(map[string]bool)
+			}
+			s.grams[gram][anime.FolderName] = true
+		}
+	}
+}
+
+func (s *SearchService) remove(folderName string) {
+	doc, exists := s.docs[folderName]
+	if !exists {
+		return
+	}
+	for _, field := range doc.fields {
+		for gram := range field.grams {
+			delete(s.grams[gram], folderName)
+			if len(s.grams[gram]) == 0 {
+				delete(s.grams, gram)
+			}
+		}
+	}
+	delete(s.docs, folderName)
+}
+
+// candidates 用三元组索引找出可能匹配的动画。搜索词太短时三元组无法覆盖子串，直接检查所有动画
+func (s *SearchService) candidates(terms []string) []*searchDoc {
+	var docs []*searchDoc
+	for _, term := range terms {
+		if len([]rune(term)) < 3 {
+			for _, doc := range s.docs {
+				docs = append(docs, doc)
+			}
+			return docs
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		for gram := range searchGrams(term) {
+			for folder := range s.grams[gram] {
+				if !seen[folder] {
+					seen[folder] = true
+					docs = append(docs, s.docs[folder])
+				}
+			}
+		}
+	}
+	return docs
+}
+
+func newSearchDoc(anime models.AnimeInfo) *searchDoc {
+	doc := &searchDoc{anime: anime}
+	add := func(name string, weight float64, text string, withPinyin bool) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		field := &searchField{name: name, weight: weight, text: []rune(text)}
+		field.lower = make([]rune, len(field.text))
+		for i, r := range field.text {
+			field.lower[i] = unicode.ToLower(r)
+		}
+		field.grams = searchGrams(string(field.lower))
+		if withPinyin {
+			field.pinyin, field.hasPinyin = utils.ToPinyin(text)
+			if field.hasPinyin {
+				for gram := range searchGrams(field.pinyin.Full) {
+					field.grams[gram] = true
+				}
+				for gram := range searchGrams(field.pinyin.Initials) {
+					field.grams[gram] = true
+				}
+			}
+		}
+		doc.fields = append(doc.fields, field)
+	}
+
+	add("title", searchWeightTitle, anime.Title, true)
+	if anime.FolderName != anime.Title {
+		add("folder_name", searchWeightAlias, anime.FolderName, true)
+	}
+	add("original_title", searchWeightAlias, anime.OriginalTitle, false)
+	for _, title := range anime.AltTitleList() {
+		add("alt_titles", searchWeightAlias, title, true)
+	}
+	for _, tag := range anime.Tags {
+		add("tags", searchWeightTag, tag.Name, true)
+	}
+	add("studio", searchWeightStudio, anime.Studio, false)
+	add("summary", searchWeightSummary, anime.Summary, false)
+	return doc
+}
+
+// match 返回搜索词在动画各字段中得分最高的匹配
+func (d *searchDoc) match(term string) (searchMatch, bool) {
+	var best searchMatch
+	for _, field := range d.fields {
+		if match, ok := field.match(term); ok && match.score > best.score {
+			best = match
+		}
+	}
+	return best, best.field != nil
+}
+
+// match 依次尝试原文子串、拼音和模糊匹配，得分依次降低
+func (f *searchField) match(term string) (searchMatch, bool) {
+	termRunes := []rune(term)
+
+	if start := runeIndex(f.lower, termRunes); start >= 0 {
+		score := f.weight * 2
+		if len(termRunes) == len(f.lower) {
+			score += f.weight * 2
+		} else if start == 0 {
+			score += f.weight
+		}
+		return searchMatch{field: f, score: score, start: start, end: start + len(termRunes)}, true
+	}
+
+	if f.hasPinyin && utils.IsPinyinQuery(term) {
+		if i := strings.Index(f.pinyin.Full, term); i >= 0 {
+			score := f.weight * 1.5
+			if i == 0 {
+				score += f.weight * 0.5
+			}
+			return searchMatch{field: f, score: score, start: f.pinyin.FullOffsets[i], end: f.pinyin.FullOffsets[i+len(term)-1] + 1}, true
+		}
+		if i := strings.Index(f.pinyin.Initials, term); i >= 0 && len(term) >= 2 {
+			score := f.weight * 1.2
+			if i == 0 {
+				score += f.weight * 0.5
+			}
+			return searchMatch{field: f, score: score, start: f.pinyin.InitialOffsets[i], end: f.pinyin.InitialOffsets[i+len(term)-1] + 1}, true
+		}
+	}
+
+	if len(termRunes) < 3 {
+		return searchMatch{}, false
+	}
+	termGrams := searchGrams(term)
+	shared := 0
+	for gram := range termGrams {
+		if f.grams[gram] {
+			shared++
+		}
+	}
+	coverage := float64(shared) / float64(len(termGrams))
+	if coverage < searchFuzzyThreshold {
+		return searchMatch{}, false
+	}
+	return searchMatch{field: f, score: f.weight * coverage, start: -1, end: -1}, true
+}
+
+// snippet 生成高亮片段。短字段返回全文，简介只截取匹配位置附近
+func (m searchMatch) snippet() string {
+	text := m.field.text
+	if m.start < 0 {
+		if len(text) > searchSnippetRadius*2 {
+			return html.EscapeString(string(text[:searchSnippetRadius*2])) + "…"
+		}
+		return html.EscapeString(string(text))
+	}
+
+	from, to := 0, len(text)
+	if m.field.name == "summary" {
+		if m.start > searchSnippetRadius {
+			from = m.start - searchSnippetRadius
+		}
+		if m.end+searchSnippetRadius < to {
+			to = m.end + searchSnippetRadius
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(html.EscapeString(string(text[from:m.start])))
+	b.WriteString("<mark>")
+	b.WriteString(html.EscapeString(string(text[m.start:m.end])))
+	b.WriteString("</mark>")
+	b.WriteString(html.EscapeString(string(text[m.end:to])))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// searchGrams 把文本按字母数字切成词，每个词前补两个空格、后补一个空格后取所有三元组
+func searchGrams(text string) map[string]bool {
+	grams := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams[string(padded[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+func runeIndex(text []rune, sub []rune) int {
+	if len(sub) == 0 || len(sub) > len(text) {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(text); i++ {
+		matched := true
+		for j := range sub {
+			if text[i+j] != sub[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
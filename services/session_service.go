@@ -0,0 +1,281 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SessionCookieName = "session"
+	sessionTouchEvery = time.Minute
+)
+
+type SessionService struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+var SessionServiceInstance = &SessionService{}
+
+var sessionMap = make(map[string]models.Session)
+var sessionMu sync.Mutex
+var nextLocalSessionID uint
+
+func (s *SessionService) Init() {
+	cfg := config.Get()
+	if cfg.Auth.SessionSecret != "" {
+		s.secret = []byte(cfg.Auth.SessionSecret)
+	} else {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			log.Fatalf("错误: 生成会话密钥失败: %v\n", err)
+		}
+		log.Println("警告: 未配置 auth.sessionSecret，已生成临时密钥，重启后所有会话将失效")
+	}
+	s.ttl = time.Duration(cfg.Auth.SessionTTLHours) * time.Hour
+}
+
+func (s *SessionService) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *SessionService) Create(userID uint, userAgent, ip string) (*models.Session, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		Token:      hex.EncodeToString(buf),
+		UserID:     userID,
+		UserAgent:  truncate(userAgent, 255),
+		IP:         truncate(ip, 64),
+		ExpiresAt:  now.Add(s.ttl),
+		LastSeenAt: now,
+		CreatedAt:  now,
+	}
+
+	if !LocalMode && DB != nil {
+		DB.Where("user_id = ? AND expires_at < ?", userID, now).Delete(&models.Session{})
+		result := DB.Create(&session)
+		if result.Error != nil {
+			log.Printf("错误: 创建会话失败: %v\n", result.Error)
+			return nil, "", result.Error
+		}
+	} else {
+		sessionMu.Lock()
+		nextLocalSessionID++
+		session.ID = nextLocalSessionID
+		sessionMap[session.Token] = session
+		sessionMu.Unlock()
+	}
+
+	return &session, s.sign(session.Token), nil
+}
+
+// Validate 校验Cookie签名并返回未过期的会话
+func (s *SessionService) Validate(cookieValue string) (*models.Session, bool) {
+	token, ok := s.verify(cookieValue)
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	var session models.Session
+
+	if !LocalMode && DB != nil {
+		result := DB.Where("token = ?", token).First(&session)
+		if result.Error != nil {
+			if result.Error != gorm.ErrRecordNotFound {
+				log.Printf("错误: 查询会话失败: %v\n", result.Error)
+			}
+			return nil, false
+		}
+		if now.After(session.ExpiresAt) {
+			DB.Delete(&session)
+			return nil, false
+		}
+		if now.Sub(session.LastSeenAt) > sessionTouchEvery {
+			session.LastSeenAt = now
+			DB.Model(&session).Update("last_seen_at", now)
+		}
+	} else {
+		sessionMu.Lock()
+		defer sessionMu.Unlock()
+
+		existing, exists := sessionMap[token]
+		if !exists {
+			return nil, false
+		}
+		if now.After(existing.ExpiresAt) {
+			delete(sessionMap, token)
+			return nil, false
+		}
+		existing.LastSeenAt = now
+		sessionMap[token] = existing
+		session = existing
+	}
+
+	return &session, true
+}
+
+func (s *SessionService) Renew(session *models.Session) error {
+	now := time.Now()
+	session.ExpiresAt = now.Add(s.ttl)
+	session.LastSeenAt = now
+
+	if !LocalMode && DB != nil {
+		result := DB.Model(session).Updates(map[string]interface{}{
+			"expires_at":   session.ExpiresAt,
+			"last_seen_at": session.LastSeenAt,
+		})
+		if result.Error != nil {
+			log.Printf("错误: 续期会话失败: %v\n", result.Error)
+			return result.Error
+		}
+	} else {
+		sessionMu.Lock()
+		sessionMap[session.Token] = *session
+		sessionMu.Unlock()
+	}
+
+	return nil
+}
+
+func (s *SessionService) ListUserSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	now := time.Now()
+
+	if !LocalMode && DB != nil {
+		result := DB.Where("user_id = ? AND expires_at > ?", userID, now).Order("last_seen_at DESC").Find(&sessions)
+		if result.Error != nil {
+			log.Printf("错误: 获取会话列表失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+	} else {
+		sessionMu.Lock()
+		for _, session := range sessionMap {
+			if session.UserID == userID && now.Before(session.ExpiresAt) {
+				sessions = append(sessions, session)
+			}
+		}
+		sessionMu.Unlock()
+
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		})
+	}
+
+	return sessions, nil
+}
+
+func (s *SessionService) Revoke(userID uint, sessionID uint) error {
+	if !LocalMode && DB != nil {
+		result := DB.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.Session{})
+		if result.Error != nil {
+			log.Printf("错误: 注销会话失败: %v\n", result.Error)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &UserError{Message: "会话不存在"}
+		}
+		return nil
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	for token, session := range sessionMap {
+		if session.ID == sessionID && session.UserID == userID {
+			delete(sessionMap, token)
+			return nil
+		}
+	}
+	return &UserError{Message: "会话不存在"}
+}
+
+func (s *SessionService) RevokeOthers(userID uint, currentID uint) error {
+	if !LocalMode && DB != nil {
+		result := DB.Where("user_id = ? AND id <> ?", userID, currentID).Delete(&models.Session{})
+		if result.Error != nil {
+			log.Printf("错误: 注销其他会话失败: %v\n", result.Error)
+			return result.Error
+		}
+		return nil
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	for token, session := range sessionMap {
+		if session.UserID == userID && session.ID != currentID {
+			delete(sessionMap, token)
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) RevokeCookie(cookieValue string) {
+	token, ok := s.verify(cookieValue)
+	if !ok {
+		return
+	}
+
+	if !LocalMode && DB != nil {
+		result := DB.Where("token = ?", token).Delete(&models.Session{})
+		if result.Error != nil {
+			log.Printf("错误: 删除会话失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	sessionMu.Lock()
+	delete(sessionMap, token)
+	sessionMu.Unlock()
+}
+
+func (s *SessionService) sign(token string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(token))
+	return token + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *SessionService) verify(cookieValue string) (string, bool) {
+	idx := strings.LastIndex(cookieValue, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	token := cookieValue[:idx]
+	signature, err := base64.RawURLEncoding.DecodeString(cookieValue[idx+1:])
+	if err != nil {
+		return "", false
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(token))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", false
+	}
+	return token, true
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
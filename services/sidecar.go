@@ -0,0 +1,372 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"anime-website/models"
+	"anime-website/utils"
+)
+
+// 动画目录中的元数据文件，tvshow.nfo 是 Kodi/Jellyfin 格式，info.json 是本站格式
+const (
+	showNFOName  = "tvshow.nfo"
+	infoJSONName = "info.json"
+	episodeNFO   = "episode.nfo"
+)
+
+// AnimeSidecar 是从元数据文件中读取的动画信息，零值表示文件中没有该项
+type AnimeSidecar struct {
+	Title         string
+	OriginalTitle string
+	AltTitles     []string
+	Plot          string
+	Genres        []string
+	Tags          []string
+	Year          int
+	Season        string
+	Studio        string
+	Status        string
+	Rating        float64
+	Poster        string
+	Fanart        string
+	// Episodes 按剧集目录名记录标题
+	Episodes map[string]string
+	// numbered 按 "季-集" 记录标题，用于没有写目录名的元数据
+	numbered map[string]string
+}
+
+type nfoShow struct {
+	Title         string      `xml:"title"`
+	OriginalTitle string      `xml:"originaltitle"`
+	SortTitle     string      `xml:"sorttitle"`
+	Plot          string      `xml:"plot"`
+	Outline       string      `xml:"outline"`
+	Year          int         `xml:"year"`
+	Premiered     string      `xml:"premiered"`
+	Rating        float64     `xml:"rating"`
+	Ratings       []nfoRating `xml:"ratings>rating"`
+	Genres        []string    `xml:"genre"`
+	Tags          []string    `xml:"tag"`
+	Studios       []string    `xml:"studio"`
+	Status        string      `xml:"status"`
+	Thumbs        []nfoThumb  `xml:"thumb"`
+	Fanart        []nfoThumb  `xml:"fanart>thumb"`
+}
+
+type nfoRating struct {
+	Default bool    `xml:"default,attr"`
+	Max     float64 `xml:"max,attr"`
+	Value   float64 `xml:"value"`
+}
+
+type nfoThumb struct {
+	Aspect string `xml:"aspect,attr"`
+	URL    string `xml:",chardata"`
+}
+
+type nfoEpisode struct {
+	Title string `xml:"title"`
+}
+
+type infoJSON struct {
+	Title         string   `json:"title"`
+	OriginalTitle string   `json:"original_title"`
+	AltTitles     []string `json:"alt_titles"`
+	Summary       string   `json:"summary"`
+	Plot          string   `json:"plot"`
+	Genres        []string `json:"genres"`
+	Tags          []string `json:"tags"`
+	Year          int      `json:"year"`
+	Season        string   `json:"season"`
+	Studio        string   `json:"studio"`
+	Status        string   `json:"status"`
+	Rating        float64  `json:"rating"`
+	Poster        string   `json:"poster"`
+	Cover         string   `json:"cover"`
+	Fanart        string   `json:"fanart"`
+	Episodes      []struct {
+		Name   string `json:"name"`
+		Season int    `json:"season"`
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	} `json:"episodes"`
+}
+
+// SidecarLocation 是可能存放元数据文件的目录，URL 是该目录的访问地址，用于转换图片路径
+type SidecarLocation struct {
+	Dir string
+	URL string
+}
+
+// ReadAnimeSidecar 读取动画目录中的 tvshow.nfo 和 info.json，后读到的非空字段覆盖前面的。
+// locations 按优先级从低到高排列，通常是源视频目录和HLS目录
+func ReadAnimeSidecar(locations ...SidecarLocation) (*AnimeSidecar, bool) {
+	sidecar := &AnimeSidecar{Episodes: make(map[string]string), numbered: make(map[string]string)}
+	found := false
+
+	for _, location := range locations {
+		if data, err := ioutil.ReadFile(filepath.Join(location.Dir, showNFOName)); err == nil {
+			if err := sidecar.mergeNFO(data, location); err != nil {
+				log.Printf("警告: 解析 %s 失败: %v\n", filepath.Join(location.Dir, showNFOName), err)
+			} else {
+				found = true
+			}
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(location.Dir, infoJSONName)); err == nil {
+			if err := sidecar.mergeJSON(data, location); err != nil {
+				log.Printf("警告: 解析 %s 失败: %v\n", filepath.Join(location.Dir, infoJSONName), err)
+			} else {
+				found = true
+			}
+		}
+	}
+
+	return sidecar, found
+}
+
+// IsSidecarFile 判断文件名是否是动画元数据文件
+func IsSidecarFile(name string) bool {
+	return name == showNFOName || name == infoJSONName || strings.HasSuffix(strings.ToLower(name), ".nfo")
+}
+
+func (s *AnimeSidecar) mergeNFO(data []byte, location SidecarLocation) error {
+	var show nfoShow
+	if err := xml.Unmarshal(data, &show); err != nil {
+		return err
+	}
+
+	plot := show.Plot
+	if plot == "" {
+		plot = show.Outline
+	}
+	rating := show.Rating
+	for _, r := range show.Ratings {
+		if r.Default || rating == 0 {
+			rating = r.Value
+			if r.Max > 0 && r.Max != 10 {
+				rating = r.Value * 10 / r.Max
+			}
+		}
+	}
+	var poster, fanart string
+	for _, thumb := range show.Thumbs {
+		if poster == "" || thumb.Aspect == "poster" {
+			poster = strings.TrimSpace(thumb.URL)
+		}
+	}
+	if len(show.Fanart) > 0 {
+		fanart = strings.TrimSpace(show.Fanart[0].URL)
+	}
+	var studio string
+	if len(show.Studios) > 0 {
+		studio = show.Studios[0]
+	}
+
+	s.merge(infoJSON{
+		Title:         show.Title,
+		OriginalTitle: show.OriginalTitle,
+		Plot:          plot,
+		Genres:        show.Genres,
+		Tags:          show.Tags,
+		Year:          show.Year,
+		Season:        seasonFromDate(show.Premiered),
+		Studio:        studio,
+		Status:        nfoStatus(show.Status),
+		Rating:        rating,
+		Poster:        poster,
+		Fanart:        fanart,
+	}, location)
+	if show.SortTitle != "" && show.SortTitle != show.Title {
+		s.AltTitles = append(s.AltTitles, strings.TrimSpace(show.SortTitle))
+	}
+	if s.Year == 0 && len(show.Premiered) >= 4 {
+		s.Year, _ = strconv.Atoi(show.Premiered[:4])
+	}
+	return nil
+}
+
+func (s *AnimeSidecar) mergeJSON(data []byte, location SidecarLocation) error {
+	var info infoJSON
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+	s.merge(info, location)
+	return nil
+}
+
+func (s *AnimeSidecar) merge(info infoJSON, location SidecarLocation) {
+	setString := func(target *string, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			*target = value
+		}
+	}
+	setString(&s.Title, info.Title)
+	setString(&s.OriginalTitle, info.OriginalTitle)
+	setString(&s.Plot, info.Summary)
+	setString(&s.Plot, info.Plot)
+	setString(&s.Studio, info.Studio)
+	setString(&s.Poster, sidecarArtwork(info.Cover, location))
+	setString(&s.Poster, sidecarArtwork(info.Poster, location))
+	setString(&s.Fanart, sidecarArtwork(info.Fanart, location))
+	if validAnimeSeasons[info.Season] {
+		s.Season = info.Season
+	}
+	if validAnimeStatuses[info.Status] {
+		s.Status = info.Status
+	}
+	if info.Year != 0 {
+		s.Year = info.Year
+	}
+	if info.Rating > 0 && info.Rating <= maxRating {
+		s.Rating = info.Rating
+	}
+	if len(info.AltTitles) > 0 {
+		s.AltTitles = cleanNames(info.AltTitles)
+	}
+	if len(info.Genres) > 0 {
+		s.Genres = cleanNames(info.Genres)
+	}
+	if len(info.Tags) > 0 {
+		s.Tags = cleanNames(info.Tags)
+	}
+
+	for _, episode := range info.Episodes {
+		title := strings.TrimSpace(episode.Title)
+		if title == "" {
+			continue
+		}
+		if episode.Name != "" {
+			s.Episodes[episode.Name] = title
+		} else if episode.Number > 0 {
+			season := episode.Season
+			if season == 0 {
+				season = 1
+			}
+			s.numbered[episodeKey(season, episode.Number)] = title
+		}
+	}
+}
+
+// EpisodeTitle 返回剧集在元数据中的标题，先按目录名查找，再查找同目录下的 episode.nfo 或同名 nfo，最后按集数查找
+func (s *AnimeSidecar) EpisodeTitle(video models.VideoFile, animeDirs ...string) string {
+	if title, ok := s.Episodes[video.FileName]; ok {
+		return title
+	}
+
+	candidates := []string{filepath.Join(filepath.Dir(video.PhysicalPath), episodeNFO)}
+	for _, dir := range animeDirs {
+		candidates = append(candidates, filepath.Join(dir, video.FileName+".nfo"))
+	}
+	for _, path := range candidates {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var episode nfoEpisode
+		if err := xml.Unmarshal(data, &episode); err != nil {
+			log.Printf("警告: 解析 %s 失败: %v\n", path, err)
+			continue
+		}
+		if title := strings.TrimSpace(episode.Title); title != "" {
+			return title
+		}
+	}
+
+	parsed := utils.ParseEpisodeName(video.FileName)
+	if parsed.Parsed && parsed.Kind == utils.EpisodeKindRegular {
+		return s.numbered[episodeKey(parsed.Season, parsed.Number)]
+	}
+	return ""
+}
+
+// Apply 把元数据文件中的信息填入扫描得到的动画，封面只在目录中没有 cover 文件时使用
+func (s *AnimeSidecar) Apply(anime *models.AnimeInfo, hasCoverFile bool) {
+	if s.Title != "" {
+		anime.Title = s.Title
+	}
+	if s.Plot != "" {
+		anime.Summary = s.Plot
+	}
+	anime.OriginalTitle = s.OriginalTitle
+	anime.AltTitles = strings.Join(s.AltTitles, "\n")
+	anime.Year = s.Year
+	anime.Season = s.Season
+	anime.Studio = s.Studio
+	anime.Status = s.Status
+	anime.Rating = s.Rating
+	if s.Poster != "" && !hasCoverFile {
+		anime.Cover = s.Poster
+	}
+	if s.Fanart != "" {
+		anime.Fanart = s.Fanart
+	}
+
+	anime.Tags = nil
+	for _, name := range s.Genres {
+		anime.Tags = append(anime.Tags, models.Tag{Name: name, Kind: models.TagKindGenre})
+	}
+	for _, name := range s.Tags {
+		anime.Tags = append(anime.Tags, models.Tag{Name: name, Kind: models.TagKindTag})
+	}
+}
+
+// sidecarArtwork 把元数据中的图片路径转换为访问地址：网络地址原样保留，相对路径必须在动画目录内且文件存在
+func sidecarArtwork(path string, location SidecarLocation) string {
+	path = strings.TrimSpace(path)
+	if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if filepath.IsAbs(path) || strings.Contains(filepath.ToSlash(path), "../") {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(location.Dir, path)); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(location.URL, "/") + "/" + strings.TrimPrefix(filepath.ToSlash(path), "./")
+}
+
+func episodeKey(season int, number int) string {
+	return strconv.Itoa(season) + "-" + strconv.Itoa(number)
+}
+
+// seasonFromDate 根据首播日期（如 2024-04-06）推算放送季度
+func seasonFromDate(date string) string {
+	if len(date) < 7 {
+		return ""
+	}
+	month, err := strconv.Atoi(date[5:7])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case month >= 1 && month <= 3:
+		return models.AnimeSeasonWinter
+	case month >= 4 && month <= 6:
+		return models.AnimeSeasonSpring
+	case month >= 7 && month <= 9:
+		return models.AnimeSeasonSummer
+	case month >= 10 && month <= 12:
+		return models.AnimeSeasonFall
+	}
+	return ""
+}
+
+// nfoStatus 转换 Kodi 的放送状态
+func nfoStatus(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "continuing", "returning series", "airing":
+		return models.AnimeStatusAiring
+	case "ended", "finished", "canceled", "cancelled":
+		return models.AnimeStatusFinished
+	case "upcoming", "planned", "in production":
+		return models.AnimeStatusUpcoming
+	}
+	return ""
+}
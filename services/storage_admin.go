@@ -0,0 +1,271 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"anime-website/config"
+)
+
+// 磁盘名会出现在 /storage/<name>/ 地址中
+var diskNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// DiskStatus 是磁盘管理页面显示的磁盘状态
+type DiskStatus struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Enabled    bool      `json:"enabled"`
+	Draining   bool      `json:"draining"`
+	Priority   int       `json:"priority"`
+	MaxSizeGB  int       `json:"maxSizeGB"`
+	TotalGB    float64   `json:"totalGB"`
+	FreeGB     float64   `json:"freeGB"`
+	UsedGB     float64   `json:"usedGB"`
+	LibraryGB  float64   `json:"libraryGB"`
+	ReservedGB float64   `json:"reservedGB"`
+	AnimeCount int       `json:"animeCount"`
+	Healthy    bool      `json:"healthy"`
+	LastError  string    `json:"lastError"`
+	LastCheck  time.Time `json:"lastCheck"`
+}
+
+// ListDiskStatus 返回所有磁盘的容量、动画数量和健康状态
+func (s *StorageService) ListDiskStatus() []DiskStatus {
+	statuses := []DiskStatus{}
+	for _, disk := range s.GetAllDisks() {
+		statuses = append(statuses, s.diskStatus(disk))
+	}
+	return statuses
+}
+
+func (s *StorageService) diskStatus(disk *Disk) DiskStatus {
+	s.mu.RLock()
+	status := DiskStatus{
+		Name:       disk.Name,
+		Path:       disk.Path,
+		Enabled:    disk.Enabled,
+		Draining:   disk.Draining,
+		Priority:   disk.Priority,
+		MaxSizeGB:  disk.MaxSizeGB,
+		TotalGB:    disk.TotalGB,
+		FreeGB:     disk.FreeGB,
+		UsedGB:     disk.UsedGB,
+		LibraryGB:  disk.LibraryGB,
+		ReservedGB: disk.ReservedGB(),
+		Healthy:    disk.LastError == "" && disk.TotalGB > 0,
+		LastError:  disk.LastError,
+		LastCheck:  disk.LastCheck,
+	}
+	s.mu.RUnlock()
+
+	if folders, err := s.AnimesOnDisk(disk.Name); err == nil {
+		status.AnimeCount = len(folders)
+	} else if status.LastError == "" {
+		status.Healthy = false
+		status.LastError = err.Error()
+	}
+	return status
+}
+
+// AddDisk 在运行时添加并启用一个磁盘，同时写回配置文件
+func (s *StorageService) AddDisk(diskCfg config.DiskConfig) (*DiskStatus, error) {
+	if !diskNamePattern.MatchString(diskCfg.Name) {
+		return nil, &UserError{Message: "磁盘名只能包含字母、数字、下划线和连字符"}
+	}
+	if diskCfg.MaxSizeGB < 0 {
+		return nil, &UserError{Message: "最大容量不能小于 0"}
+	}
+	if info, err := os.Stat(diskCfg.Path); err != nil || !info.IsDir() {
+		return nil, &UserError{Message: "磁盘路径不存在或不是目录: " + diskCfg.Path}
+	}
+	libraryGB := librarySizeGB(diskCfg.Path)
+
+	s.mu.Lock()
+	if s.diskByName(diskCfg.Name) != nil {
+		s.mu.Unlock()
+		return nil, &UserError{Message: "磁盘已存在: " + diskCfg.Name}
+	}
+	for _, existing := range s.disks {
+		if samePath(existing.Path, diskCfg.Path) {
+			s.mu.Unlock()
+			return nil, &UserError{Message: fmt.Sprintf("路径已被磁盘 %s 使用", existing.Name)}
+		}
+	}
+
+	disk := &Disk{
+		Name:      diskCfg.Name,
+		Path:      diskCfg.Path,
+		MaxSizeGB: diskCfg.MaxSizeGB,
+		Priority:  diskCfg.Priority,
+		Enabled:   true,
+		LibraryGB: libraryGB,
+	}
+	s.updateDiskUsage(disk)
+	s.disks = append(s.disks, disk)
+	if err := s.saveConfig(); err != nil {
+		s.disks = s.disks[:len(s.disks)-1]
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+
+	log.Printf("存储服务: 添加磁盘 %s, 路径: %s, 最大容量: %dGB, 可用: %.2fGB/%.2fGB\n", disk.Name, disk.Path, disk.MaxSizeGB, disk.FreeGB, disk.TotalGB)
+	WatcherServiceInstance.AddHLSRoot(disk.Path)
+	s.syncDisk(disk.Name)
+	status := s.diskStatus(disk)
+	return &status, nil
+}
+
+// EnableDisk 启用磁盘，正在清空的磁盘恢复为正常状态
+func (s *StorageService) EnableDisk(name string) (*DiskStatus, error) {
+	// 停用期间目录内容可能有变化，启用前重新统计
+	var libraryGB float64
+	if disk := s.GetDiskByName(name); disk != nil {
+		libraryGB = librarySizeGB(disk.Path)
+	}
+	disk, err := s.updateDisk(name, func(disk *Disk) error {
+		disk.Enabled = true
+		disk.Draining = false
+		disk.LibraryGB = libraryGB
+		s.updateDiskUsage(disk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("存储服务: 启用磁盘 %s\n", name)
+	WatcherServiceInstance.AddHLSRoot(disk.Path)
+	s.syncDisk(name)
+	status := s.diskStatus(disk)
+	return &status, nil
+}
+
+// DisableDisk 停用磁盘，磁盘上的动画将无法播放。磁盘上还有动画时需要 force
+func (s *StorageService) DisableDisk(name string, force bool) (*DiskStatus, error) {
+	folders, err := s.AnimesOnDisk(name)
+	if err != nil && !force {
+		return nil, err
+	}
+	if len(folders) > 0 && !force {
+		return nil, &UserError{Message: fmt.Sprintf("磁盘 %s 上还有 %d 部动画，请先清空", name, len(folders))}
+	}
+
+	disk, err := s.updateDisk(name, func(disk *Disk) error {
+		if disk.reserved > 0 {
+			return &UserError{Message: "磁盘正在写入，请稍后再试: " + name}
+		}
+		disk.Enabled = false
+		disk.Draining = false
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("存储服务: 停用磁盘 %s\n", name)
+	// 磁盘上剩下的动画标记为缺失，重新启用磁盘后同步回来
+	for _, folderName := range folders {
+		ReconcileServiceInstance.MarkMissing(folderName)
+	}
+	status := s.diskStatus(disk)
+	return &status, nil
+}
+
+// DrainDisk 把磁盘标记为正在清空，之后不再往上面分配新动画。迁移由调用方创建任务完成
+func (s *StorageService) DrainDisk(name string) (*DiskStatus, error) {
+	disk, err := s.updateDisk(name, func(disk *Disk) error {
+		if !disk.Enabled {
+			return &UserError{Message: "磁盘未启用: " + name}
+		}
+		disk.Draining = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("存储服务: 开始清空磁盘 %s\n", name)
+	status := s.diskStatus(disk)
+	return &status, nil
+}
+
+// ServingPath 返回 /storage/<name>/ 对应的目录，磁盘不存在或未启用时返回 false
+func (s *StorageService) ServingPath(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	disk := s.diskByName(name)
+	if disk == nil || !disk.Enabled {
+		return "", false
+	}
+	return disk.Path, true
+}
+
+// updateDisk 修改磁盘状态并写回配置文件，update 返回错误时不做修改
+func (s *StorageService) updateDisk(name string, update func(*Disk) error) (*Disk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	disk := s.diskByName(name)
+	if disk == nil {
+		return nil, &UserError{Message: "磁盘不存在: " + name}
+	}
+	previous := *disk
+	if err := update(disk); err != nil {
+		return nil, err
+	}
+	if err := s.saveConfig(); err != nil {
+		disk.Enabled = previous.Enabled
+		disk.Draining = previous.Draining
+		return nil, err
+	}
+	return disk, nil
+}
+
+// saveConfig 把磁盘列表写回配置文件，调用方需持有锁
+func (s *StorageService) saveConfig() error {
+	disks := make([]config.DiskConfig, len(s.disks))
+	for i, disk := range s.disks {
+		disks[i] = config.DiskConfig{
+			Name:      disk.Name,
+			Path:      disk.Path,
+			MaxSizeGB: disk.MaxSizeGB,
+			Priority:  disk.Priority,
+			Enabled:   disk.Enabled,
+			Draining:  disk.Draining,
+		}
+	}
+
+	if err := config.SaveStorageDisks(disks); err != nil {
+		log.Printf("错误: 保存存储配置失败: %v\n", err)
+		return fmt.Errorf("保存配置失败: %v", err)
+	}
+	return nil
+}
+
+// syncDisk 在后台把磁盘上已有的动画同步到数据库
+func (s *StorageService) syncDisk(name string) {
+	folders, err := s.AnimesOnDisk(name)
+	if err != nil || len(folders) == 0 {
+		return
+	}
+	go func() {
+		for _, folderName := range folders {
+			VideoServiceInstance.SyncAnime(folderName)
+		}
+	}()
+}
+
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
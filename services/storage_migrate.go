@@ -0,0 +1,497 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"anime-website/models"
+
+	"gorm.io/gorm"
+)
+
+// 迁移时先复制到目标磁盘上的临时目录，以 . 开头，扫描和监听都会跳过，全部校验通过后再改名
+const migrateDirPrefix = ".migrate-"
+
+var errMigrationStopped = fmt.Errorf("迁移已停止")
+
+// storageMove 是一部动画的一次迁移。source 为 nil 表示动画在默认HLS目录中
+type storageMove struct {
+	folderName string
+	source     *Disk
+	target     *Disk
+	srcDir     string
+	dstDir     string
+	srcURL     string
+	dstURL     string
+	bytes      int64
+	// done 表示目录记录已切换到目标磁盘
+	done bool
+}
+
+// CheckMigrateTarget 检查迁移的目标磁盘是否可用，name 为空表示自动选择
+func (s *StorageService) CheckMigrateTarget(name string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.disks) == 0 {
+		return &UserError{Message: "没有配置存储磁盘"}
+	}
+	if name == "" {
+		return nil
+	}
+	disk := s.diskByName(name)
+	if disk == nil {
+		return &UserError{Message: "磁盘不存在: " + name}
+	}
+	if !disk.Enabled {
+		return &UserError{Message: "磁盘未启用: " + name}
+	}
+	if disk.Draining {
+		return &UserError{Message: "磁盘正在清空: " + name}
+	}
+	return nil
+}
+
+// AnimesOnDisk 列出磁盘上所有动画的目录名
+func (s *StorageService) AnimesOnDisk(name string) ([]string, error) {
+	disk := s.GetDiskByName(name)
+	if disk == nil {
+		return nil, &UserError{Message: "磁盘不存在: " + name}
+	}
+
+	entries, err := os.ReadDir(disk.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取磁盘 %s 失败: %v", name, err)
+	}
+	folders := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			folders = append(folders, entry.Name())
+		}
+	}
+	return folders, nil
+}
+
+// BatchMigrate 依次迁移动画，targetName 为空时按分配策略为每部动画选择其他磁盘。
+// 磁盘读写是瓶颈，不并发迁移
+func (s *StorageService) BatchMigrate(folders []string, targetName string, progressChan chan<- map[string]interface{}, stopChan <-chan struct{}) (int, int, int, int, []string) {
+	total := len(folders)
+	success := 0
+	failed := 0
+	skipped := 0
+	var errors []string
+
+	send := func(event map[string]interface{}) {
+		event["timestamp"] = time.Now().Format(time.RFC3339)
+		select {
+		case progressChan <- event:
+		default:
+		}
+	}
+
+	for i, folderName := range folders {
+		select {
+		case <-stopChan:
+			send(map[string]interface{}{"type": "stop", "message": "处理已停止"})
+			return total, success, failed, skipped, errors
+		default:
+		}
+
+		send(map[string]interface{}{
+			"type":    "progress",
+			"current": i + 1,
+			"total":   total,
+			"video":   folderName,
+			"anime":   folderName,
+			"status":  "processing",
+		})
+
+		onCopy := func(copied int64, size int64) {
+			percent := 100.0
+			if size > 0 {
+				percent = float64(copied) * 100 / float64(size)
+			}
+			send(map[string]interface{}{
+				"type":        "file_progress",
+				"video":       folderName,
+				"anime":       folderName,
+				"percent":     percent,
+				"copiedBytes": copied,
+				"totalBytes":  size,
+			})
+		}
+
+		move, err := s.migrateAnime(folderName, targetName, onCopy, stopChan)
+		switch {
+		case err == errMigrationStopped:
+			// 下一轮循环发出停止事件
+			continue
+		case err != nil:
+			errorMsg := fmt.Sprintf("动画 %s 迁移失败: %v", folderName, err)
+			failed++
+			errors = append(errors, errorMsg)
+			log.Printf("错误: %s\n", errorMsg)
+			send(map[string]interface{}{
+				"type":    "error",
+				"video":   folderName,
+				"anime":   folderName,
+				"message": err.Error(),
+			})
+		case move == nil:
+			skipped++
+			send(map[string]interface{}{
+				"type":    "skipped",
+				"video":   folderName,
+				"anime":   folderName,
+				"message": "动画已在目标磁盘上，跳过迁移",
+			})
+		default:
+			success++
+			send(map[string]interface{}{
+				"type":  "success",
+				"video": folderName,
+				"anime": folderName,
+				"from":  move.sourceName(),
+				"to":    move.target.Name,
+			})
+		}
+	}
+
+	return total, success, failed, skipped, errors
+}
+
+// migrateAnime 把动画复制到目标磁盘并逐个文件校验，然后在一个事务中切换动画、剧集和播放记录的地址，
+// 最后删除源目录。动画已在目标磁盘上时返回 nil
+func (s *StorageService) migrateAnime(folderName string, targetName string, onCopy func(int64, int64), stopChan <-chan struct{}) (*storageMove, error) {
+	move, err := s.prepareMove(folderName, targetName)
+	if err != nil || move == nil {
+		return nil, err
+	}
+	defer s.finishMove(move)
+
+	log.Printf("存储服务: 开始迁移动画 %s: %s -> %s (%.2fGB)\n", folderName, move.srcDir, move.dstDir, float64(move.bytes)/bytesPerGB)
+
+	// 清理上次中断留下的临时目录
+	tmpDir := filepath.Join(move.target.Path, migrateDirPrefix+folderName)
+	os.RemoveAll(tmpDir)
+	if err := copyTreeVerified(move.srcDir, tmpDir, move.bytes, onCopy, stopChan); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, move.dstDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("移动临时目录失败: %v", err)
+	}
+
+	// 切换之前出错时动画仍指向完整的源目录，只需删掉复制出的目录
+	if err := s.switchCatalog(move); err != nil {
+		os.RemoveAll(move.dstDir)
+		return nil, fmt.Errorf("更新动画记录失败: %v", err)
+	}
+	move.done = true
+
+	if err := os.RemoveAll(move.srcDir); err != nil {
+		log.Printf("警告: 删除源目录 %s 失败: %v\n", move.srcDir, err)
+	}
+	log.Printf("存储服务: 动画 %s 已从 %s 迁移到 %s\n", folderName, move.sourceName(), move.target.Name)
+	return move, nil
+}
+
+// prepareMove 找到动画当前所在的目录并选好目标磁盘，为复制预留空间，同时禁止往该动画写入新剧集
+func (s *StorageService) prepareMove(folderName string, targetName string) (*storageMove, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if folderName == "" || folderName != filepath.Base(folderName) || strings.HasPrefix(folderName, ".") {
+		return nil, &UserError{Message: "无效的动画目录名: " + folderName}
+	}
+	if s.migrating[folderName] {
+		return nil, &UserError{Message: "动画正在迁移: " + folderName}
+	}
+	if s.writing[folderName] > 0 {
+		return nil, &UserError{Message: "动画正在转码，请稍后再迁移: " + folderName}
+	}
+
+	move := &storageMove{folderName: folderName, source: s.findAnimeData(folderName)}
+	if move.source != nil {
+		move.srcDir = filepath.Join(move.source.Path, folderName)
+		move.srcURL = "/storage/" + move.source.Name + "/" + folderName + "/"
+	} else {
+		move.srcDir = filepath.Join(hlsDir, folderName)
+		move.srcURL = "/hls/" + folderName + "/"
+		if info, err := os.Stat(move.srcDir); err != nil || !info.IsDir() {
+			return nil, &UserError{Message: "找不到动画的切片目录: " + folderName}
+		}
+	}
+	move.bytes = directorySize(move.srcDir)
+
+	if targetName == "" {
+		move.target = s.selectDisk(folderName, move.bytes, move.source)
+		if move.target == nil {
+			return nil, fmt.Errorf("没有其他磁盘能放下 %.2fGB", float64(move.bytes)/bytesPerGB)
+		}
+	} else {
+		move.target = s.diskByName(targetName)
+		if move.target == nil {
+			return nil, &UserError{Message: "磁盘不存在: " + targetName}
+		}
+		if move.target == move.source {
+			return nil, nil
+		}
+		if !move.target.Enabled {
+			return nil, &UserError{Message: "磁盘未启用: " + targetName}
+		}
+		if move.target.Draining {
+			return nil, &UserError{Message: "磁盘正在清空: " + targetName}
+		}
+		if !move.target.fits(move.bytes) {
+			return nil, fmt.Errorf("磁盘 %s 空间不足，需要 %.2fGB", move.target.Name, float64(move.bytes)/bytesPerGB)
+		}
+	}
+
+	move.dstDir = filepath.Join(move.target.Path, folderName)
+	move.dstURL = "/storage/" + move.target.Name + "/" + folderName + "/"
+	if _, err := os.Stat(move.dstDir); err == nil {
+		return nil, fmt.Errorf("磁盘 %s 上已存在目录 %s", move.target.Name, folderName)
+	}
+
+	if s.migrating == nil {
+		s.migrating = make(map[string]bool)
+	}
+	s.migrating[folderName] = true
+	move.target.reserved += move.bytes
+	return move, nil
+}
+
+// finishMove 释放预留的空间并重新读取两个磁盘的容量
+func (s *StorageService) finishMove(move *storageMove) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.migrating, move.folderName)
+	move.target.reserved -= move.bytes
+	// 迁移失败时复制出的目录已删除，只有成功时才调整两个磁盘的动画大小
+	if move.done {
+		move.target.LibraryGB += float64(move.bytes) / bytesPerGB
+		if move.source != nil {
+			move.source.LibraryGB -= float64(move.bytes) / bytesPerGB
+		}
+	}
+	s.updateDiskUsage(move.target)
+	if move.source != nil {
+		s.updateDiskUsage(move.source)
+	}
+}
+
+// switchCatalog 把动画、剧集、校验结果、播放记录和分配记录一次性切换到新磁盘
+func (s *StorageService) switchCatalog(move *storageMove) error {
+	s.mu.Lock()
+	placement, found := s.loadPlacement(move.folderName)
+	s.mu.Unlock()
+	placement.FolderName = move.folderName
+	placement.DiskName = move.target.Name
+	placement.UpdatedAt = time.Now()
+	if !found {
+		placement.CreatedAt = time.Now()
+	}
+
+	if LocalMode || DB == nil {
+		EpisodeServiceInstance.updateLocal(move.folderName, move.rebaseEpisode)
+		if err := PlayHistoryServiceInstance.RewriteURLPrefix(nil, move.srcURL, move.dstURL); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.cachePlacement(placement)
+		s.mu.Unlock()
+		return nil
+	}
+
+	var anime models.AnimeInfo
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("folder_name = ?", move.folderName).First(&anime)
+		if result.Error == nil {
+			result = tx.Model(&anime).UpdateColumns(map[string]interface{}{
+				"storage_disk":  move.target.Name,
+				"physical_path": move.rebasePath(anime.PhysicalPath),
+				"cover":         replaceURLPrefix(anime.Cover, move.srcURL, move.dstURL),
+				"fanart":        replaceURLPrefix(anime.Fanart, move.srcURL, move.dstURL),
+				"video_url":     replaceURLPrefix(anime.VideoURL, move.srcURL, move.dstURL),
+			})
+		}
+		if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+			return result.Error
+		}
+
+		var episodes []models.Episode
+		if result := tx.Where("anime_folder = ?", move.folderName).Find(&episodes); result.Error != nil {
+			return result.Error
+		}
+		for i := range episodes {
+			episode := &episodes[i]
+			move.rebaseEpisode(episode)
+			result := tx.Model(episode).UpdateColumns(map[string]interface{}{
+				"playlist_url":  episode.PlaylistURL,
+				"physical_path": episode.PhysicalPath,
+				"storage_disk":  episode.StorageDisk,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		var healths []models.HLSHealth
+		if result := tx.Where("anime_folder = ?", move.folderName).Find(&healths); result.Error != nil {
+			return result.Error
+		}
+		for _, health := range healths {
+			result := tx.Model(&health).UpdateColumns(map[string]interface{}{
+				"storage_disk": move.target.Name,
+				"episode_path": move.rebasePath(health.EpisodePath),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		if err := PlayHistoryServiceInstance.RewriteURLPrefix(tx, move.srcURL, move.dstURL); err != nil {
+			return err
+		}
+		return tx.Save(&placement).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cachePlacement(placement)
+	s.mu.Unlock()
+	if anime.ID != 0 {
+		SearchServiceInstance.IndexAnime(anime)
+	}
+	return nil
+}
+
+func (m *storageMove) sourceName() string {
+	if m.source == nil {
+		return CatalogDefaultDisk
+	}
+	return m.source.Name
+}
+
+func (m *storageMove) rebaseEpisode(episode *models.Episode) {
+	episode.PlaylistURL = replaceURLPrefix(episode.PlaylistURL, m.srcURL, m.dstURL)
+	episode.PhysicalPath = m.rebasePath(episode.PhysicalPath)
+	episode.StorageDisk = m.target.Name
+}
+
+// rebasePath 把源目录下的路径换成目标目录下的同一路径，其他路径原样返回
+func (m *storageMove) rebasePath(path string) string {
+	if path == "" {
+		return path
+	}
+	rel, err := filepath.Rel(m.srcDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(m.dstDir, rel)
+}
+
+// copyTreeVerified 复制整个目录，每个文件写完后重新读取并比对 SHA-256。onCopy 报告已复制的字节数
+func copyTreeVerified(srcDir string, dstDir string, total int64, onCopy func(int64, int64), stopChan <-chan struct{}) error {
+	var copied int64
+	return filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-stopChan:
+			return errMigrationStopped
+		default:
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			log.Printf("警告: 跳过非普通文件 %s\n", path)
+			return nil
+		}
+
+		size, err := copyFileVerified(path, target)
+		if err != nil {
+			return fmt.Errorf("复制 %s 失败: %v", rel, err)
+		}
+		copied += size
+		if onCopy != nil {
+			onCopy(copied, total)
+		}
+		return nil
+	})
+}
+
+// copyFileVerified 复制文件并保留修改时间，复制时计算的校验和与重新读取目标文件的校验和不同时返回错误
+func copyFileVerified(src string, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	srcHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, srcHash), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	dstSum, err := fileSHA256(dst)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(srcHash.Sum(nil), dstSum) {
+		return 0, fmt.Errorf("校验和不一致")
+	}
+	return size, nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
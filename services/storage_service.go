@@ -1,145 +1,231 @@
 package services
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"anime-website/config"
+	"anime-website/models"
+	"anime-website/utils"
 )
 
 type StorageService struct {
-	disks      []*Disk
-	currentIdx int
-	mu         sync.RWMutex
-	strategy   string
+	disks     []*Disk
+	mu        sync.RWMutex
+	strategy  string
+	placement PlacementStrategy
+	// placements 缓存已读取的动画磁盘分配记录，本地模式下只保存在这里
+	placements map[string]models.AnimePlacement
+	// migrating 记录正在迁移的动画，迁移期间不能再往这些动画写入新剧集
+	migrating map[string]bool
+	// writing 记录每部动画还没释放的预留数，有预留时说明正在转码，不能迁移
+	writing map[string]int
 }
 
+// Disk 的容量来自所在分区，UsedGB 包括分区上的其他数据。
+// MaxSizeGB 限制的是磁盘目录下动画的总大小 LibraryGB，0 表示不限制
 type Disk struct {
 	Name      string
 	Path      string
 	MaxSizeGB int
+	TotalGB   float64
+	FreeGB    float64
 	UsedGB    float64
+	// LibraryGB 是磁盘目录下所有文件的大小，由后台定期重新统计
+	LibraryGB float64
 	Priority  int
 	Enabled   bool
+	// Draining 的磁盘不再分配新动画，已在上面的动画仍可继续写入，直到被迁走
+	Draining  bool
 	LastCheck time.Time
+	// LastError 是最近一次读取容量失败的原因，不为空时不会再往这个磁盘写入
+	LastError string
+	// reserved 是正在转码、还没写完的数据预计占用的空间
+	reserved int64
 }
 
+// DiskReservation 是为一次转码在磁盘上预留的空间，转码结束后必须调用 Release
+type DiskReservation struct {
+	Disk      *Disk
+	Dir       string
+	animeName string
+	bytes     int64
+	service   *StorageService
+	once      sync.Once
+}
+
+const bytesPerGB = 1024 * 1024 * 1024
+
 var StorageServiceInstance = &StorageService{}
 
 func (s *StorageService) Init() {
 	cfg := config.Get()
 	s.strategy = cfg.Storage.Strategy
+	s.placement = NewPlacementStrategy(s.strategy)
 
+	// 未启用的磁盘也要加载，之后可以在运行时启用
 	for _, diskCfg := range cfg.Storage.Disks {
-		if diskCfg.Enabled {
-			disk := &Disk{
-				Name:      diskCfg.Name,
-				Path:      diskCfg.Path,
-				MaxSizeGB: diskCfg.MaxSizeGB,
-				Priority:  diskCfg.Priority,
-				Enabled:   true,
-			}
-			s.updateDiskUsage(disk)
-			s.disks = append(s.disks, disk)
-			log.Printf("存储服务: 添加磁盘 %s, 路径: %s, 最大容量: %dGB\n", disk.Name, disk.Path, disk.MaxSizeGB)
+		disk := &Disk{
+			Name:      diskCfg.Name,
+			Path:      diskCfg.Path,
+			MaxSizeGB: diskCfg.MaxSizeGB,
+			Priority:  diskCfg.Priority,
+			Enabled:   diskCfg.Enabled,
+			Draining:  diskCfg.Draining,
+			LibraryGB: librarySizeGB(diskCfg.Path),
 		}
+		s.updateDiskUsage(disk)
+		s.disks = append(s.disks, disk)
+		log.Printf("存储服务: 添加磁盘 %s, 路径: %s, 最大容量: %dGB, 可用: %.2fGB/%.2fGB, 启用: %v\n", disk.Name, disk.Path, disk.MaxSizeGB, disk.FreeGB, disk.TotalGB, disk.Enabled)
 	}
 
 	log.Printf("存储服务初始化完成，共 %d 个磁盘，策略: %s\n", len(s.disks), s.strategy)
 }
 
-func (s *StorageService) updateDiskUsage(disk *Disk) {
-	var size int64
-	err := filepath.Walk(disk.Path, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
+// Start 定期刷新磁盘容量
+func (s *StorageService) Start() {
+	interval := time.Duration(config.Get().Storage.RefreshMinutes) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.RefreshDiskUsage()
 		}
-		return nil
-	})
+	}()
+}
 
+func (s *StorageService) updateDiskUsage(disk *Disk) {
+	space, err := utils.GetDiskSpace(disk.Path)
+	disk.LastCheck = time.Now()
 	if err != nil {
-		log.Printf("警告: 计算磁盘 %s 使用率失败: %v\n", disk.Name, err)
-		disk.UsedGB = 0
-	} else {
-		disk.UsedGB = float64(size) / (1024 * 1024 * 1024)
+		log.Printf("警告: 读取磁盘 %s 容量失败: %v\n", disk.Name, err)
+		disk.LastError = err.Error()
+		return
 	}
 
-	disk.LastCheck = time.Now()
+	disk.TotalGB = float64(space.Total) / bytesPerGB
+	disk.FreeGB = float64(space.Free) / bytesPerGB
+	disk.UsedGB = float64(space.Used) / bytesPerGB
+	disk.LastError = ""
 }
 
-func (s *StorageService) GetDiskForStorage(animeName string) *Disk {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ReservedGB 返回磁盘上已预留的空间
+func (d *Disk) ReservedGB() float64 {
+	return float64(d.reserved) / bytesPerGB
+}
 
+// fits 判断写入 bytes 后动画总大小是否仍在最大容量以内，并且剩余空间不低于配置的下限
+func (d *Disk) fits(bytes int64) bool {
+	if !d.Enabled || d.LastError != "" || d.TotalGB == 0 {
+		return false
+	}
+	need := float64(d.reserved+bytes) / bytesPerGB
+	if d.MaxSizeGB > 0 && d.LibraryGB+need > float64(d.MaxSizeGB) {
+		return false
+	}
+	return d.FreeGB-need >= config.Get().Storage.MinFreeGB
+}
+
+// selectDisk 按策略从能再写入 estimateBytes 的磁盘中选择一个，正在清空和 exclude 中的磁盘不参与选择
+func (s *StorageService) selectDisk(animeName string, estimateBytes int64, exclude ...*Disk) *Disk {
 	if len(s.disks) == 0 {
 		log.Printf("错误: 没有可用的存储磁盘\n")
 		return nil
 	}
 
-	var disk *Disk
-	switch s.strategy {
-	case "round-robin":
-		disk = s.roundRobinDisk()
-	case "least-used":
-		disk = s.leastUsedDisk()
-	case "random":
-		disk = s.randomDisk()
-	default:
-		disk = s.leastUsedDisk()
+	var candidates []*Disk
+	for _, disk := range s.disks {
+		if disk.fits(estimateBytes) && !disk.Draining && !slices.Contains(exclude, disk) {
+			candidates = append(candidates, disk)
+		}
+	}
+	if len(candidates) == 0 {
+		log.Printf("错误: 没有磁盘能再写入 %.2fGB\n", float64(estimateBytes)/bytesPerGB)
+		return nil
 	}
 
+	disk := s.placement.Select(animeName, candidates)
+
 	if disk != nil {
-		log.Printf("存储服务: 为动画 %s 选择磁盘 %s (使用率: %.2fGB/%dGB)\n", animeName, disk.Name, disk.UsedGB, disk.MaxSizeGB)
+		log.Printf("存储服务: 为动画 %s 选择磁盘 %s (动画: %.2fGB/%dGB, 可用: %.2fGB, 预留: %.2fGB)\n", animeName, disk.Name, disk.LibraryGB, disk.MaxSizeGB, disk.FreeGB, disk.ReservedGB())
 	}
 
 	return disk
 }
 
-func (s *StorageService) roundRobinDisk() *Disk {
-	disk := s.disks[s.currentIdx]
-	s.currentIdx = (s.currentIdx + 1) % len(s.disks)
-	return disk
-}
+// Reserve 为动画选择磁盘并预留 estimateBytes 的空间。没有配置磁盘时使用默认HLS目录，不做预留
+func (s *StorageService) Reserve(animeName string, estimateBytes int64) (*DiskReservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func (s *StorageService) leastUsedDisk() *Disk {
-	var bestDisk *Disk
-	minUsage := float64(100000)
+	if s.migrating[animeName] {
+		return nil, fmt.Errorf("动画 %s 正在迁移，请稍后再试", animeName)
+	}
 
-	for _, disk := range s.disks {
-		if disk.Enabled && disk.UsedGB < minUsage {
-			minUsage = disk.UsedGB
-			bestDisk = disk
+	reservation := &DiskReservation{Dir: filepath.Join("static/hls", animeName), animeName: animeName, service: s}
+	if len(s.disks) > 0 {
+		disk, err := s.placementDisk(animeName, estimateBytes)
+		if err != nil {
+			return nil, err
 		}
+		disk.reserved += estimateBytes
+		reservation.Disk = disk
+		reservation.Dir = filepath.Join(disk.Path, animeName)
+		reservation.bytes = estimateBytes
 	}
 
-	return bestDisk
+	if s.writing == nil {
+		s.writing = make(map[string]int)
+	}
+	s.writing[animeName]++
+	return reservation, nil
 }
 
-func (s *StorageService) randomDisk() *Disk {
-	for _, disk := range s.disks {
-		if disk.Enabled {
-			return disk
+// IsWriting 判断动画是否有还没释放的预留，也就是正在往里面转码
+func (s *StorageService) IsWriting(animeName string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.writing[animeName] > 0
+}
+
+// Release 释放预留的空间并重新读取磁盘容量，多次调用只生效一次
+func (r *DiskReservation) Release() {
+	r.once.Do(func() {
+		r.service.mu.Lock()
+		defer r.service.mu.Unlock()
+		if r.service.writing[r.animeName]--; r.service.writing[r.animeName] <= 0 {
+			delete(r.service.writing, r.animeName)
 		}
-	}
-	return nil
+		if r.Disk != nil {
+			r.Disk.reserved -= r.bytes
+			// 先按预估大小计入，下次后台刷新时重新统计实际大小
+			r.Disk.LibraryGB += float64(r.bytes) / bytesPerGB
+			r.service.updateDiskUsage(r.Disk)
+		}
+	})
 }
 
+// GetHLSPath 返回动画切片所在的目录，还没有分配磁盘的动画返回默认HLS目录。只查询，不分配磁盘
 func (s *StorageService) GetHLSPath(animeName string) string {
-	disk := s.GetDiskForStorage(animeName)
+	s.mu.Lock()
+	disk := s.lookupDisk(animeName)
+	s.mu.Unlock()
 	if disk == nil {
 		return filepath.Join("static/hls", animeName)
 	}
 	return filepath.Join(disk.Path, animeName)
 }
 
+// GetHLSURL 返回动画切片的访问地址，规则与 GetHLSPath 相同
 func (s *StorageService) GetHLSURL(animeName string) string {
-	disk := s.GetDiskForStorage(animeName)
+	s.mu.Lock()
+	disk := s.lookupDisk(animeName)
+	s.mu.Unlock()
 	if disk == nil {
 		return "/hls/" + animeName
 	}
@@ -149,7 +235,11 @@ func (s *StorageService) GetHLSURL(animeName string) string {
 func (s *StorageService) FindDiskByAnimeName(animeName string) *Disk {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.findAnimeData(animeName)
+}
 
+// findAnimeData 返回已经存有该动画目录的磁盘，调用方需持有锁
+func (s *StorageService) findAnimeData(animeName string) *Disk {
 	for _, disk := range s.disks {
 		if !disk.Enabled {
 			continue
@@ -165,7 +255,10 @@ func (s *StorageService) FindDiskByAnimeName(animeName string) *Disk {
 func (s *StorageService) GetDiskByName(name string) *Disk {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.diskByName(name)
+}
 
+func (s *StorageService) diskByName(name string) *Disk {
 	for _, disk := range s.disks {
 		if disk.Name == name {
 			return disk
@@ -183,16 +276,31 @@ func (s *StorageService) GetAllDisks() []*Disk {
 	return disks
 }
 
+// RefreshDiskUsage 重新读取分区容量并统计每个磁盘目录的大小。统计目录大小较慢，不持有锁
 func (s *StorageService) RefreshDiskUsage() {
+	disks := s.GetAllDisks()
+	sizes := make([]float64, len(disks))
+	for i, disk := range disks {
+		sizes[i] = librarySizeGB(disk.Path)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, disk := range s.disks {
+	for i, disk := range disks {
+		disk.LibraryGB = sizes[i]
 		s.updateDiskUsage(disk)
-		log.Printf("存储服务: 磁盘 %s 使用率 %.2fGB/%dGB\n", disk.Name, disk.UsedGB, disk.MaxSizeGB)
+		log.Printf("存储服务: 磁盘 %s 动画 %.2fGB/%dGB, 分区可用 %.2fGB\n", disk.Name, disk.LibraryGB, disk.MaxSizeGB, disk.FreeGB)
 	}
 }
 
+// librarySizeGB 统计磁盘目录下所有文件的大小
+func librarySizeGB(path string) float64 {
+	return float64(directorySize(path)) / bytesPerGB
+}
+
 func (s *StorageService) UpdateDiskUsage(disk *Disk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.updateDiskUsage(disk)
 }
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"anime-website/config"
+)
+
+// 记录每集使用的转码配置，和播放列表放在同一目录
+const profileRecordName = "transcode.json"
+
+type ProfileRecord struct {
+	Profile   config.TranscodeProfile `json:"profile"`
+	Source    string                  `json:"source"`
+	CreatedAt time.Time               `json:"createdAt"`
+}
+
+// ResolveProfile 按名称获取转码配置，名称为空时使用默认配置
+func ResolveProfile(name string) (config.TranscodeProfile, error) {
+	profile, ok := config.Get().Transcode.Profile(name)
+	if !ok {
+		return profile, &UserError{Message: "转码配置不存在: " + name}
+	}
+	return profile, nil
+}
+
+// ProfileEncodeArgs 生成音视频编码部分的参数
+func ProfileEncodeArgs(profile config.TranscodeProfile) []string {
+	var args []string
+
+	switch profile.Mode {
+	case config.ProfileModeCopy:
+		args = append(args, "-c:v", "copy", "-c:a", "copy")
+	case config.ProfileModeAudioNormalize:
+		args = append(args,
+			"-c:v", "copy",
+			"-af", "loudnorm=I=-16:TP=-1.5:LRA=11",
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", profile.AudioBitrateK),
+			"-ar", "48000",
+		)
+	default:
+		args = append(args, "-c:v", profile.VideoEncoder)
+		if profile.IsNVENC() {
+			args = append(args, "-rc", "vbr", "-cq", strconv.Itoa(profile.CRF))
+		} else {
+			args = append(args, "-crf", strconv.Itoa(profile.CRF))
+		}
+		if profile.Preset != "" {
+			args = append(args, "-preset", profile.Preset)
+		}
+		if profile.Mode == config.ProfileModeHEVC {
+			// Safari 只识别 hvc1 标签的HEVC
+			args = append(args, "-tag:v", "hvc1")
+		}
+		args = append(args, keyframeArgs(profile.SegmentSeconds)...)
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", profile.AudioBitrateK),
+			"-ac", "2",
+		)
+	}
+
+	return append(args, profile.ExtraArgs...)
+}
+
+// ProfileHLSArgs 生成HLS封装部分的参数，切片写入 outputDir
+func ProfileHLSArgs(profile config.TranscodeProfile, outputDir string) []string {
+	args := []string{
+		"-hls_time", strconv.Itoa(profile.SegmentSeconds),
+		"-hls_list_size", "0",
+		"-hls_segment_filename", filepath.Join(outputDir, segmentFilePattern(profile)),
+	}
+	if profile.SegmentType == config.SegmentTypeFMP4 {
+		args = append(args, "-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", "init.mp4")
+	} else {
+		args = append(args, "-hls_segment_type", "mpegts")
+	}
+	return args
+}
+
+func segmentFilePattern(profile config.TranscodeProfile) string {
+	if profile.SegmentType == config.SegmentTypeFMP4 {
+		return "segment_%03d.m4s"
+	}
+	return "segment_%03d.ts"
+}
+
+// keyframeArgs 让关键帧落在切片边界上，保证切片时长准确
+func keyframeArgs(segmentSeconds int) []string {
+	return []string{
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+	}
+}
+
+// WriteProfileRecord 把本次使用的转码配置写入输出目录
+func WriteProfileRecord(outputDir string, profile config.TranscodeProfile, source string) error {
+	data, err := json.MarshalIndent(ProfileRecord{
+		Profile:   profile,
+		Source:    source,
+		CreatedAt: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, profileRecordName), data, 0644)
+}
+
+// ReadProfileRecord 读取剧集目录中记录的转码配置
+func ReadProfileRecord(outputDir string) (*ProfileRecord, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, profileRecordName))
+	if err != nil {
+		return nil, err
+	}
+	var record ProfileRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GenerateHLSWithProfile 按指定转码配置生成HLS切片，并记录使用的配置。stopChan 关闭时终止ffmpeg
+func (s *VideoService) GenerateHLSWithProfile(videoPath string, profile config.TranscodeProfile, onProgress func(FFmpegProgress), stopChan <-chan struct{}) error {
+	videoFilePath := s.getVideoFilePath(videoPath)
+	animeName, episodeName := s.splitVideoPath(videoPath)
+
+	// 按预计大小预留磁盘空间，避免同时转码的多个视频写满同一个磁盘
+	reservation, err := StorageServiceInstance.Reserve(animeName, estimateHLSSize(videoFilePath, profile))
+	if err != nil {
+		return err
+	}
+	defer reservation.Release()
+	hlsDirPath := filepath.Join(reservation.Dir, episodeName)
+
+	if err := os.MkdirAll(hlsDirPath, 0755); err != nil {
+		return fmt.Errorf("创建HLS目录失败: %v", err)
+	}
+
+	if profile.Mode == config.ProfileModeABR {
+		err = s.generateABRHLS(videoFilePath, hlsDirPath, profile, onProgress, stopChan)
+	} else {
+		err = s.generateSingleHLS(videoFilePath, hlsDirPath, profile, onProgress, stopChan)
+	}
+	if err != nil {
+		reservation.Release()
+		if defaultProfile, resolveErr := ResolveProfile(""); err != ErrFFmpegStopped && profile.IsNVENC() && resolveErr == nil && defaultProfile.Name != profile.Name {
+			log.Printf("警告: GPU编码失败，改用默认转码配置 %s: %v\n", defaultProfile.Name, err)
+			return s.GenerateHLSWithProfile(videoPath, defaultProfile, onProgress, stopChan)
+		}
+		return err
+	}
+
+	if err := WriteProfileRecord(hlsDirPath, profile, videoPath); err != nil {
+		log.Printf("警告: 记录转码配置失败: %v\n", err)
+	}
+
+	if health := HLSVerifyServiceInstance.VerifyEpisodeDir(animeName, episodeName, hlsDirPath); !health.Healthy {
+		log.Printf("警告: %s 生成的HLS校验异常: %v\n", videoPath, health.ProblemList())
+	}
+
+	RetentionServiceInstance.Apply(videoFilePath, hlsDirPath)
+	return nil
+}
+
+// estimateHLSSize 估算切片大小：单一清晰度按源文件大小，多码率按清晰度个数成倍估算
+func estimateHLSSize(videoFilePath string, profile config.TranscodeProfile) int64 {
+	info, err := os.Stat(videoFilePath)
+	if err != nil {
+		return 0
+	}
+	size := info.Size()
+	if profile.Mode == config.ProfileModeABR {
+		if renditions := len(config.Get().Transcode.Ladder); renditions > 1 {
+			size *= int64(renditions)
+		}
+	}
+	return size
+}
+
+func (s *VideoService) generateSingleHLS(videoFilePath string, hlsDirPath string, profile config.TranscodeProfile, onProgress func(FFmpegProgress), stopChan <-chan struct{}) error {
+	duration, err := ProbeDuration(videoFilePath)
+	if err != nil {
+		log.Printf("警告: 获取视频 %s 时长失败，无法计算进度: %v\n", videoFilePath, err)
+	}
+
+	args := []string{
+		"-err_detect", "ignore_err",
+		"-i", videoFilePath,
+	}
+	args = append(args, ProfileEncodeArgs(profile)...)
+	args = append(args, ProfileHLSArgs(profile, hlsDirPath)...)
+	args = append(args,
+		"-hls_flags", "discont_start+temp_file+independent_segments",
+		"-avoid_negative_ts", "make_zero",
+		"-fflags", "+genpts+igndts",
+		"-reset_timestamps", "1",
+		"-loglevel", "error",
+		"-y",
+		filepath.Join(hlsDirPath, variantPlaylistName),
+	)
+
+	return RunFFmpegWithStop(args, duration, onProgress, stopChan)
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"anime-website/models"
+)
+
+// 每个磁盘的回收站目录，以 . 开头，扫描和监听都会跳过
+const trashDirName = ".trash"
+
+type TrashService struct {
+	mu     sync.Mutex
+	local  []models.TrashItem
+	nextID uint
+}
+
+var TrashServiceInstance = &TrashService{}
+
+// TrashBatch 是一次删除移入回收站的所有目录
+type TrashBatch struct {
+	Batch      string             `json:"batch"`
+	AnimeID    uint               `json:"animeId"`
+	FolderName string             `json:"folderName"`
+	Title      string             `json:"title"`
+	DeletedBy  uint               `json:"deletedBy"`
+	DeletedAt  time.Time          `json:"deletedAt"`
+	Items      []models.TrashItem `json:"items"`
+}
+
+// MoveToTrash 把动画的HLS目录和源视频目录移到各自磁盘的回收站，并软删除动画记录
+func (s *TrashService) MoveToTrash(folderName string, userID uint) (*TrashBatch, error) {
+	anime, hasRecord := s.findAnime(folderName)
+
+	type source struct {
+		kind     string
+		diskName string
+		path     string
+	}
+	var sources []source
+	for _, location := range animeHLSLocations(anime, folderName) {
+		sources = append(sources, source{kind: models.TrashKindHLS, diskName: location.DiskName, path: location.Dir})
+	}
+	sourceDir := filepath.Join(videosDir, folderName)
+	if info, err := os.Stat(sourceDir); err == nil && info.IsDir() {
+		sources = append(sources, source{kind: models.TrashKindSource, path: sourceDir})
+	}
+
+	if len(sources) == 0 && !hasRecord {
+		return nil, &UserError{Message: "找不到动画: " + folderName}
+	}
+
+	batchName := folderName + "-" + time.Now().Format("20060102150405")
+	batch := &TrashBatch{
+		Batch:      batchName,
+		AnimeID:    anime.ID,
+		FolderName: folderName,
+		Title:      anime.Title,
+		DeletedBy:  userID,
+		DeletedAt:  time.Now(),
+	}
+
+	for _, src := range sources {
+		trashPath := filepath.Join(filepath.Dir(src.path), trashDirName, batchName)
+		if err := os.MkdirAll(filepath.Dir(trashPath), 0755); err != nil {
+			s.rollback(batch.Items)
+			return nil, fmt.Errorf("创建回收站目录失败: %v", err)
+		}
+		// 回收站和原目录在同一磁盘上，rename 是原子的
+		if err := os.Rename(src.path, trashPath); err != nil {
+			s.rollback(batch.Items)
+			return nil, fmt.Errorf("移动 %s 到回收站失败: %v", src.path, err)
+		}
+		log.Printf("已将 %s 移到回收站: %s\n", src.path, trashPath)
+
+		batch.Items = append(batch.Items, models.TrashItem{
+			Batch:        batchName,
+			AnimeID:      anime.ID,
+			FolderName:   folderName,
+			Title:        anime.Title,
+			Kind:         src.kind,
+			StorageDisk:  src.diskName,
+			OriginalPath: src.path,
+			TrashPath:    trashPath,
+			DeletedBy:    userID,
+			CreatedAt:    batch.DeletedAt,
+		})
+	}
+
+	for i := range batch.Items {
+		s.create(&batch.Items[i])
+	}
+	SearchServiceInstance.RemoveAnime(folderName)
+
+	if hasRecord && !LocalMode && DB != nil {
+		if result := DB.Delete(&anime); result.Error != nil {
+			log.Printf("错误: 软删除动画信息失败: %v\n", result.Error)
+		} else {
+			log.Printf("成功软删除动画信息: %s\n", folderName)
+		}
+	}
+	if LocalMode || DB == nil {
+		EpisodeServiceInstance.DeleteByAnime(folderName)
+	}
+
+	return batch, nil
+}
+
+// ListTrash 按删除时间倒序列出回收站
+func (s *TrashService) ListTrash() ([]TrashBatch, error) {
+	items, err := s.listItems("")
+	if err != nil {
+		return nil, err
+	}
+
+	batches := []TrashBatch{}
+	index := make(map[string]int)
+	for _, item := range items {
+		i, exists := index[item.Batch]
+		if !exists {
+			i = len(batches)
+			index[item.Batch] = i
+			batches = append(batches, TrashBatch{
+				Batch:      item.Batch,
+				AnimeID:    item.AnimeID,
+				FolderName: item.FolderName,
+				Title:      item.Title,
+				DeletedBy:  item.DeletedBy,
+				DeletedAt:  item.CreatedAt,
+			})
+		}
+		batches[i].Items = append(batches[i].Items, item)
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].DeletedAt.After(batches[j].DeletedAt)
+	})
+	return batches, nil
+}
+
+// Restore 把回收站中的目录移回原位置，并恢复动画记录
+func (s *TrashService) Restore(batchName string) (*models.AnimeInfo, error) {
+	items, err := s.listItems(batchName)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, &UserError{Message: "回收站中没有该记录"}
+	}
+
+	folderName := items[0].FolderName
+	if _, exists := s.findAnime(folderName); exists {
+		return nil, &UserError{Message: "已存在同名动画，无法恢复: " + folderName}
+	}
+	for _, item := range items {
+		if _, err := os.Stat(item.OriginalPath); err == nil {
+			return nil, &UserError{Message: "原目录已存在，无法恢复: " + item.OriginalPath}
+		}
+	}
+
+	for _, item := range items {
+		if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := os.Rename(item.TrashPath, item.OriginalPath); err != nil {
+			return nil, fmt.Errorf("从回收站恢复 %s 失败: %v", item.OriginalPath, err)
+		}
+		s.delete(item)
+		log.Printf("已从回收站恢复: %s\n", item.OriginalPath)
+	}
+
+	if items[0].AnimeID != 0 && !LocalMode && DB != nil {
+		result := DB.Unscoped().Model(&models.AnimeInfo{}).Where("id = ?", items[0].AnimeID).Updates(map[string]interface{}{
+			"deleted_at":    nil,
+			"missing_since": nil,
+		})
+		if result.Error != nil {
+			log.Printf("错误: 恢复动画信息失败: %v\n", result.Error)
+		}
+	}
+
+	anime, found := VideoServiceInstance.SyncAnime(folderName)
+	if !found {
+		return nil, nil
+	}
+	return &anime, nil
+}
+
+// Purge 彻底删除回收站中的目录，同时删除动画记录、剧集和播放记录。batchName 为空时清空回收站
+func (s *TrashService) Purge(batchName string) (int, error) {
+	items, err := s.listItems(batchName)
+	if err != nil {
+		return 0, err
+	}
+	if batchName != "" && len(items) == 0 {
+		return 0, &UserError{Message: "回收站中没有该记录"}
+	}
+
+	purged := make(map[string]bool)
+	for _, item := range items {
+		if err := os.RemoveAll(item.TrashPath); err != nil {
+			log.Printf("警告: 删除回收站目录 %s 失败: %v\n", item.TrashPath, err)
+			continue
+		}
+		s.delete(item)
+		log.Printf("已彻底删除: %s\n", item.TrashPath)
+
+		if purged[item.Batch] {
+			continue
+		}
+		purged[item.Batch] = true
+		s.purgeRecords(item)
+	}
+
+	return len(purged), nil
+}
+
+// purgeRecords 删除已软删除的动画记录以及关联的剧集、播放记录
+func (s *TrashService) purgeRecords(item models.TrashItem) {
+	prefixes := []string{"/hls/" + item.FolderName + "/"}
+	if item.StorageDisk != "" {
+		prefixes = append(prefixes, "/storage/"+item.StorageDisk+"/"+item.FolderName+"/")
+	}
+	PlayHistoryServiceInstance.DeleteByAnime(item.AnimeID, prefixes)
+
+	if item.AnimeID == 0 || LocalMode || DB == nil {
+		return
+	}
+
+	var anime models.AnimeInfo
+	if result := DB.Unscoped().First(&anime, item.AnimeID); result.Error != nil || !anime.DeletedAt.Valid {
+		// 动画已经被恢复或重新创建，只删除目录
+		return
+	}
+	MetadataServiceInstance.ClearTags(item.AnimeID)
+	if result := DB.Where("anime_id = ?", item.AnimeID).Delete(&models.Episode{}); result.Error != nil {
+		log.Printf("错误: 删除剧集失败: %v\n", result.Error)
+	}
+	if result := DB.Unscoped().Delete(&anime); result.Error != nil {
+		log.Printf("错误: 删除动画信息失败: %v\n", result.Error)
+		return
+	}
+	StorageServiceInstance.ForgetPlacement(item.FolderName)
+}
+
+// rollback 移动失败时把已移走的目录放回原位
+func (s *TrashService) rollback(items []models.TrashItem) {
+	for _, item := range items {
+		if err := os.Rename(item.TrashPath, item.OriginalPath); err != nil {
+			log.Printf("错误: 恢复目录 %s 失败: %v\n", item.OriginalPath, err)
+		}
+	}
+}
+
+func (s *TrashService) findAnime(folderName string) (models.AnimeInfo, bool) {
+	var anime models.AnimeInfo
+	if LocalMode || DB == nil {
+		return anime, false
+	}
+	if result := DB.Where("folder_name = ?", folderName).First(&anime); result.Error != nil {
+		return anime, false
+	}
+	return anime, true
+}
+
+// animeHLSLocations 找出动画实际所在的HLS目录，优先使用记录的物理路径，再查找所有磁盘
+func animeHLSLocations(anime models.AnimeInfo, folderName string) []episodeLocation {
+	var locations []episodeLocation
+	seen := make(map[string]bool)
+
+	add := func(dir string) {
+		cleaned := filepath.Clean(dir)
+		if seen[cleaned] {
+			return
+		}
+		if info, err := os.Stat(cleaned); err == nil && info.IsDir() {
+			seen[cleaned] = true
+			locations = append(locations, episodeLocation{
+				AnimeFolder: folderName,
+				Dir:         cleaned,
+				DiskName:    diskNameForPath(cleaned),
+			})
+		}
+	}
+
+	if anime.PhysicalPath != "" {
+		add(anime.PhysicalPath)
+	}
+	for _, root := range VideoServiceInstance.hlsRoots() {
+		add(filepath.Join(root, folderName))
+	}
+	return locations
+}
+
+func (s *TrashService) listItems(batchName string) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+
+	if !LocalMode && DB != nil {
+		query := DB.Order("id ASC")
+		if batchName != "" {
+			query = query.Where("batch = ?", batchName)
+		}
+		if result := query.Find(&items); result.Error != nil {
+			log.Printf("错误: 获取回收站记录失败: %v\n", result.Error)
+			return nil, result.Error
+		}
+		return items, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.local {
+		if batchName == "" || item.Batch == batchName {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *TrashService) create(item *models.TrashItem) {
+	if !LocalMode && DB != nil {
+		if result := DB.Create(item); result.Error != nil {
+			log.Printf("错误: 保存回收站记录失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	item.ID = s.nextID
+	s.local = append(s.local, *item)
+}
+
+func (s *TrashService) delete(item models.TrashItem) {
+	if !LocalMode && DB != nil {
+		if result := DB.Delete(&models.TrashItem{}, item.ID); result.Error != nil {
+			log.Printf("错误: 删除回收站记录失败: %v\n", result.Error)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.local {
+		if s.local[i].ID == item.ID {
+			s.local = append(s.local[:i], s.local[i+1:]...)
+			return
+		}
+	}
+}
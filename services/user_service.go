@@ -1,10 +1,15 @@
 package services
 
 import (
+	"crypto/subtle"
 	"log"
+	"strings"
 	"time"
 
+	"anime-website/config"
 	"anime-website/models"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct{}
@@ -23,10 +28,17 @@ func (s *UserService) Register(username, email, password string) (*models.User,
 		return nil, &UserError{Message: "邮箱已存在"}
 	}
 
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		log.Printf("错误: 密码加密失败: %v\n", err)
+		return nil, err
+	}
+
 	user := models.User{
 		Username:  username,
 		Email:     email,
-		Password:  password,
+		Password:  hashedPassword,
+		Role:      models.RoleViewer,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -47,13 +59,64 @@ func (s *UserService) Login(username, password string) (*models.User, error) {
 		return nil, &UserError{Message: "用户名或密码错误"}
 	}
 
-	if user.Password != password {
+	if !isPasswordHash(user.Password) {
+		if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+			return nil, &UserError{Message: "用户名或密码错误"}
+		}
+		s.upgradePassword(&user, password)
+		return &user, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
 		return nil, &UserError{Message: "用户名或密码错误"}
 	}
 
+	if cost, err := bcrypt.Cost([]byte(user.Password)); err == nil && cost != passwordCost() {
+		s.upgradePassword(&user, password)
+	}
+
 	return &user, nil
 }
 
+// upgradePassword 将明文或旧成本的密码重新加密保存，失败不影响本次登录
+func (s *UserService) upgradePassword(user *models.User, password string) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		log.Printf("警告: 升级用户 %s 的密码失败: %v\n", user.Username, err)
+		return
+	}
+
+	result := DB.Model(user).Update("password", hashedPassword)
+	if result.Error != nil {
+		log.Printf("警告: 保存用户 %s 的新密码失败: %v\n", user.Username, result.Error)
+		return
+	}
+	log.Printf("已升级用户 %s 的密码存储格式\n", user.Username)
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func passwordCost() int {
+	cost := config.Get().Auth.BcryptCost
+	if cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+	if cost > bcrypt.MaxCost {
+		return bcrypt.MaxCost
+	}
+	return cost
+}
+
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
 func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	var user models.User
 	result := DB.First(&user, id)
@@ -63,6 +126,46 @@ func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// BootstrapAdmin 将指定用户提升为管理员，用于首次部署
+func (s *UserService) BootstrapAdmin(username string) error {
+	if LocalMode || DB == nil {
+		return &UserError{Message: "本地模式不支持设置管理员"}
+	}
+
+	var user models.User
+	result := DB.Where("username = ?", username).First(&user)
+	if result.Error != nil {
+		return &UserError{Message: "用户不存在: " + username}
+	}
+
+	if user.Role == models.RoleAdmin {
+		return nil
+	}
+
+	result = DB.Model(&user).Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("已将用户 %s 提升为管理员\n", username)
+	return nil
+}
+
+func (s *UserService) SetRole(userID uint, role string) error {
+	if !models.IsValidRole(role) {
+		return &UserError{Message: "无效的角色"}
+	}
+
+	result := DB.Model(&models.User{}).Where("id = ?", userID).Update("role", role)
+	if result.Error != nil {
+		log.Printf("错误: 更新用户角色失败: %v\n", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &UserError{Message: "用户不存在"}
+	}
+	return nil
+}
+
 type UserError struct {
 	Message string
 }
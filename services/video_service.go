@@ -5,13 +5,13 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"anime-website/config"
 	"anime-website/models"
 	"anime-website/utils"
 
@@ -34,8 +34,6 @@ var historyMap = make(map[string]models.PlayHistory)
 var historyMu sync.Mutex
 var movedCoverDirs = make(map[string]bool)
 var movedCoverDirsMutex sync.Mutex
-var BatchProcessingContexts = make(map[string]map[string]interface{})
-var BatchProcessingMutex sync.Mutex
 
 func (s *VideoService) ScanVideos() []models.AnimeInfo {
 	var animes []models.AnimeInfo
@@ -59,7 +57,7 @@ func (s *VideoService) ScanVideos() []models.AnimeInfo {
 		}
 
 		for _, entry := range entries {
-			if entry.IsDir() {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 				animeName := entry.Name()
 				hlsAnimePath := filepath.Join(hlsDir, animeName)
 				wg.Add(1)
@@ -78,7 +76,7 @@ func (s *VideoService) ScanVideos() []models.AnimeInfo {
 			}
 
 			for _, entry := range entries {
-				if entry.IsDir() {
+				if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 					animeName := entry.Name()
 					hlsAnimePath := filepath.Join(disk.Path, animeName)
 					wg.Add(1)
@@ -94,6 +92,10 @@ func (s *VideoService) ScanVideos() []models.AnimeInfo {
 		return animes[i].Title < animes[j].Title
 	})
 
+	if !LocalMode {
+		ReconcileServiceInstance.Reconcile()
+	}
+
 	return animes
 }
 
@@ -112,19 +114,20 @@ func (s *VideoService) scanAnimeDirectory(animeName string, hlsAnimePath string,
 	if err == nil {
 		for _, hlsEntry := range hlsEntries {
 			if hlsEntry.IsDir() {
-				playlistPath := filepath.Join(hlsAnimePath, hlsEntry.Name(), "playlist.m3u8")
-				if _, err := os.Stat(playlistPath); err == nil {
+				playlistName, found := findEpisodePlaylist(filepath.Join(hlsAnimePath, hlsEntry.Name()))
+				if found {
+					playlistPath := filepath.Join(hlsAnimePath, hlsEntry.Name(), playlistName)
 					var hlsURL string
 					var physicalPath string
 
 					if basePath == hlsDir {
-						hlsURL = utils.NormalizeURLPath(strings.Join([]string{"/hls", animeName, hlsEntry.Name(), "playlist.m3u8"}, "/"))
+						hlsURL = utils.NormalizeURLPath(strings.Join([]string{"/hls", animeName, hlsEntry.Name(), playlistName}, "/"))
 						physicalPath = playlistPath
 					} else if disk != nil {
-						hlsURL = "/storage/" + disk.Name + "/" + animeName + "/" + hlsEntry.Name() + "/playlist.m3u8"
+						hlsURL = "/storage/" + disk.Name + "/" + animeName + "/" + hlsEntry.Name() + "/" + playlistName
 						physicalPath = playlistPath
 					} else {
-						hlsURL = utils.NormalizeURLPath(strings.Join([]string{"/hls", animeName, hlsEntry.Name(), "playlist.m3u8"}, "/"))
+						hlsURL = utils.NormalizeURLPath(strings.Join([]string{"/hls", animeName, hlsEntry.Name(), playlistName}, "/"))
 						physicalPath = playlistPath
 					}
 
@@ -140,7 +143,7 @@ func (s *VideoService) scanAnimeDirectory(animeName string, hlsAnimePath string,
 
 	if len(videos) > 0 {
 		sort.Slice(videos, func(i, j int) bool {
-			return videos[i].FileName < videos[j].FileName
+			return utils.EpisodeLess(videos[i].FileName, videos[j].FileName)
 		})
 
 		mainVideo := videos[0]
@@ -172,64 +175,153 @@ func (s *VideoService) scanAnimeDirectory(animeName string, hlsAnimePath string,
 			StorageDisk:  diskName,
 		}
 
+		// 源视频目录和HLS目录中的元数据文件，HLS目录中的优先
+		sourceDir := filepath.Join(videosDir, animeName)
+		sidecar, hasSidecar := ReadAnimeSidecar(
+			SidecarLocation{Dir: sourceDir, URL: utils.NormalizeURLPath(strings.Join([]string{"/", videosDir, animeName}, "/"))},
+			SidecarLocation{Dir: hlsAnimePath, URL: animeBaseURL(animeName, basePath, disk)},
+		)
+		if hasSidecar {
+			sidecar.Apply(&anime, coverURL != "/static/css/default-cover.jpg")
+		}
+		for i := range videos {
+			videos[i].Title = sidecar.EpisodeTitle(videos[i], hlsAnimePath, sourceDir)
+		}
+
+		if !LocalMode {
+			anime = s.updateAnimeInfo(anime)
+		}
+		EpisodeServiceInstance.SyncEpisodes(anime, videos)
+		SearchServiceInstance.IndexAnime(anime)
+
 		mutex.Lock()
 		*animes = append(*animes, anime)
 		mutex.Unlock()
+	}
+}
 
-		if !LocalMode {
-			s.updateAnimeInfo(anime)
+// animeBaseURL 返回动画HLS目录的访问地址
+func animeBaseURL(animeName string, basePath string, disk *Disk) string {
+	if basePath != hlsDir && disk != nil {
+		return "/storage/" + disk.Name + "/" + animeName
+	}
+	return utils.NormalizeURLPath(strings.Join([]string{"/hls", animeName}, "/"))
+}
+
+// hlsRoots 返回存放HLS切片的根目录：配置了磁盘时是所有启用的磁盘，否则是默认HLS目录
+func (s *VideoService) hlsRoots() []string {
+	disks := StorageServiceInstance.GetAllDisks()
+	if len(disks) == 0 {
+		return []string{hlsDir}
+	}
+
+	var roots []string
+	for _, disk := range disks {
+		if disk.Enabled {
+			roots = append(roots, disk.Path)
+		}
+	}
+	return roots
+}
+
+// SyncAnime 只重新扫描一个动画目录，目录不存在或没有剧集时标记为缺失
+func (s *VideoService) SyncAnime(animeName string) (models.AnimeInfo, bool) {
+	var animes []models.AnimeInfo
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, basePath := range s.hlsRoots() {
+		hlsAnimePath := filepath.Join(basePath, animeName)
+		if info, err := os.Stat(hlsAnimePath); err == nil && info.IsDir() {
+			wg.Add(1)
+			s.scanAnimeDirectory(animeName, hlsAnimePath, basePath, &mutex, &wg, &animes)
+			if len(animes) > 0 {
+				return animes[0], true
+			}
 		}
 	}
+
+	ReconcileServiceInstance.MarkMissing(animeName)
+	return models.AnimeInfo{}, false
 }
 
-func (s *VideoService) updateAnimeInfo(anime models.AnimeInfo) {
+// removeAnimeRecord 删除动画和剧集记录，保留播放记录
+func (s *VideoService) removeAnimeRecord(folderName string) {
+	EpisodeServiceInstance.DeleteByAnime(folderName)
+	SearchServiceInstance.RemoveAnime(folderName)
+
+	if !LocalMode && DB != nil {
+		var anime models.AnimeInfo
+		if result := DB.Where("folder_name = ?", folderName).First(&anime); result.Error == nil {
+			MetadataServiceInstance.ClearTags(anime.ID)
+		}
+
+		result := DB.Unscoped().Where("folder_name = ? AND deleted_at IS NULL", folderName).Delete(&models.AnimeInfo{})
+		if result.Error != nil {
+			log.Printf("错误: 从数据库删除动画信息失败: %v\n", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("成功从数据库删除动画信息: %s\n", folderName)
+		}
+	}
+}
+
+// updateAnimeInfo 写入或更新动画信息，返回数据库中的记录
+func (s *VideoService) updateAnimeInfo(anime models.AnimeInfo) models.AnimeInfo {
 	var existingAnime models.AnimeInfo
 	result := DB.Where("folder_name = ?", anime.FolderName).First(&existingAnime)
 
 	if result.Error == nil {
 		log.Printf("更新动画信息: %s\n", anime.FolderName)
-		existingAnime.Title = anime.Title
-		existingAnime.Summary = anime.Summary
-		existingAnime.Cover = anime.Cover
+		mergeScannedMetadata(&existingAnime, anime)
 		existingAnime.VideoURL = anime.VideoURL
 		existingAnime.Episodes = anime.Episodes
 		existingAnime.PhysicalPath = anime.PhysicalPath
 		existingAnime.StorageDisk = anime.StorageDisk
+		existingAnime.MissingSince = nil
 		existingAnime.UpdatedAt = time.Now()
 
-		result = DB.Save(&existingAnime)
+		result = DB.Omit("Tags").Save(&existingAnime)
 		if result.Error != nil {
 			log.Printf("错误: 更新动画信息失败: %v\n", result.Error)
 		} else {
 			log.Printf("成功更新动画信息: %s\n", anime.FolderName)
+			MetadataServiceInstance.ImportTags(&existingAnime, anime.Tags)
 		}
+		return existingAnime
 	} else if result.Error == gorm.ErrRecordNotFound {
 		log.Printf("创建新动画: %s\n", anime.FolderName)
 		anime.CreatedAt = time.Now()
 		anime.UpdatedAt = time.Now()
 
-		result = DB.Create(&anime)
+		tags := anime.Tags
+		result = DB.Omit("Tags").Create(&anime)
 		if result.Error != nil {
 			log.Printf("错误: 创建动画信息失败: %v\n", result.Error)
 		} else {
 			log.Printf("成功创建动画信息: %s\n", anime.FolderName)
+			MetadataServiceInstance.ImportTags(&anime, tags)
 		}
 	} else {
 		log.Printf("错误: 查询动画信息失败: %v\n", result.Error)
 	}
+	return anime
 }
 
 func (s *VideoService) GetAnimesFromDB() []models.AnimeInfo {
 	var animes []models.AnimeInfo
-	result := DB.Find(&animes)
+	result := DB.Preload("Tags").Where("missing_since IS NULL").Find(&animes)
 	if result.Error != nil {
 		log.Printf("错误: 从数据库获取动画信息失败: %v\n", result.Error)
 		return s.ScanVideos()
 	}
 
+	episodeCounts := EpisodeServiceInstance.CountByAnime()
 	for i := range animes {
-		currentCoverPath := strings.TrimPrefix(animes[i].Cover, "/")
-		if _, err := os.Stat(currentCoverPath); os.IsNotExist(err) {
+		if count, ok := episodeCounts[animes[i].ID]; ok {
+			animes[i].Episodes = count
+		}
+
+		if !s.coverExists(animes[i].Cover) {
 			coverURL := "/static/css/default-cover.jpg"
 			coverFormats := []string{"cover.jpg", "cover.png", "cover.jpeg", "cover.webp"}
 
@@ -273,27 +365,26 @@ func (s *VideoService) GetAnimesFromDB() []models.AnimeInfo {
 	return animes
 }
 
-func (s *VideoService) SearchAnimes(keyword string) []models.AnimeInfo {
-	var animes []models.AnimeInfo
-
-	if !LocalMode {
-		result := DB.Where("title LIKE ? OR folder_name LIKE ?", "%"+keyword+"%", "%"+keyword+"%").Find(&animes)
-		if result.Error != nil {
-			log.Printf("错误: 搜索动画失败: %v\n", result.Error)
-			animes = s.ScanVideos()
-		} else {
-			return animes
-		}
+// coverExists 判断封面地址对应的文件是否存在，元数据文件中的网络地址视为存在
+func (s *VideoService) coverExists(cover string) bool {
+	if strings.HasPrefix(cover, "http://") || strings.HasPrefix(cover, "https://") {
+		return true
 	}
 
-	allAnimes := s.ScanVideos()
-	for _, anime := range allAnimes {
-		if strings.Contains(strings.ToLower(anime.Title), strings.ToLower(keyword)) ||
-			strings.Contains(strings.ToLower(anime.FolderName), strings.ToLower(keyword)) {
-			animes = append(animes, anime)
-		}
+	coverPath := s.getVideoFilePath(cover)
+	if normalized := utils.NormalizeURLPath(cover); strings.HasPrefix(normalized, "/hls/") {
+		coverPath = filepath.Join(hlsDir, filepath.FromSlash(strings.TrimPrefix(normalized, "/hls/")))
 	}
+	_, err := os.Stat(coverPath)
+	return err == nil
+}
 
+// SearchAnimes 按相关度返回匹配关键词的动画
+func (s *VideoService) SearchAnimes(keyword string) []models.AnimeInfo {
+	var animes []models.AnimeInfo
+	for _, result := range SearchServiceInstance.Search(keyword, 0) {
+		animes = append(animes, result.Anime)
+	}
 	return animes
 }
 
@@ -339,9 +430,8 @@ func (s *VideoService) GetAnimeInfo(folderName string) (models.AnimeInfo, bool)
 				log.Printf("找到 %d 个条目\n", len(hlsEntries))
 				for _, entry := range hlsEntries {
 					if entry.IsDir() {
-						playlistPath := filepath.Join(hlsFolder, entry.Name(), "playlist.m3u8")
-						if _, err := os.Stat(playlistPath); err == nil {
-							hlsURL := utils.NormalizeURLPath(strings.Join([]string{"/hls", folderName, entry.Name(), "playlist.m3u8"}, "/"))
+						if playlistName, found := findEpisodePlaylist(filepath.Join(hlsFolder, entry.Name())); found {
+							hlsURL := utils.NormalizeURLPath(strings.Join([]string{"/hls", folderName, entry.Name(), playlistName}, "/"))
 							videos = append(videos, models.VideoFile{
 								Path:     hlsURL,
 								FileName: entry.Name(),
@@ -371,9 +461,8 @@ func (s *VideoService) GetAnimeInfo(folderName string) (models.AnimeInfo, bool)
 				if err == nil {
 					for _, entry := range hlsEntries {
 						if entry.IsDir() {
-							playlistPath := filepath.Join(diskHlsPath, entry.Name(), "playlist.m3u8")
-							if _, err := os.Stat(playlistPath); err == nil {
-								hlsURL := "/storage/" + disk.Name + "/" + folderName + "/" + entry.Name() + "/playlist.m3u8"
+							if playlistName, found := findEpisodePlaylist(filepath.Join(diskHlsPath, entry.Name())); found {
+								hlsURL := "/storage/" + disk.Name + "/" + folderName + "/" + entry.Name() + "/" + playlistName
 								videos = append(videos, models.VideoFile{
 									Path:     hlsURL,
 									FileName: entry.Name(),
@@ -390,7 +479,7 @@ func (s *VideoService) GetAnimeInfo(folderName string) (models.AnimeInfo, bool)
 
 	if hasVideoFiles && len(videos) > 0 {
 		sort.Slice(videos, func(i, j int) bool {
-			return videos[i].FileName < videos[j].FileName
+			return utils.EpisodeLess(videos[i].FileName, videos[j].FileName)
 		})
 
 		mainVideo := videos[0]
@@ -463,9 +552,9 @@ func (s *VideoService) GetAnimeVideos(folderName string) []models.VideoFile {
 			if err == nil {
 				for _, entry := range hlsEntries {
 					if entry.IsDir() {
-						playlistPath := filepath.Join(hlsAnimePath, entry.Name(), "playlist.m3u8")
-						if _, err := os.Stat(playlistPath); err == nil {
-							hlsURL := utils.NormalizeURLPath(strings.Join([]string{"/hls", folderName, entry.Name(), "playlist.m3u8"}, "/"))
+						if playlistName, found := findEpisodePlaylist(filepath.Join(hlsAnimePath, entry.Name())); found {
+							playlistPath := filepath.Join(hlsAnimePath, entry.Name(), playlistName)
+							hlsURL := utils.NormalizeURLPath(strings.Join([]string{"/hls", folderName, entry.Name(), playlistName}, "/"))
 							hlsFileName := entry.Name()
 
 							if !addedVideos[hlsURL] {
@@ -492,9 +581,9 @@ func (s *VideoService) GetAnimeVideos(folderName string) []models.VideoFile {
 				if err == nil {
 					for _, entry := range hlsEntries {
 						if entry.IsDir() {
-							playlistPath := filepath.Join(diskHlsPath, entry.Name(), "playlist.m3u8")
-							if _, err := os.Stat(playlistPath); err == nil {
-								hlsURL := "/storage/" + disk.Name + "/" + folderName + "/" + entry.Name() + "/playlist.m3u8"
+							if playlistName, found := findEpisodePlaylist(filepath.Join(diskHlsPath, entry.Name())); found {
+								playlistPath := filepath.Join(diskHlsPath, entry.Name(), playlistName)
+								hlsURL := "/storage/" + disk.Name + "/" + folderName + "/" + entry.Name() + "/" + playlistName
 								hlsFileName := entry.Name()
 
 								if !addedVideos[hlsURL] {
@@ -514,32 +603,52 @@ func (s *VideoService) GetAnimeVideos(folderName string) []models.VideoFile {
 	}
 
 	sort.Slice(videos, func(i, j int) bool {
-		return videos[i].FileName < videos[j].FileName
+		return utils.EpisodeLess(videos[i].FileName, videos[j].FileName)
 	})
 
 	return videos
 }
 
-func (s *VideoService) getHLSDir(videoPath string) string {
+// GetAnimeEpisodes 从剧集表读取动画的剧集，还没有记录时扫描目录并写入
+func (s *VideoService) GetAnimeEpisodes(anime models.AnimeInfo) []models.Episode {
+	episodes := EpisodeServiceInstance.ListByAnime(anime)
+	if len(episodes) > 0 {
+		return episodes
+	}
+
+	videos := s.GetAnimeVideos(anime.FolderName)
+	if len(videos) == 0 {
+		return episodes
+	}
+	return EpisodeServiceInstance.SyncEpisodes(anime, videos)
+}
+
+// splitVideoPath 从 /static/videos/<动画>/<剧集文件> 中拆出动画目录名和剧集目录名
+func (s *VideoService) splitVideoPath(videoPath string) (string, string) {
 	normalizedPath := utils.NormalizeURLPath(videoPath)
 	relativePath := strings.TrimPrefix(normalizedPath, "/static/videos/")
 	pathParts := strings.Split(relativePath, "/")
-	if len(pathParts) < 1 {
-		return filepath.Join(hlsDir, filepath.Base(relativePath))
+	fileName := pathParts[len(pathParts)-1]
+	episodeName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if len(pathParts) < 2 {
+		return episodeName, episodeName
 	}
-	animeName := pathParts[0]
-	return StorageServiceInstance.GetHLSPath(animeName)
+	return pathParts[0], episodeName
+}
+
+func (s *VideoService) getHLSDir(videoPath string) string {
+	animeName, episodeName := s.splitVideoPath(videoPath)
+	return filepath.Join(StorageServiceInstance.GetHLSPath(animeName), episodeName)
 }
 
 func (s *VideoService) getHLSURL(videoPath string) string {
-	normalizedPath := utils.NormalizeURLPath(videoPath)
-	relativePath := strings.TrimPrefix(normalizedPath, "/static/videos/")
-	pathParts := strings.Split(relativePath, "/")
-	if len(pathParts) < 1 {
-		return utils.NormalizeURLPath(strings.Join([]string{"/hls", filepath.Base(relativePath), "playlist.m3u8"}, "/"))
+	animeName, episodeName := s.splitVideoPath(videoPath)
+	hlsDirPath := filepath.Join(StorageServiceInstance.GetHLSPath(animeName), episodeName)
+	playlistName, found := findEpisodePlaylist(hlsDirPath)
+	if !found {
+		playlistName = variantPlaylistName
 	}
-	animeName := pathParts[0]
-	return StorageServiceInstance.GetHLSURL(animeName) + "/playlist.m3u8"
+	return StorageServiceInstance.GetHLSURL(animeName) + "/" + episodeName + "/" + playlistName
 }
 
 func (s *VideoService) getVideoFilePath(videoPath string) string {
@@ -568,113 +677,33 @@ func (s *VideoService) GenerateHLSFromPhysicalPath(videoURL string, physicalPath
 	}
 
 	animeName := filepath.Base(physicalPath)
+	_, episodeName := s.splitVideoPath(videoURL)
+
+	playlistName, found := findEpisodePlaylist(filepath.Join(physicalPath, episodeName))
+	if !found {
+		playlistName = variantPlaylistName
+	}
 
 	if storageDisk != "" {
 		disk := StorageServiceInstance.GetDiskByName(storageDisk)
 		if disk != nil {
-			return "/storage/" + disk.Name + "/" + animeName + "/playlist.m3u8"
+			return "/storage/" + disk.Name + "/" + animeName + "/" + episodeName + "/" + playlistName
 		}
 	}
 
-	return "/hls/" + animeName + "/playlist.m3u8"
+	return "/hls/" + animeName + "/" + episodeName + "/" + playlistName
 }
 
+// GenerateHLS 使用默认转码配置生成HLS切片
 func (s *VideoService) GenerateHLS(videoPath string) error {
-	hlsDirPath := s.getHLSDir(videoPath)
-
-	err := os.MkdirAll(hlsDirPath, 0755)
-	if err != nil {
-		return fmt.Errorf("创建HLS目录失败: %v", err)
-	}
-
-	playlistPath := filepath.Join(hlsDirPath, "playlist.m3u8")
-	segmentPath := filepath.Join(hlsDirPath, "segment_%03d.ts")
-
-	videoFilePath := s.getVideoFilePath(videoPath)
-
-	cmd := exec.Command(
-		"ffmpeg",
-		"-err_detect", "ignore_err",
-		"-i", videoFilePath,
-		"-c:v", "copy",
-		"-c:a", "copy",
-		"-hls_time", "8",
-		"-hls_list_size", "0",
-		"-hls_segment_filename", segmentPath,
-		"-hls_flags", "discont_start+temp_file+independent_segments",
-		"-avoid_negative_ts", "make_zero",
-		"-fflags", "+genpts+igndts",
-		"-reset_timestamps", "1",
-		"-loglevel", "error",
-		playlistPath,
-	)
-
-	output, err := cmd.CombinedOutput()
+	profile, err := ResolveProfile("")
 	if err != nil {
-		return fmt.Errorf("执行FFmpeg命令失败: %v, 输出: %s", err, string(output))
+		return err
 	}
-
-	if strings.HasSuffix(strings.ToLower(videoFilePath), ".mp4") {
-		err = os.Remove(videoFilePath)
-		if err != nil {
-			log.Printf("警告: 删除原始文件失败: %v\n", err)
-		} else {
-			log.Printf("成功删除原始文件: %s\n", videoFilePath)
-		}
-	}
-
-	return nil
+	return s.GenerateHLSWithProfile(videoPath, profile, nil, nil)
 }
 
-func (s *VideoService) GenerateHLSHighQuality(videoPath string) error {
-	hlsDirPath := s.getHLSDir(videoPath)
-
-	err := os.MkdirAll(hlsDirPath, 0755)
-	if err != nil {
-		return fmt.Errorf("创建HLS目录失败: %v", err)
-	}
-
-	playlistPath := filepath.Join(hlsDirPath, "playlist.m3u8")
-	segmentPath := filepath.Join(hlsDirPath, "segment_%03d.ts")
-
-	videoFilePath := s.getVideoFilePath(videoPath)
-
-	cmd := exec.Command(
-		"ffmpeg",
-		"-err_detect", "ignore_err",
-		"-i", videoFilePath,
-		"-c:v", "copy",
-		"-c:a", "copy",
-		"-hls_time", "8",
-		"-hls_list_size", "0",
-		"-hls_segment_filename", segmentPath,
-		"-hls_flags", "discont_start+temp_file+independent_segments",
-		"-avoid_negative_ts", "make_zero",
-		"-fflags", "+genpts+igndts",
-		"-reset_timestamps", "1",
-		"-loglevel", "error",
-		playlistPath,
-	)
-
-	_, err = cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("警告: GPU加速失败，尝试使用CPU: %v\n", err)
-		return s.GenerateHLS(videoPath)
-	}
-
-	if strings.HasSuffix(strings.ToLower(videoFilePath), ".mp4") {
-		err = os.Remove(videoFilePath)
-		if err != nil {
-			log.Printf("警告: 删除原始文件失败: %v\n", err)
-		} else {
-			log.Printf("成功删除原始文件: %s\n", videoFilePath)
-		}
-	}
-
-	return nil
-}
-
-func (s *VideoService) BatchGenerateHLS(videos []string, useGPU bool, progressChan chan<- map[string]interface{}, stopChan <-chan struct{}) (int, int, int, int, []string) {
+func (s *VideoService) BatchGenerateHLS(videos []string, profile config.TranscodeProfile, progressChan chan<- map[string]interface{}, stopChan <-chan struct{}) (int, int, int, int, []string) {
 	total := len(videos)
 	success := 0
 	failed := 0
@@ -683,6 +712,7 @@ func (s *VideoService) BatchGenerateHLS(videos []string, useGPU bool, progressCh
 
 	semaphore := make(chan struct{}, maxWorkers)
 	var wg sync.WaitGroup
+	var resultMu sync.Mutex
 
 	for i, videoPath := range videos {
 		select {
@@ -702,10 +732,7 @@ func (s *VideoService) BatchGenerateHLS(videos []string, useGPU bool, progressCh
 
 		normalizedPath := utils.NormalizeURLPath(videoPath)
 
-		hlsPath := s.getHLSURL(normalizedPath)
-		hlsFilePath := strings.TrimPrefix(hlsPath, "/")
-
-		if _, err := os.Stat(hlsFilePath); err == nil {
+		if _, exists := findEpisodePlaylist(s.getHLSDir(normalizedPath)); exists {
 			skipped++
 			select {
 			case progressChan <- map[string]interface{}{
@@ -740,17 +767,24 @@ func (s *VideoService) BatchGenerateHLS(videos []string, useGPU bool, progressCh
 			default:
 			}
 
-			var err error
-			if useGPU {
-				err = s.GenerateHLSHighQuality(path)
-			} else {
-				err = s.GenerateHLS(path)
+			onProgress := func(progress FFmpegProgress) {
+				event := progress.Event()
+				event["video"] = path
+				event["timestamp"] = time.Now().Format(time.RFC3339)
+				select {
+				case progressChan <- event:
+				default:
+				}
 			}
 
+			err := s.GenerateHLSWithProfile(path, profile, onProgress, stopChan)
+
 			if err != nil {
-				failed++
 				errorMsg := fmt.Sprintf("视频 %s 生成失败: %v", path, err)
+				resultMu.Lock()
+				failed++
 				errors = append(errors, errorMsg)
+				resultMu.Unlock()
 				log.Printf("错误: %s\n", errorMsg)
 
 				select {
@@ -763,7 +797,9 @@ func (s *VideoService) BatchGenerateHLS(videos []string, useGPU bool, progressCh
 				default:
 				}
 			} else {
+				resultMu.Lock()
 				success++
+				resultMu.Unlock()
 				log.Printf("成功: 视频 %s 生成HLS切片完成\n", path)
 
 				s.moveCoverToHLS(path)
@@ -846,38 +882,9 @@ func (s *VideoService) moveCoverToHLS(videoPath string) {
 	}
 }
 
-func (s *VideoService) DeleteAnime(folderName string) error {
-	originalDir := filepath.Join(videosDir, folderName)
-	if err := os.RemoveAll(originalDir); err != nil {
-		log.Printf("警告: 删除原始视频目录失败: %v\n", err)
-	} else {
-		log.Printf("成功删除原始视频目录: %s\n", originalDir)
-	}
-
-	hlsDirPath := filepath.Join(hlsDir, folderName)
-	if err := os.RemoveAll(hlsDirPath); err != nil {
-		log.Printf("警告: 删除HLS目录失败: %v\n", err)
-	} else {
-		log.Printf("成功删除HLS目录: %s\n", hlsDirPath)
-	}
-
-	if !LocalMode && DB != nil {
-		result := DB.Where("folder_name = ?", folderName).Delete(&models.AnimeInfo{})
-		if result.Error != nil {
-			log.Printf("错误: 从数据库删除动画信息失败: %v\n", result.Error)
-		} else {
-			log.Printf("成功从数据库删除动画信息: %s\n", folderName)
-		}
-
-		result = DB.Where("video_url LIKE ?", "%"+folderName+"%").Delete(&models.PlayHistory{})
-		if result.Error != nil {
-			log.Printf("错误: 从数据库删除播放记录失败: %v\n", result.Error)
-		} else {
-			log.Printf("成功从数据库删除相关播放记录: %s\n", folderName)
-		}
-	}
-
-	return nil
+// DeleteAnime 把动画移到回收站，可以恢复，彻底删除需要清空回收站
+func (s *VideoService) DeleteAnime(folderName string, userID uint) (*TrashBatch, error) {
+	return TrashServiceInstance.MoveToTrash(folderName, userID)
 }
 
 func (s *VideoService) ExtractAnimeDirectory(videoPath string) string {
@@ -901,99 +908,6 @@ func (s *VideoService) GetHLSURL(videoPath string) string {
 	return s.getHLSURL(videoPath)
 }
 
-func (s *VideoService) UpdateAnimeInfo(anime models.AnimeInfo) {
-	s.updateAnimeInfo(anime)
-}
-
-func (s *VideoService) ScanAnimeDirectories(directories []string) []models.AnimeInfo {
-	var animes []models.AnimeInfo
-	var mutex sync.Mutex
-	var wg sync.WaitGroup
-
-	dirMap := make(map[string]bool)
-	uniqueDirs := []string{}
-	for _, dir := range directories {
-		if dir != "" && !dirMap[dir] {
-			dirMap[dir] = true
-			uniqueDirs = append(uniqueDirs, dir)
-		}
-	}
-
-	log.Printf("开始增量扫描 %d 个动画目录...", len(uniqueDirs))
-
-	for _, dirName := range uniqueDirs {
-		hlsAnimePath := filepath.Join(hlsDir, dirName)
-
-		if _, err := os.Stat(hlsAnimePath); os.IsNotExist(err) {
-			log.Printf("警告: 目录 %s 不存在，跳过扫描", hlsAnimePath)
-			continue
-		}
-
-		wg.Add(1)
-		go func(name string, hlsFolder string) {
-			defer wg.Done()
-
-			var videos []models.VideoFile
-			hlsEntries, err := ioutil.ReadDir(hlsFolder)
-			if err == nil {
-				for _, hlsEntry := range hlsEntries {
-					if hlsEntry.IsDir() {
-						playlistPath := filepath.Join(hlsFolder, hlsEntry.Name(), "playlist.m3u8")
-						if _, err := os.Stat(playlistPath); err == nil {
-							hlsURL := utils.NormalizeURLPath(strings.Join([]string{"/hls", name, hlsEntry.Name(), "playlist.m3u8"}, "/"))
-							videos = append(videos, models.VideoFile{
-								Path:     hlsURL,
-								FileName: hlsEntry.Name(),
-							})
-						}
-					}
-				}
-			}
-
-			if len(videos) > 0 {
-				sort.Slice(videos, func(i, j int) bool {
-					return videos[i].FileName < videos[j].FileName
-				})
-
-				mainVideo := videos[0]
-				coverURL := "/static/css/default-cover.jpg"
-				coverFormats := []string{"cover.jpg", "cover.png", "cover.jpeg", "cover.webp"}
-
-				for _, format := range coverFormats {
-					hlsCoverPath := filepath.Join(hlsDir, name, format)
-					if _, err := os.Stat(hlsCoverPath); err == nil {
-						coverURL = utils.NormalizeURLPath(strings.Join([]string{"/hls", name, format}, "/"))
-						break
-					}
-				}
-
-				anime := models.AnimeInfo{
-					Title:      name,
-					Summary:    fmt.Sprintf("这是一部名为 %s 的动画", name),
-					Cover:      coverURL,
-					VideoURL:   mainVideo.Path,
-					Episodes:   len(videos),
-					FolderName: name,
-				}
-
-				mutex.Lock()
-				animes = append(animes, anime)
-				mutex.Unlock()
-
-				if !LocalMode {
-					s.updateAnimeInfo(anime)
-				}
-			}
-		}(dirName, hlsAnimePath)
-	}
-
-	wg.Wait()
-
-	sort.Slice(animes, func(i, j int) bool {
-		return animes[i].Title < animes[j].Title
-	})
-
-	log.Printf("增量扫描完成，更新了 %d 个动画信息", len(animes))
-
-	return animes
+func (s *VideoService) UpdateAnimeInfo(anime models.AnimeInfo) models.AnimeInfo {
+	return s.updateAnimeInfo(anime)
 }
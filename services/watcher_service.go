@@ -0,0 +1,473 @@
+package services
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anime-website/config"
+	"anime-website/utils"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	CatalogEventAnimeUpdated  = "anime_updated"
+	CatalogEventAnimeRemoved  = "anime_removed"
+	CatalogEventSourceChanged = "source_changed"
+)
+
+const catalogSubscriberSize = 64
+
+// CatalogEvent 是目录监听发布的变更事件
+type CatalogEvent struct {
+	Type        string    `json:"type"`
+	AnimeFolder string    `json:"animeFolder"`
+	Episodes    int       `json:"episodes"`
+	Time        time.Time `json:"time"`
+}
+
+// watchRoot 是一个被监听的根目录。Source 表示源视频目录，否则是HLS目录
+type watchRoot struct {
+	Path   string
+	Source bool
+	Poll   bool
+}
+
+// 每个根目录监听的层级：HLS目录监听到剧集目录，源视频目录监听到动画目录
+const (
+	hlsWatchDepth    = 2
+	sourceWatchDepth = 1
+)
+
+type WatcherService struct {
+	mu            sync.Mutex
+	roots         []watchRoot
+	watcher       *fsnotify.Watcher
+	debounce      time.Duration
+	timer         *time.Timer
+	pendingHLS    map[string]bool
+	pendingSource map[string]bool
+	snapshots     map[string]map[string]string
+	subscribers   map[chan CatalogEvent]struct{}
+}
+
+var WatcherServiceInstance = &WatcherService{
+	pendingHLS:    make(map[string]bool),
+	pendingSource: make(map[string]bool),
+	snapshots:     make(map[string]map[string]string),
+	subscribers:   make(map[chan CatalogEvent]struct{}),
+}
+
+// Start 按配置监听源视频目录和所有HLS目录
+func (s *WatcherService) Start() {
+	cfg := config.Get().Watcher
+	if cfg.Mode == config.WatcherModeOff {
+		log.Println("目录监听已关闭")
+		return
+	}
+	s.debounce = time.Duration(cfg.DebounceMillis) * time.Millisecond
+
+	pollPaths := make(map[string]bool)
+	for _, path := range cfg.PollPaths {
+		pollPaths[filepath.Clean(path)] = true
+	}
+
+	roots := []watchRoot{{Path: videosDir, Source: true}}
+	for _, path := range VideoServiceInstance.hlsRoots() {
+		roots = append(roots, watchRoot{Path: path})
+	}
+
+	if cfg.Mode != config.WatcherModePoll {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("警告: 创建文件监听失败，改为轮询: %v\n", err)
+		} else {
+			s.watcher = watcher
+			go s.notifyLoop()
+		}
+	}
+
+	for i := range roots {
+		root := &roots[i]
+		if _, err := os.Stat(root.Path); err != nil {
+			log.Printf("警告: 监听目录 %s 不可用: %v\n", root.Path, err)
+		}
+		root.Poll = s.watcher == nil || pollPaths[filepath.Clean(root.Path)]
+		if !root.Poll {
+			if err := s.addWatch(root.Path, root.depth()); err != nil {
+				if cfg.Mode == config.WatcherModeNotify {
+					log.Printf("警告: 监听目录 %s 失败: %v\n", root.Path, err)
+					continue
+				}
+				log.Printf("警告: 监听目录 %s 失败，改为轮询: %v\n", root.Path, err)
+				root.Poll = true
+			}
+		}
+		if root.Poll {
+			s.snapshots[root.Path] = snapshotRoot(*root)
+		}
+		log.Printf("目录监听: %s (轮询: %v)\n", root.Path, root.Poll)
+	}
+
+	s.mu.Lock()
+	s.roots = roots
+	s.mu.Unlock()
+
+	go s.pollLoop(time.Duration(cfg.PollIntervalSeconds) * time.Second)
+}
+
+// AddHLSRoot 监听运行时添加或启用的磁盘。轮询的目录没有快照，第一次轮询时会同步其中所有动画
+func (s *WatcherService) AddHLSRoot(path string) {
+	cfg := config.Get().Watcher
+	if cfg.Mode == config.WatcherModeOff {
+		return
+	}
+
+	s.mu.Lock()
+	for _, root := range s.roots {
+		if filepath.Clean(root.Path) == filepath.Clean(path) {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	root := watchRoot{Path: path, Poll: s.watcher == nil}
+	for _, pollPath := range cfg.PollPaths {
+		if filepath.Clean(pollPath) == filepath.Clean(path) {
+			root.Poll = true
+		}
+	}
+	if !root.Poll {
+		if err := s.addWatch(root.Path, root.depth()); err != nil {
+			if cfg.Mode == config.WatcherModeNotify {
+				log.Printf("警告: 监听目录 %s 失败: %v\n", root.Path, err)
+				return
+			}
+			log.Printf("警告: 监听目录 %s 失败，改为轮询: %v\n", root.Path, err)
+			root.Poll = true
+		}
+	}
+
+	s.mu.Lock()
+	s.roots = append(s.roots, root)
+	s.mu.Unlock()
+	log.Printf("目录监听: %s (轮询: %v)\n", root.Path, root.Poll)
+}
+
+// Subscribe 订阅目录变更事件，调用返回的函数取消订阅
+func (s *WatcherService) Subscribe() (<-chan CatalogEvent, func()) {
+	ch := make(chan CatalogEvent, catalogSubscriberSize)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, subscribed := s.subscribers[ch]; subscribed {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+func (s *WatcherService) publish(event CatalogEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (r watchRoot) depth() int {
+	if r.Source {
+		return sourceWatchDepth
+	}
+	return hlsWatchDepth
+}
+
+// addWatch 监听目录及 depth 层以内的子目录，fsnotify 本身不会递归
+func (s *WatcherService) addWatch(path string, depth int) error {
+	if err := s.watcher.Add(path); err != nil {
+		return err
+	}
+	if depth == 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			if err := s.addWatch(filepath.Join(path, entry.Name()), depth-1); err != nil {
+				log.Printf("警告: 监听目录 %s 失败: %v\n", filepath.Join(path, entry.Name()), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *WatcherService) notifyLoop() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.handleNotify(event)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("警告: 文件监听出错: %v\n", err)
+		}
+	}
+}
+
+func (s *WatcherService) handleNotify(event fsnotify.Event) {
+	root, parts, found := s.locate(event.Name)
+	if !found || len(parts) == 0 {
+		return
+	}
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			// 修复、迁移等操作使用的临时目录，完成后会重命名为正式目录
+			return
+		}
+	}
+
+	// 新建的子目录需要单独加入监听
+	if event.Has(fsnotify.Create) && len(parts) <= root.depth() {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := s.addWatch(event.Name, root.depth()-len(parts)); err != nil {
+				log.Printf("警告: 监听目录 %s 失败: %v\n", event.Name, err)
+			}
+		}
+	}
+
+	if !relevantChange(root, parts, event) {
+		return
+	}
+	s.markDirty(root, parts[0])
+}
+
+// relevantChange 过滤掉切片写入等频繁但不影响目录的事件
+func relevantChange(root watchRoot, parts []string, event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return false
+	}
+	name := parts[len(parts)-1]
+	if len(parts) == 1 {
+		return true
+	}
+	if root.Source {
+		return utils.IsVideoFile(name, allowedFormats) || strings.HasPrefix(name, "cover.") || IsSidecarFile(name)
+	}
+	if len(parts) == 2 {
+		// 剧集目录的增删，或动画目录下的封面和元数据文件
+		return !event.Has(fsnotify.Write) || strings.HasPrefix(name, "cover.") || IsSidecarFile(name)
+	}
+	if name == episodeNFO {
+		return true
+	}
+	if !strings.HasSuffix(name, ".m3u8") {
+		return false
+	}
+	// 转码过程中播放列表会不停追加，写完 #EXT-X-ENDLIST 之前不需要同步。删除和改名不受影响
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		return true
+	}
+	return episodeFinished(filepath.Join(root.Path, parts[0], parts[1]))
+}
+
+// episodeFinished 判断剧集目录的播放列表是否都已写完
+func episodeFinished(episodeDir string) bool {
+	playlists, err := episodeMediaPlaylists(episodeDir)
+	if err != nil {
+		return false
+	}
+	for _, playlistPath := range playlists {
+		playlist, err := parseMediaPlaylist(playlistPath)
+		if err != nil || !playlist.HasEndList {
+			return false
+		}
+	}
+	return true
+}
+
+// locate 找到路径所属的根目录，并返回相对根目录的各级名称
+func (s *WatcherService) locate(path string) (watchRoot, []string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, root := range s.roots {
+		rel, err := filepath.Rel(root.Path, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return root, strings.Split(filepath.ToSlash(rel), "/"), true
+	}
+	return watchRoot{}, nil, false
+}
+
+// markDirty 记录发生变化的动画，在最后一次变化 debounce 之后统一处理
+func (s *WatcherService) markDirty(root watchRoot, animeFolder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if root.Source {
+		s.pendingSource[animeFolder] = true
+	} else {
+		s.pendingHLS[animeFolder] = true
+	}
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.debounce, s.flush)
+	} else {
+		s.timer.Reset(s.debounce)
+	}
+}
+
+func (s *WatcherService) flush() {
+	s.mu.Lock()
+	pendingHLS := s.pendingHLS
+	pendingSource := s.pendingSource
+	s.pendingHLS = make(map[string]bool)
+	s.pendingSource = make(map[string]bool)
+	s.mu.Unlock()
+
+	for animeFolder := range pendingSource {
+		log.Printf("目录监听: 源视频目录 %s 有变化\n", animeFolder)
+		s.publish(CatalogEvent{Type: CatalogEventSourceChanged, AnimeFolder: animeFolder, Time: time.Now()})
+		// 源视频目录中的元数据文件也会影响目录
+		if hasSidecarFile(filepath.Join(videosDir, animeFolder)) {
+			pendingHLS[animeFolder] = true
+		}
+	}
+
+	for animeFolder := range pendingHLS {
+		// 正在转码的动画等转码结束后再同步
+		if StorageServiceInstance.IsWriting(animeFolder) {
+			s.markDirty(watchRoot{}, animeFolder)
+			continue
+		}
+		anime, found := VideoServiceInstance.SyncAnime(animeFolder)
+		if found {
+			log.Printf("目录监听: 已更新动画 %s，共 %d 集\n", animeFolder, anime.Episodes)
+			s.publish(CatalogEvent{Type: CatalogEventAnimeUpdated, AnimeFolder: animeFolder, Episodes: anime.Episodes, Time: time.Now()})
+		} else {
+			log.Printf("目录监听: 动画 %s 已不存在\n", animeFolder)
+			s.publish(CatalogEvent{Type: CatalogEventAnimeRemoved, AnimeFolder: animeFolder, Time: time.Now()})
+		}
+	}
+}
+
+// pollLoop 定期对比轮询目录的快照，找出发生变化的动画
+func (s *WatcherService) pollLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		roots := append([]watchRoot(nil), s.roots...)
+		s.mu.Unlock()
+
+		for _, root := range roots {
+			if !root.Poll {
+				continue
+			}
+			current := snapshotRoot(root)
+			previous := s.snapshots[root.Path]
+			for animeFolder, signature := range current {
+				if previous[animeFolder] != signature {
+					s.markDirty(root, animeFolder)
+				}
+			}
+			for animeFolder := range previous {
+				if _, exists := current[animeFolder]; !exists {
+					s.markDirty(root, animeFolder)
+				}
+			}
+			s.snapshots[root.Path] = current
+		}
+	}
+}
+
+// snapshotRoot 为根目录下每个动画生成签名，只包含会影响目录的文件
+func snapshotRoot(root watchRoot) map[string]string {
+	snapshot := make(map[string]string)
+
+	entries, err := ioutil.ReadDir(root.Path)
+	if err != nil {
+		return snapshot
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		snapshot[entry.Name()] = animeSignature(filepath.Join(root.Path, entry.Name()), root.Source)
+	}
+	return snapshot
+}
+
+func animeSignature(animeDir string, source bool) string {
+	entries, err := ioutil.ReadDir(animeDir)
+	if err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, "."):
+			continue
+		case !entry.IsDir() && IsSidecarFile(name):
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", name, entry.Size(), entry.ModTime().Unix()))
+		case source && !entry.IsDir() && (utils.IsVideoFile(name, allowedFormats) || strings.HasPrefix(name, "cover.")):
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", name, entry.Size(), entry.ModTime().Unix()))
+		case !source && entry.IsDir():
+			playlistName, found := findEpisodePlaylist(filepath.Join(animeDir, name))
+			if !found {
+				continue
+			}
+			var modTime int64
+			if info, err := os.Stat(filepath.Join(animeDir, name, playlistName)); err == nil {
+				modTime = info.ModTime().Unix()
+			}
+			parts = append(parts, fmt.Sprintf("%s/%s:%d", name, playlistName, modTime))
+		case !source && strings.HasPrefix(name, "cover."):
+			parts = append(parts, fmt.Sprintf("%s:%d", name, entry.ModTime().Unix()))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+func hasSidecarFile(dir string) bool {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && IsSidecarFile(entry.Name()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+package utils
+
+// DiskSpace 是文件所在分区的容量，单位为字节。Free 是当前用户可用的空间
+type DiskSpace struct {
+	Total uint64
+	Free  uint64
+	Used  uint64
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package utils
+
+import "errors"
+
+// GetDiskSpace 在不支持的系统上总是返回错误
+func GetDiskSpace(path string) (DiskSpace, error) {
+	return DiskSpace{}, errors.New("当前系统不支持读取磁盘容量")
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import "syscall"
+
+// GetDiskSpace 用 statfs 读取 path 所在分区的容量
+func GetDiskSpace(path string) (DiskSpace, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return DiskSpace{}, err
+	}
+
+	blockSize := uint64(stat.Bsize)
+	return DiskSpace{
+		Total: uint64(stat.Blocks) * blockSize,
+		Free:  uint64(stat.Bavail) * blockSize,
+		Used:  (uint64(stat.Blocks) - uint64(stat.Bfree)) * blockSize,
+	}, nil
+}
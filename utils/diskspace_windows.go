@@ -0,0 +1,35 @@
+//go:build windows
+
+package utils
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// GetDiskSpace 用 GetDiskFreeSpaceEx 读取 path 所在分区的容量
+func GetDiskSpace(path string) (DiskSpace, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskSpace{}, err
+	}
+
+	var freeAvailable, total, totalFree uint64
+	ret, _, callErr := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&freeAvailable)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&totalFree)),
+	)
+	if ret == 0 {
+		return DiskSpace{}, callErr
+	}
+
+	return DiskSpace{
+		Total: total,
+		Free:  freeAvailable,
+		Used:  total - totalFree,
+	}, nil
+}
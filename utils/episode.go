@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	EpisodeKindRegular = "episode"
+	EpisodeKindSpecial = "special"
+	EpisodeKindOVA     = "ova"
+	EpisodeKindPV      = "pv"
+)
+
+// 排序时正片在前，其后依次是特别篇、OVA、PV
+var episodeKindRanks = map[string]int{
+	EpisodeKindRegular: 0,
+	EpisodeKindSpecial: 1,
+	EpisodeKindOVA:     2,
+	EpisodeKindPV:      3,
+}
+
+// EpisodeName 是从文件名中解析出的季数、集数和类型，Parsed 为 false 表示没有识别出集数
+type EpisodeName struct {
+	Season int
+	Number int
+	Kind   string
+	Parsed bool
+}
+
+var (
+	seasonEpisodePattern  = regexp.MustCompile(`(?i)(?:^|[^a-z])S(\d{1,2})\s*E(\d{1,4})(?:[^0-9]|$)`)
+	chineseEpisodePattern = regexp.MustCompile(`第\s*([0-9零〇一二两三四五六七八九十百]+)\s*[集话話回]`)
+	chineseSeasonPattern  = regexp.MustCompile(`第\s*([0-9零〇一二两三四五六七八九十]+)\s*[季期部]`)
+	seasonPattern         = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:Season\s*|S)(\d{1,2})(?:[^0-9a-z]|$)`)
+	specialNumberPattern  = regexp.MustCompile(`(?i)(?:^|[^a-z])(Specials?|SP|OVA|OAD|PV|CM)\s*[._-]?\s*(\d{1,3})(?:[^0-9]|$)`)
+	episodePattern        = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:Episode|EP?)\.?\s*(\d{1,4})(?:v\d)?(?:[^0-9]|$)`)
+	bracketPattern        = regexp.MustCompile(`[\[【(（]\s*(\d{1,3})(?:v\d)?\s*(?:END|完)?\s*[\]】)）]`)
+	dashPattern           = regexp.MustCompile(`\s-\s*(\d{1,4})(?:v\d)?(?:\s|$|\[|【|\()`)
+	trailingPattern       = regexp.MustCompile(`(?i)[\s_](\d{1,3})(?:v\d)?(?:\.[a-z0-9]{2,4})?\s*$`)
+	numberOnlyPattern     = regexp.MustCompile(`^\s*(\d{1,4})\s*$`)
+	trailingTagsPattern   = regexp.MustCompile(`(?i)(?:\s*[\[【(（][^\[\]【】()（）]*[\]】)）])+(?:\.[a-z0-9]{2,4})?\s*$`)
+
+	ovaPattern     = regexp.MustCompile(`(?i)(?:^|[^a-z])(OVA|OAD)(?:[^a-z]|$)`)
+	specialPattern = regexp.MustCompile(`(?i)(?:^|[^a-z])(SP|Special|Specials)(?:[^a-z]|$)|特别篇|特別篇|番外|特典`)
+	pvPattern      = regexp.MustCompile(`(?i)(?:^|[^a-z])(PV|CM|Trailer|Teaser|Preview)(?:[^a-z]|$)|预告`)
+)
+
+// ParseEpisodeName 从剧集文件名或目录名中解析季数、集数和类型
+func ParseEpisodeName(name string) EpisodeName {
+	name = normalizeDigits(name)
+	result := EpisodeName{Season: 1, Kind: episodeKind(name)}
+
+	if match := seasonEpisodePattern.FindStringSubmatch(name); match != nil {
+		result.Season, _ = strconv.Atoi(match[1])
+		result.Number, _ = strconv.Atoi(match[2])
+		result.Parsed = true
+		return result
+	}
+
+	if match := chineseSeasonPattern.FindStringSubmatch(name); match != nil {
+		if season, ok := parseChineseNumber(match[1]); ok {
+			result.Season = season
+		}
+	} else if match := seasonPattern.FindStringSubmatch(name); match != nil {
+		result.Season, _ = strconv.Atoi(match[1])
+	}
+
+	if result.Kind != EpisodeKindRegular {
+		// 特别篇等不属于任何一季，编号单独计算
+		result.Season = 0
+		if match := specialNumberPattern.FindStringSubmatch(name); match != nil {
+			result.Number, _ = strconv.Atoi(match[2])
+			result.Parsed = true
+			return result
+		}
+	}
+
+	if match := chineseEpisodePattern.FindStringSubmatch(name); match != nil {
+		if number, ok := parseChineseNumber(match[1]); ok {
+			result.Number = number
+			result.Parsed = true
+			return result
+		}
+	}
+
+	if number, ok := matchEpisodeNumber(name, episodePattern, bracketPattern, dashPattern); ok {
+		result.Number = number
+		result.Parsed = true
+		return result
+	}
+
+	// trailingPattern 匹配标题后直接跟集数的情况，如 "SPY×FAMILY 01.mp4"，最多三位，避免把年份当成集数
+	// 先去掉末尾的 [1080p]、(BD) 等标签，"[Group] Title 12 [1080p].mkv" 才能按 "Title 12" 匹配
+	trimmed := trailingTagsPattern.ReplaceAllString(name, "")
+	if number, ok := matchEpisodeNumber(trimmed, trailingPattern, numberOnlyPattern); ok {
+		result.Number = number
+		result.Parsed = true
+	}
+
+	return result
+}
+
+// matchEpisodeNumber 按顺序尝试各个集数模式，返回第一个匹配到的集数
+func matchEpisodeNumber(name string, patterns ...*regexp.Regexp) (int, bool) {
+	for _, pattern := range patterns {
+		if match := pattern.FindStringSubmatch(name); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// EpisodeKindRank 返回剧集类型的排序权重
+func EpisodeKindRank(kind string) int {
+	if rank, ok := episodeKindRanks[kind]; ok {
+		return rank
+	}
+	return len(episodeKindRanks)
+}
+
+// IsValidEpisodeKind 判断剧集类型是否有效
+func IsValidEpisodeKind(kind string) bool {
+	_, ok := episodeKindRanks[kind]
+	return ok
+}
+
+// EpisodeLess 按解析出的类型、季数、集数比较两个剧集名，解析不出集数的排在后面并按自然顺序比较
+func EpisodeLess(a string, b string) bool {
+	pa := ParseEpisodeName(a)
+	pb := ParseEpisodeName(b)
+	return CompareEpisodes(pa, pb, a, b) < 0
+}
+
+// CompareEpisodes 比较两个剧集的顺序，name 用于集数相同时的自然排序
+func CompareEpisodes(a EpisodeName, b EpisodeName, nameA string, nameB string) int {
+	if rankA, rankB := EpisodeKindRank(a.Kind), EpisodeKindRank(b.Kind); rankA != rankB {
+		return rankA - rankB
+	}
+	if a.Parsed != b.Parsed {
+		if a.Parsed {
+			return -1
+		}
+		return 1
+	}
+	if a.Parsed {
+		if a.Season != b.Season {
+			return a.Season - b.Season
+		}
+		if a.Number != b.Number {
+			return a.Number - b.Number
+		}
+	}
+	return NaturalCompare(nameA, nameB)
+}
+
+// NaturalLess 按自然顺序比较字符串，连续数字按数值比较，"第2集" 排在 "第10集" 前面
+func NaturalLess(a string, b string) bool {
+	return NaturalCompare(a, b) < 0
+}
+
+// NaturalCompare 是 NaturalLess 的三路比较版本
+func NaturalCompare(a string, b string) int {
+	ra := []rune(normalizeDigits(a))
+	rb := []rune(normalizeDigits(b))
+	i, j := 0, 0
+
+	for i < len(ra) && j < len(rb) {
+		if isDigit(ra[i]) && isDigit(rb[j]) {
+			startA, startB := i, j
+			for i < len(ra) && isDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && isDigit(rb[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(string(ra[startA:i]), "0")
+			numB := strings.TrimLeft(string(rb[startB:j]), "0")
+			if len(numA) != len(numB) {
+				return len(numA) - len(numB)
+			}
+			if numA != numB {
+				return strings.Compare(numA, numB)
+			}
+			continue
+		}
+
+		ca := unicode.ToLower(ra[i])
+		cb := unicode.ToLower(rb[j])
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+
+	if rest := (len(ra) - i) - (len(rb) - j); rest != 0 {
+		return rest
+	}
+	return strings.Compare(a, b)
+}
+
+func episodeKind(name string) string {
+	switch {
+	case ovaPattern.MatchString(name):
+		return EpisodeKindOVA
+	case pvPattern.MatchString(name):
+		return EpisodeKindPV
+	case specialPattern.MatchString(name):
+		return EpisodeKindSpecial
+	default:
+		return EpisodeKindRegular
+	}
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// normalizeDigits 把全角数字转换为半角
+func normalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '０' && r <= '９' {
+			return r - '０' + '0'
+		}
+		return r
+	}, s)
+}
+
+var chineseDigits = map[rune]int{
+	'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// parseChineseNumber 解析阿拉伯数字或常见的中文数字，如 "十二"、"二十"、"一百零五"
+func parseChineseNumber(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+
+	total := 0
+	current := 0
+	for _, r := range s {
+		switch r {
+		case '十':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+		case '百':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 100
+			current = 0
+		default:
+			digit, ok := chineseDigits[r]
+			if !ok {
+				return 0, false
+			}
+			current = current*10 + digit
+		}
+	}
+	return total + current, true
+}
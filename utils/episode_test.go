@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParseEpisodeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want EpisodeName
+	}{
+		// S01E02
+		{"S01E02", EpisodeName{Season: 1, Number: 2, Kind: EpisodeKindRegular, Parsed: true}},
+		{"[Group] Title S02E11 [1080p].mkv", EpisodeName{Season: 2, Number: 11, Kind: EpisodeKindRegular, Parsed: true}},
+		{"title.s1e5.mp4", EpisodeName{Season: 1, Number: 5, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// 第N集/话
+		{"第2集", EpisodeName{Season: 1, Number: 2, Kind: EpisodeKindRegular, Parsed: true}},
+		{"第10集", EpisodeName{Season: 1, Number: 10, Kind: EpisodeKindRegular, Parsed: true}},
+		{"第十二话", EpisodeName{Season: 1, Number: 12, Kind: EpisodeKindRegular, Parsed: true}},
+		{"第一百零五話", EpisodeName{Season: 1, Number: 105, Kind: EpisodeKindRegular, Parsed: true}},
+		{"第二季 第3集", EpisodeName{Season: 2, Number: 3, Kind: EpisodeKindRegular, Parsed: true}},
+		{"第０７集", EpisodeName{Season: 1, Number: 7, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// [02]
+		{"[02]", EpisodeName{Season: 1, Number: 2, Kind: EpisodeKindRegular, Parsed: true}},
+		{"[Group][Title][12][1080p]", EpisodeName{Season: 1, Number: 12, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title【05v2】", EpisodeName{Season: 1, Number: 5, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title [24 END]", EpisodeName{Season: 1, Number: 24, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// EP2
+		{"EP2", EpisodeName{Season: 1, Number: 2, Kind: EpisodeKindRegular, Parsed: true}},
+		{"EP 1", EpisodeName{Season: 1, Number: 1, Kind: EpisodeKindRegular, Parsed: true}},
+		{"EP01", EpisodeName{Season: 1, Number: 1, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title E07", EpisodeName{Season: 1, Number: 7, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title Episode 5", EpisodeName{Season: 1, Number: 5, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title Season 2 Episode 3", EpisodeName{Season: 2, Number: 3, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// "- 02 -"
+		{"Title - 02 - Subtitle", EpisodeName{Season: 1, Number: 2, Kind: EpisodeKindRegular, Parsed: true}},
+		{"[Group] Title - 03 [1080p]", EpisodeName{Season: 1, Number: 3, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title S2 - 04", EpisodeName{Season: 2, Number: 4, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// 标题后直接跟集数
+		{"SPY×FAMILY 01", EpisodeName{Season: 1, Number: 1, Kind: EpisodeKindRegular, Parsed: true}},
+		{"SPY×FAMILY 01.mp4", EpisodeName{Season: 1, Number: 1, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title_12", EpisodeName{Season: 1, Number: 12, Kind: EpisodeKindRegular, Parsed: true}},
+		{"[Group] Title 12 [1080p].mkv", EpisodeName{Season: 1, Number: 12, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title 01 [1080p]", EpisodeName{Season: 1, Number: 1, Kind: EpisodeKindRegular, Parsed: true}},
+		{"Title 03 (BD 1080p) [HEVC]", EpisodeName{Season: 1, Number: 3, Kind: EpisodeKindRegular, Parsed: true}},
+		{"07", EpisodeName{Season: 1, Number: 7, Kind: EpisodeKindRegular, Parsed: true}},
+
+		// 特别篇、OVA、PV
+		{"Title SP 2", EpisodeName{Season: 0, Number: 2, Kind: EpisodeKindSpecial, Parsed: true}},
+		{"Title SP02", EpisodeName{Season: 0, Number: 2, Kind: EpisodeKindSpecial, Parsed: true}},
+		{"Title Special 2", EpisodeName{Season: 0, Number: 2, Kind: EpisodeKindSpecial, Parsed: true}},
+		{"Title Specials 03", EpisodeName{Season: 0, Number: 3, Kind: EpisodeKindSpecial, Parsed: true}},
+		{"Title 特别篇 [01]", EpisodeName{Season: 0, Number: 1, Kind: EpisodeKindSpecial, Parsed: true}},
+		{"Title OVA 1", EpisodeName{Season: 0, Number: 1, Kind: EpisodeKindOVA, Parsed: true}},
+		{"Title OAD2", EpisodeName{Season: 0, Number: 2, Kind: EpisodeKindOVA, Parsed: true}},
+		{"Title OVA Episode 4", EpisodeName{Season: 0, Number: 4, Kind: EpisodeKindOVA, Parsed: true}},
+		{"Title PV1", EpisodeName{Season: 0, Number: 1, Kind: EpisodeKindPV, Parsed: true}},
+		{"Title CM 03", EpisodeName{Season: 0, Number: 3, Kind: EpisodeKindPV, Parsed: true}},
+		{"Title Trailer", EpisodeName{Season: 0, Number: 0, Kind: EpisodeKindPV, Parsed: false}},
+
+		// 解析不出集数
+		{"Title", EpisodeName{Season: 1, Number: 0, Kind: EpisodeKindRegular, Parsed: false}},
+		{"Title 1080p", EpisodeName{Season: 1, Number: 0, Kind: EpisodeKindRegular, Parsed: false}},
+		{"Title 2024", EpisodeName{Season: 1, Number: 0, Kind: EpisodeKindRegular, Parsed: false}},
+		{"Title [1080p].mkv", EpisodeName{Season: 1, Number: 0, Kind: EpisodeKindRegular, Parsed: false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseEpisodeName(tt.name); got != tt.want {
+				t.Fatalf("ParseEpisodeName(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEpisodeLess(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			name:  "chinese episodes in numeric order",
+			input: []string{"第10集", "第2集", "第1集"},
+			want:  []string{"第1集", "第2集", "第10集"},
+		},
+		{
+			name:  "mixed EP spellings",
+			input: []string{"EP10", "EP 2", "EP01"},
+			want:  []string{"EP01", "EP 2", "EP10"},
+		},
+		{
+			name:  "seasons before episode numbers",
+			input: []string{"S02E01", "S01E10", "S01E02"},
+			want:  []string{"S01E02", "S01E10", "S02E01"},
+		},
+		{
+			name:  "regular then special, ova and pv",
+			input: []string{"Title PV1", "Title OVA 1", "Title Special 1", "Title 02", "Title 01"},
+			want:  []string{"Title 01", "Title 02", "Title Special 1", "Title OVA 1", "Title PV1"},
+		},
+		{
+			name:  "unparsed names last in natural order",
+			input: []string{"Extra b10", "EP3", "Extra b2"},
+			want:  []string{"EP3", "Extra b2", "Extra b10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]string(nil), tt.input...)
+			sort.SliceStable(got, func(i, j int) bool {
+				return EpisodeLess(got[i], got[j])
+			})
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+var pinyinArgs = pinyin.Args{Style: pinyin.Normal}
+
+// PinyinText 是文本的全拼和首字母形式，只保留字母和数字。
+// FullOffsets[i]、InitialOffsets[i] 是第 i 个字节对应原文中的字符下标，用于高亮原文
+type PinyinText struct {
+	Full           string
+	Initials       string
+	FullOffsets    []int
+	InitialOffsets []int
+}
+
+// ToPinyin 把文本中的汉字转换为拼音，其他字母和数字转为小写保留。没有汉字时返回 false
+func ToPinyin(s string) (PinyinText, bool) {
+	var text PinyinText
+	var full, initials strings.Builder
+	hasHan := false
+
+	for i, r := range []rune(s) {
+		if unicode.Is(unicode.Han, r) {
+			pys := pinyin.SinglePinyin(r, pinyinArgs)
+			if len(pys) == 0 || pys[0] == "" {
+				continue
+			}
+			hasHan = true
+			full.WriteString(pys[0])
+			for range pys[0] {
+				text.FullOffsets = append(text.FullOffsets, i)
+			}
+			initials.WriteByte(pys[0][0])
+			text.InitialOffsets = append(text.InitialOffsets, i)
+			continue
+		}
+
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		lower := string(unicode.ToLower(r))
+		full.WriteString(lower)
+		initials.WriteString(lower)
+		for range []byte(lower) {
+			text.FullOffsets = append(text.FullOffsets, i)
+			text.InitialOffsets = append(text.InitialOffsets, i)
+		}
+	}
+
+	text.Full = full.String()
+	text.Initials = initials.String()
+	return text, hasHan
+}
+
+// IsPinyinQuery 判断搜索词是否可能是拼音，即只包含ASCII字母和数字
+func IsPinyinQuery(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || (!unicode.IsLetter(r) && !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}